@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// bastionHostAlias is the Host alias of the default profile's bastion in the tins SSH config include file;
+// other profiles append their name. The dot keeps it apart from instance names, which always start with "tins-".
+const bastionHostAlias = "tins.bastion"
+
+// profileBastionHostAlias returns the Host alias of the bastion of a config profile
+func profileBastionHostAlias(profile string) string {
+	if profile == "" || profile == DefaultProfileName {
+		return bastionHostAlias
+	}
+	return bastionHostAlias + "." + profile
+}
+
+// isBastionHostAlias reports whether a Host alias is the bastion of some profile
+func isBastionHostAlias(name string) bool {
+	return name == bastionHostAlias || strings.HasPrefix(name, bastionHostAlias+".")
+}
+
+// BastionConfig describes the jump host that instances on a private network are reached through
+type BastionConfig struct {
+	Host string `yaml:"host"` // Bastion hostname or IP; an empty host means no bastion
+	User string `yaml:"user"` // Login user on the bastion (default: the local user name)
+	Key  string `yaml:"key"`  // Private key for the bastion (default: any ssh-agent key)
+	Port int    `yaml:"port"` // SSH port of the bastion (default: 22)
+}
+
+// override replaces the settings that are set in other
+func (b *BastionConfig) override(other BastionConfig) {
+	overrideString(&b.Host, other.Host)
+	overrideString(&b.User, other.User)
+	overrideString(&b.Key, other.Key)
+	if other.Port != 0 {
+		b.Port = other.Port
+	}
+}
+
+// Enabled reports whether a bastion is configured
+func (b BastionConfig) Enabled() bool {
+	return b.Host != ""
+}
+
+// validate checks the bastion settings and fills in the default user and port
+func (b *BastionConfig) validate() error {
+	if !b.Enabled() {
+		if b.User != "" || b.Key != "" || b.Port != 0 {
+			return fmt.Errorf("bastion.host is required when other bastion settings are given")
+		}
+		return nil
+	}
+	if b.Port == 0 {
+		b.Port = DefaultSSHPort
+	}
+	if b.Port < 1 || b.Port > 65535 {
+		return fmt.Errorf("invalid bastion.port %d", b.Port)
+	}
+	if b.User == "" {
+		b.User = localUserName()
+	}
+	if b.User == "" {
+		return fmt.Errorf("bastion.user is required (the local user name could not be determined)")
+	}
+	return nil
+}
+
+// localUserName returns the name of the local user, which ssh also uses by default
+func localUserName() string {
+	current, err := user.Current()
+	if err != nil {
+		return os.Getenv("USER")
+	}
+	// Windows user names carry the domain, e.g. DOMAIN\user
+	if _, name, ok := strings.Cut(current.Username, `\`); ok {
+		return name
+	}
+	return current.Username
+}
+
+// ProxyJump returns the bastion in ssh -J / ProxyJump form: user@host[:port]
+func (b BastionConfig) ProxyJump() string {
+	host := b.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if b.Port != 0 && b.Port != DefaultSSHPort {
+		host += ":" + strconv.Itoa(b.Port)
+	}
+	return b.User + "@" + host
+}
+
+// bastionTarget returns the SSH target for the configured bastion, or nil if there is none
+func bastionTarget(config *OpenStackConfig) *SSHTarget {
+	bastion := config.Bastion
+	if !bastion.Enabled() {
+		return nil
+	}
+
+	keyPath := ""
+	if bastion.Key != "" {
+		keyPath = expandHome(bastion.Key)
+	}
+	return &SSHTarget{
+		User:    bastion.User,
+		Host:    bastion.Host,
+		Port:    bastion.Port,
+		KeyPath: keyPath,
+		Passphrase: func() ([]byte, error) {
+			return keyPassphrase(config.KeyPassphraseCommand, false)
+		},
+		HostKeyCallback: bastionHostKeyCallback(),
+	}
+}
+
+// bastionHostKeyCallback verifies the bastion against ~/.ssh/known_hosts. The bastion is a long-lived host
+// that the user has normally connected to before; if it isn't listed yet, its key is accepted with a warning.
+// A known_hosts file that exists but can't be read or parsed rejects every key.
+func bastionHostKeyCallback() ssh.HostKeyCallback {
+	path := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+	callback, err := knownhosts.New(path)
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("bastion host key cannot be verified, failed to read %s: %w", path, err)
+		}
+
+		var checkErr error = &knownhosts.KeyError{}
+		if err == nil {
+			checkErr = callback(hostname, remote, key)
+		}
+		var keyErr *knownhosts.KeyError
+		if errors.As(checkErr, &keyErr) && len(keyErr.Want) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Bastion %s is not in %s, its host key (%s) is not verified\n", hostname, path, ssh.FingerprintSHA256(key))
+			return nil
+		}
+		if checkErr != nil {
+			return fmt.Errorf("bastion host key verification failed: %w", checkErr)
+		}
+		return nil
+	}
+}
+
+// bastionSSHConfigBlock renders a profile's bastion as a Host block that instance blocks reach it through with ProxyJump
+func bastionSSHConfigBlock(bastion BastionConfig, profile string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Host %s\n", profileBastionHostAlias(profile))
+	fmt.Fprintf(&b, "    %s%s\n", sshConfigProfileMarker, profile)
+	fmt.Fprintf(&b, "    HostName %s\n", bastion.Host)
+	fmt.Fprintf(&b, "    User %s\n", bastion.User)
+	if bastion.Port != 0 && bastion.Port != DefaultSSHPort {
+		fmt.Fprintf(&b, "    Port %d\n", bastion.Port)
+	}
+	if bastion.Key != "" {
+		fmt.Fprintf(&b, "    IdentityFile %s\n", quoteSSHConfigValue(expandHome(bastion.Key)))
+		fmt.Fprintf(&b, "    IdentitiesOnly yes\n")
+	}
+	return b.String()
+}
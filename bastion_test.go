@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestBastionConfig(t *testing.T) {
+	bastion := BastionConfig{Host: "bastion.example.com", User: "jump"}
+	if err := bastion.validate(); err != nil {
+		t.Fatalf("validate failed: %v", err)
+	}
+	if bastion.Port != DefaultSSHPort {
+		t.Errorf("Expected default port %d, got %d", DefaultSSHPort, bastion.Port)
+	}
+	if bastion.ProxyJump() != "jump@bastion.example.com" {
+		t.Errorf("Expected 'jump@bastion.example.com', got '%s'", bastion.ProxyJump())
+	}
+
+	bastion = BastionConfig{Host: "fd00::1", User: "jump", Port: 2222}
+	if bastion.ProxyJump() != "jump@[fd00::1]:2222" {
+		t.Errorf("Expected 'jump@[fd00::1]:2222', got '%s'", bastion.ProxyJump())
+	}
+
+	bastion = BastionConfig{Host: "bastion.example.com"}
+	if err := bastion.validate(); err != nil || bastion.User == "" {
+		t.Errorf("Expected the local user name as default, got '%s', %v", bastion.User, err)
+	}
+
+	bastion = BastionConfig{User: "jump"}
+	if err := bastion.validate(); err == nil {
+		t.Error("Expected an error for bastion settings without a host")
+	}
+
+	base := BastionConfig{Host: "bastion.example.com", User: "jump", Port: 2222}
+	base.override(BastionConfig{Host: "other.example.com"})
+	if base.Host != "other.example.com" || base.User != "jump" || base.Port != 2222 {
+		t.Errorf("Expected only the host to be overridden, got %+v", base)
+	}
+}
+
+func TestBastionHostKeyCallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	key, otherKey := newFakeHostKey(), newFakeHostKey()
+	remote := &net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 22}
+	knownHosts := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+
+	// Without a known_hosts file the bastion is accepted with a warning
+	if err := bastionHostKeyCallback()("bastion.example.com:22", remote, key); err != nil {
+		t.Errorf("Expected an unknown bastion to be accepted, got %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(knownHosts), 0700); err != nil {
+		t.Fatalf("Failed to create .ssh: %v", err)
+	}
+	line := "bastion.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + "\n"
+	if err := os.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+	if err := bastionHostKeyCallback()("bastion.example.com:22", remote, key); err != nil {
+		t.Errorf("Expected the listed key to be accepted, got %v", err)
+	}
+	if err := bastionHostKeyCallback()("bastion.example.com:22", remote, otherKey); err == nil {
+		t.Error("Expected a different key to be rejected")
+	}
+
+	// A known_hosts file that can't be parsed must not turn verification off
+	if err := os.WriteFile(knownHosts, []byte("bastion.example.com ssh-ed25519 !!!\n"), 0600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+	if err := bastionHostKeyCallback()("bastion.example.com:22", remote, key); err == nil {
+		t.Error("Expected a malformed known_hosts file to reject the bastion")
+	}
+}
+
+func TestBastionSSHConfigBlock(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	block := bastionSSHConfigBlock(BastionConfig{Host: "bastion.example.com", User: "jump", Key: "~/.ssh/bastion", Port: 2222}, DefaultProfileName)
+	for _, want := range []string{
+		"Host tins.bastion\n",
+		"    HostName bastion.example.com\n",
+		"    User jump\n",
+		"    Port 2222\n",
+		"    IdentityFile /home/test/.ssh/bastion\n",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("Expected bastion block to contain %q, got:\n%s", want, block)
+		}
+	}
+
+	block = bastionSSHConfigBlock(BastionConfig{Host: "bastion.example.com", User: "jump", Port: DefaultSSHPort}, DefaultProfileName)
+	if strings.Contains(block, "Port") || strings.Contains(block, "IdentityFile") {
+		t.Errorf("Expected default settings to be left out, got:\n%s", block)
+	}
+
+	// Each profile has a bastion of its own
+	block = bastionSSHConfigBlock(BastionConfig{Host: "east.example.com", User: "jump"}, "east")
+	if !strings.HasPrefix(block, "Host tins.bastion.east\n") || sshConfigBlockProfile(block) != "east" {
+		t.Errorf("Expected the east profile's bastion block, got:\n%s", block)
+	}
+}
+
+// startTestSSHServer runs an SSH server that accepts any public key. It answers exec requests with
+// "<name>: <command>" and, if forward is true, tunnels direct-tcpip channels like a bastion.
+func startTestSSHServer(t *testing.T, name string, forward bool) string {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) { return nil, nil },
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, serverConfig, name, forward)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig, name string, forward bool) {
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		switch {
+		case newChannel.ChannelType() == "session":
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go func() {
+				defer channel.Close()
+				for request := range channelRequests {
+					if request.Type != "exec" {
+						request.Reply(false, nil)
+						continue
+					}
+					var payload struct{ Command string }
+					ssh.Unmarshal(request.Payload, &payload)
+					request.Reply(true, nil)
+					fmt.Fprintf(channel, "%s: %s", name, payload.Command)
+					channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+					return
+				}
+			}()
+		case newChannel.ChannelType() == "direct-tcpip" && forward:
+			var payload struct {
+				Host       string
+				Port       uint32
+				OriginHost string
+				OriginPort uint32
+			}
+			ssh.Unmarshal(newChannel.ExtraData(), &payload)
+			target, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+			if err != nil {
+				newChannel.Reject(ssh.ConnectionFailed, err.Error())
+				continue
+			}
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				target.Close()
+				continue
+			}
+			go ssh.DiscardRequests(channelRequests)
+			go func() {
+				io.Copy(target, channel)
+				target.Close()
+			}()
+			go func() {
+				io.Copy(channel, target)
+				channel.Close()
+			}()
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+func TestRunRemoteCommand_Bastion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	keyPair, err := GenerateSSHKey("tunnelled", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	instanceAddr := startTestSSHServer(t, "instance", false)
+	bastionAddr := startTestSSHServer(t, "bastion", true)
+	instanceHost, instancePort, _ := net.SplitHostPort(instanceAddr)
+	bastionHost, bastionPort, _ := net.SplitHostPort(bastionAddr)
+
+	target := SSHTarget{User: "root", Host: instanceHost, KeyPath: keyPair.PrivateKeyPath}
+	fmt.Sscan(instancePort, &target.Port)
+	target.Bastion = &SSHTarget{User: "jump", Host: bastionHost, KeyPath: keyPair.PrivateKeyPath, HostKeyCallback: bastionHostKeyCallback()}
+	fmt.Sscan(bastionPort, &target.Bastion.Port)
+
+	var stdout strings.Builder
+	exitCode, err := runRemoteCommand(target, "hostname", nil, &stdout, io.Discard)
+	if err != nil || exitCode != 0 {
+		t.Fatalf("runRemoteCommand failed: %d, %v", exitCode, err)
+	}
+	if stdout.String() != "instance: hostname" {
+		t.Errorf("Expected the command to run on the instance, got %q", stdout.String())
+	}
+
+	// A bastion that can't reach the instance fails the connection
+	target.Port = 1
+	if _, err := runRemoteCommand(target, "hostname", nil, io.Discard, io.Discard); err == nil || !strings.Contains(err.Error(), "through bastion") {
+		t.Errorf("Expected a bastion connection error, got %v", err)
+	}
+}
+
+func TestCreateTerminate_Bastion(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, terminateCmd)
+
+	content := "bastion:\n  host: bastion.example.com\n  user: jump\n  port: 2222\n"
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	output, err := runCommand(t, "create", "private")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "-J jump@bastion.example.com:2222 ubuntu@") {
+		t.Errorf("Expected the ssh hint to jump through the bastion, got:\n%s", output)
+	}
+
+	_, blocks, err := readSSHConfigBlocks()
+	if err != nil {
+		t.Fatalf("readSSHConfigBlocks failed: %v", err)
+	}
+	if !strings.Contains(blocks["tins-private"], "ProxyJump tins.bastion") {
+		t.Errorf("Expected the Host block to jump through the bastion, got:\n%s", blocks["tins-private"])
+	}
+	if !strings.Contains(blocks[bastionHostAlias], "HostName bastion.example.com") {
+		t.Errorf("Expected a bastion Host block, got:\n%s", blocks[bastionHostAlias])
+	}
+
+	instance, err := findInstance(t.Context(), provider, "private")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	target, err := sshTargetForInstance(instance, "root", config)
+	if err != nil {
+		t.Fatalf("sshTargetForInstance failed: %v", err)
+	}
+	if target.Bastion == nil || target.Bastion.address() != "bastion.example.com:2222" || target.Bastion.User != "jump" {
+		t.Errorf("Expected connections to go through the bastion, got %+v", target.Bastion)
+	}
+
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	names, _, _ := readSSHConfigBlocks()
+	if strings.Join(names, ",") != bastionHostAlias {
+		t.Errorf("Expected only the bastion block to remain, got %v", names)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const cloudConfigHeader = "#cloud-config"
+
+// cloudConfigMergeHow makes cloud-init append lists and merge maps when tins adds its own
+// cloud-config part next to the user's, instead of letting the later part replace keys
+const cloudConfigMergeHow = "dict(recurse_array,no_replace)+list(append)"
+
+// userDataContentTypes maps the first line of a user-data script to its MIME type
+var userDataContentTypes = []struct {
+	prefix      string
+	contentType string
+}{
+	{"#!", "text/x-shellscript"},
+	{"#include", "text/x-include-url"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#upstart-job", "text/upstart-job"},
+	{"#part-handler", "text/part-handler"},
+}
+
+// mergeCloudConfig adds the settings in extra to user-data, keeping everything the user provided.
+// A #cloud-config document is merged in place (lists are appended, maps are merged), MIME multipart
+// user-data gets an extra cloud-config part, and any other script is wrapped in a multipart archive
+// next to a cloud-config part.
+func mergeCloudConfig(userData []byte, extra map[string]interface{}) ([]byte, error) {
+	if len(extra) == 0 {
+		return userData, nil
+	}
+
+	trimmed := bytes.TrimLeft(userData, " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+		return encodeCloudConfig(extra)
+	case bytes.HasPrefix(trimmed, []byte(cloudConfigHeader)):
+		return mergeCloudConfigDocument(trimmed, extra)
+	case bytes.HasPrefix(trimmed, []byte{0x1f, 0x8b}):
+		return nil, fmt.Errorf("cannot add settings to gzip-compressed user-data")
+	case hasMIMEHeader(trimmed):
+		return appendCloudConfigPart(trimmed, extra)
+	}
+
+	contentType := ""
+	for _, entry := range userDataContentTypes {
+		if bytes.HasPrefix(trimmed, []byte(entry.prefix)) {
+			contentType = entry.contentType
+			break
+		}
+	}
+	if contentType == "" {
+		return nil, fmt.Errorf("unrecognized user-data format (expected #cloud-config, a script starting with #! or MIME multipart)")
+	}
+
+	part, err := encodeCloudConfigPart(extra)
+	if err != nil {
+		return nil, err
+	}
+	return writeMultipart([]mimePart{
+		{header: partHeader(contentType), body: userData},
+		{header: partHeader("text/cloud-config"), body: part},
+	})
+}
+
+// encodeCloudConfig renders settings as a standalone #cloud-config document
+func encodeCloudConfig(settings map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigHeader + "\n")
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(settings); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCloudConfigPart renders settings as a cloud-config part that merges with the user's parts
+func encodeCloudConfigPart(settings map[string]interface{}) ([]byte, error) {
+	withMergeHow := map[string]interface{}{"merge_how": cloudConfigMergeHow}
+	for key, value := range settings {
+		withMergeHow[key] = value
+	}
+	return encodeCloudConfig(withMergeHow)
+}
+
+// mergeCloudConfigDocument merges settings into an existing #cloud-config document
+func mergeCloudConfigDocument(document []byte, extra map[string]interface{}) ([]byte, error) {
+	// Drop the header line so the YAML parser doesn't attach it to the first key as a comment
+	body := document[len(cloudConfigHeader):]
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse cloud-config user-data: %w", err)
+	}
+	if root.Kind == 0 {
+		return encodeCloudConfig(extra)
+	}
+	if len(root.Content) != 1 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("cloud-config user-data must be a YAML mapping")
+	}
+
+	var additions yaml.Node
+	if err := additions.Encode(extra); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-config: %w", err)
+	}
+	if err := mergeYAMLMapping(root.Content[0], &additions, ""); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigHeader + "\n")
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode cloud-config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeYAMLMapping merges the mapping node src into dst. Lists are appended without duplicating
+// entries and nested maps are merged; any other key the user already set is a conflict.
+func mergeYAMLMapping(dst, src *yaml.Node, path string) error {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+
+		existing := mappingValue(dst, key.Value)
+		switch {
+		case existing == nil:
+			dst.Content = append(dst.Content, key, value)
+		case existing.Kind == yaml.ScalarNode && existing.Tag == "!!null":
+			*existing = *value
+		case existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			for _, item := range value.Content {
+				if !sequenceContains(existing, item) {
+					existing.Content = append(existing.Content, item)
+				}
+			}
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			if err := mergeYAMLMapping(existing, value, keyPath); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("user-data already sets '%s'; remove it or let tins manage it", keyPath)
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil if the key is absent
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sequenceContains reports whether a sequence node already holds an equal scalar
+func sequenceContains(sequence, item *yaml.Node) bool {
+	if item.Kind != yaml.ScalarNode {
+		return false
+	}
+	for _, existing := range sequence.Content {
+		if existing.Kind == yaml.ScalarNode && existing.Value == item.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMIMEHeader reports whether user-data starts with a MIME header rather than a script
+func hasMIMEHeader(data []byte) bool {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	return bytes.HasPrefix(bytes.ToLower(firstLine), []byte("content-type:")) ||
+		bytes.HasPrefix(bytes.ToLower(firstLine), []byte("mime-version:"))
+}
+
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+func partHeader(contentType string) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+`; charset="utf-8"`)
+	return header
+}
+
+// appendCloudConfigPart copies the parts of MIME multipart user-data and adds a cloud-config part
+func appendCloudConfigPart(userData []byte, extra map[string]interface{}) ([]byte, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(userData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MIME user-data: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MIME user-data: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, fmt.Errorf("unsupported MIME user-data type %s (expected multipart)", mediaType)
+	}
+
+	var parts []mimePart
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MIME user-data: %w", err)
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MIME user-data: %w", err)
+		}
+		parts = append(parts, mimePart{header: part.Header, body: body})
+	}
+
+	cloudConfig, err := encodeCloudConfigPart(extra)
+	if err != nil {
+		return nil, err
+	}
+	parts = append(parts, mimePart{header: partHeader("text/cloud-config"), body: cloudConfig})
+	return writeMultipart(parts)
+}
+
+// writeMultipart builds a MIME multipart/mixed user-data archive
+func writeMultipart(parts []mimePart) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write MIME user-data: %w", err)
+		}
+		if _, err := w.Write(part.body); err != nil {
+			return nil, fmt.Errorf("failed to write MIME user-data: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write MIME user-data: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=\"%s\"\n", writer.Boundary())
+	buf.WriteString("MIME-Version: 1.0\n\n")
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+var testAuthorizedKeys = map[string]interface{}{
+	"ssh_authorized_keys": []string{"ssh-ed25519 AAAAteammate teammate@example.com"},
+}
+
+// readMultipartUserData returns the content type and body of each part of MIME user-data
+func readMultipartUserData(t *testing.T, userData []byte) ([]string, []string) {
+	t.Helper()
+	message, err := mail.ReadMessage(bytes.NewReader(userData))
+	if err != nil {
+		t.Fatalf("user-data is not a MIME message: %v\n%s", err, userData)
+	}
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("invalid Content-Type: %v", err)
+	}
+
+	var contentTypes, bodies []string
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		contentTypes = append(contentTypes, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	return contentTypes, bodies
+}
+
+func TestMergeCloudConfig_NoUserData(t *testing.T) {
+	userData, err := mergeCloudConfig(nil, testAuthorizedKeys)
+	if err != nil {
+		t.Fatalf("mergeCloudConfig failed: %v", err)
+	}
+	if !strings.HasPrefix(string(userData), "#cloud-config\n") {
+		t.Errorf("Expected a cloud-config document, got:\n%s", userData)
+	}
+	if !strings.Contains(string(userData), "teammate@example.com") {
+		t.Errorf("Expected the authorized key in user-data, got:\n%s", userData)
+	}
+
+	// Nothing to add leaves user-data untouched
+	unchanged, err := mergeCloudConfig([]byte("#!/bin/sh\n"), nil)
+	if err != nil || string(unchanged) != "#!/bin/sh\n" {
+		t.Errorf("Expected user-data to be unchanged, got %q, %v", unchanged, err)
+	}
+}
+
+func TestMergeCloudConfig_CloudConfig(t *testing.T) {
+	original := `#cloud-config
+packages:
+  - git
+ssh_authorized_keys:
+  - ssh-ed25519 AAAAowner owner@example.com
+`
+	userData, err := mergeCloudConfig([]byte(original), testAuthorizedKeys)
+	if err != nil {
+		t.Fatalf("mergeCloudConfig failed: %v", err)
+	}
+	if !strings.HasPrefix(string(userData), "#cloud-config\n") {
+		t.Fatalf("Expected the #cloud-config header to be kept, got:\n%s", userData)
+	}
+
+	var merged struct {
+		Packages          []string `yaml:"packages"`
+		SSHAuthorizedKeys []string `yaml:"ssh_authorized_keys"`
+	}
+	if err := yaml.Unmarshal(userData, &merged); err != nil {
+		t.Fatalf("merged user-data is not valid YAML: %v", err)
+	}
+	if len(merged.Packages) != 1 || merged.Packages[0] != "git" {
+		t.Errorf("Expected packages to be kept, got %v", merged.Packages)
+	}
+	if len(merged.SSHAuthorizedKeys) != 2 {
+		t.Fatalf("Expected the owner and teammate keys, got %v", merged.SSHAuthorizedKeys)
+	}
+	if !strings.HasSuffix(merged.SSHAuthorizedKeys[1], "teammate@example.com") {
+		t.Errorf("Expected the teammate key to be appended, got %v", merged.SSHAuthorizedKeys)
+	}
+
+	// Merging the same key again doesn't duplicate it
+	again, err := mergeCloudConfig(userData, testAuthorizedKeys)
+	if err != nil {
+		t.Fatalf("mergeCloudConfig failed: %v", err)
+	}
+	if strings.Count(string(again), "teammate@example.com") != 1 {
+		t.Errorf("Expected the teammate key once, got:\n%s", again)
+	}
+
+	// A scalar where tins needs a list is a conflict rather than being overwritten
+	if _, err := mergeCloudConfig([]byte("#cloud-config\nssh_authorized_keys: oops\n"), testAuthorizedKeys); err == nil {
+		t.Error("Expected an error for a conflicting ssh_authorized_keys value")
+	}
+}
+
+func TestMergeCloudConfig_Script(t *testing.T) {
+	script, err := os.ReadFile("testdata/user-data.sh")
+	if err != nil {
+		t.Fatalf("failed to read test user-data: %v", err)
+	}
+
+	userData, err := mergeCloudConfig(script, testAuthorizedKeys)
+	if err != nil {
+		t.Fatalf("mergeCloudConfig failed: %v", err)
+	}
+
+	contentTypes, bodies := readMultipartUserData(t, userData)
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 parts, got %d", len(bodies))
+	}
+	if !strings.HasPrefix(contentTypes[0], "text/x-shellscript") || bodies[0] != string(script) {
+		t.Errorf("Expected the script to be kept as the first part, got %s", contentTypes[0])
+	}
+	if !strings.HasPrefix(contentTypes[1], "text/cloud-config") || !strings.Contains(bodies[1], "teammate@example.com") {
+		t.Errorf("Expected a cloud-config part with the key, got %s:\n%s", contentTypes[1], bodies[1])
+	}
+	if !strings.Contains(bodies[1], "merge_how") {
+		t.Error("Expected the cloud-config part to set merge_how")
+	}
+
+	// Existing multipart user-data gets one more part
+	userData, err = mergeCloudConfig(userData, map[string]interface{}{"packages": []string{"git"}})
+	if err != nil {
+		t.Fatalf("mergeCloudConfig failed: %v", err)
+	}
+	_, bodies = readMultipartUserData(t, userData)
+	if len(bodies) != 3 || bodies[0] != string(script) {
+		t.Errorf("Expected the existing parts to be kept and one part added, got %d parts", len(bodies))
+	}
+
+	if _, err := mergeCloudConfig([]byte("just some text"), testAuthorizedKeys); err == nil {
+		t.Error("Expected an error for unrecognized user-data")
+	}
+}
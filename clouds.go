@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// systemCloudConfigDir is the system-wide clouds.yaml location, replaceable in tests
+var systemCloudConfigDir = "/etc/openstack"
+
+// osCloudFlag holds the value of the global --os-cloud flag
+var osCloudFlag string
+
+// CloudsFile represents a standard OpenStack clouds.yaml or secure.yaml file
+type CloudsFile struct {
+	Clouds map[string]CloudConfig `yaml:"clouds"`
+}
+
+// CloudConfig is a single named cloud from clouds.yaml
+type CloudConfig struct {
+	AuthType   string    `yaml:"auth_type"`
+	Auth       CloudAuth `yaml:"auth"`
+	RegionName string    `yaml:"region_name"`
+}
+
+// CloudAuth is the auth block of a cloud in clouds.yaml
+type CloudAuth struct {
+	AuthURL           string `yaml:"auth_url"`
+	Username          string `yaml:"username"`
+	Password          string `yaml:"password"`
+	UserDomainName    string `yaml:"user_domain_name"`
+	ProjectDomainName string `yaml:"project_domain_name"`
+	DomainName        string `yaml:"domain_name"`
+	ProjectID         string `yaml:"project_id"`
+	ProjectName       string `yaml:"project_name"`
+
+	ApplicationCredentialID     string `yaml:"application_credential_id"`
+	ApplicationCredentialName   string `yaml:"application_credential_name"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret"`
+	Token                       string `yaml:"token"`
+}
+
+// selectedCloudName returns the cloud requested via --os-cloud, then OS_CLOUD, then the tins profile
+func selectedCloudName(profileCloud string) string {
+	if osCloudFlag != "" {
+		return osCloudFlag
+	}
+	if cloud := os.Getenv("OS_CLOUD"); cloud != "" {
+		return cloud
+	}
+	return profileCloud
+}
+
+// cloudConfigDirs returns the directories searched for clouds.yaml and secure.yaml, in order
+func cloudConfigDirs() []string {
+	var dirs []string
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, cwd)
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(homeDir, ".config", "openstack"))
+	}
+	return append(dirs, systemCloudConfigDir)
+}
+
+// findCloudsFile returns the first file with the given name in the standard search paths
+func findCloudsFile(fileName string) (string, bool) {
+	for _, dir := range cloudConfigDirs() {
+		path := filepath.Join(dir, fileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// loadCloudsFile parses a clouds.yaml or secure.yaml file
+func loadCloudsFile(filePath string) (*CloudsFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+
+	var file CloudsFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+
+	return &file, nil
+}
+
+// loadCloud resolves a named cloud from clouds.yaml, with secrets from secure.yaml layered on top
+func loadCloud(name string) (*CloudConfig, error) {
+	cloudsPath, ok := findCloudsFile("clouds.yaml")
+	if !ok {
+		return nil, fmt.Errorf("cloud '%s' requested but no clouds.yaml found in %s", name, strings.Join(cloudConfigDirs(), ", "))
+	}
+
+	clouds, err := loadCloudsFile(cloudsPath)
+	if err != nil {
+		return nil, err
+	}
+	cloud, ok := clouds.Clouds[name]
+	if !ok {
+		return nil, fmt.Errorf("cloud '%s' not found in %s", name, cloudsPath)
+	}
+
+	if securePath, ok := findCloudsFile("secure.yaml"); ok {
+		secure, err := loadCloudsFile(securePath)
+		if err != nil {
+			return nil, err
+		}
+		if secret, ok := secure.Clouds[name]; ok {
+			cloud.override(secret)
+		}
+	}
+
+	return &cloud, nil
+}
+
+// override replaces settings with the non-empty values from other
+func (c *CloudConfig) override(other CloudConfig) {
+	overrideString(&c.AuthType, other.AuthType)
+	overrideString(&c.RegionName, other.RegionName)
+	overrideString(&c.Auth.AuthURL, other.Auth.AuthURL)
+	overrideString(&c.Auth.Username, other.Auth.Username)
+	overrideString(&c.Auth.Password, other.Auth.Password)
+	overrideString(&c.Auth.UserDomainName, other.Auth.UserDomainName)
+	overrideString(&c.Auth.ProjectDomainName, other.Auth.ProjectDomainName)
+	overrideString(&c.Auth.DomainName, other.Auth.DomainName)
+	overrideString(&c.Auth.ProjectID, other.Auth.ProjectID)
+	overrideString(&c.Auth.ProjectName, other.Auth.ProjectName)
+	overrideString(&c.Auth.ApplicationCredentialID, other.Auth.ApplicationCredentialID)
+	overrideString(&c.Auth.ApplicationCredentialName, other.Auth.ApplicationCredentialName)
+	overrideString(&c.Auth.ApplicationCredentialSecret, other.Auth.ApplicationCredentialSecret)
+	overrideString(&c.Auth.Token, other.Auth.Token)
+}
+
+// applyTo copies the cloud's auth and region settings into config, replacing values from the tins config file.
+// Instance settings (image, flavor, network, availability zone) are left alone.
+func (c *CloudConfig) applyTo(config *OpenStackConfig) {
+	overrideString(&config.AuthType, c.AuthType)
+	overrideString(&config.AuthURL, c.Auth.AuthURL)
+	overrideString(&config.Username, c.Auth.Username)
+	overrideString(&config.Password, c.Auth.Password)
+	overrideString(&config.DomainName, c.Auth.ProjectDomainName)
+	overrideString(&config.DomainName, c.Auth.DomainName)
+	overrideString(&config.DomainName, c.Auth.UserDomainName)
+	// Never mix a project ID from one source with a project name from another
+	if c.Auth.ProjectID != "" || c.Auth.ProjectName != "" {
+		config.ProjectID = c.Auth.ProjectID
+		config.ProjectName = c.Auth.ProjectName
+	}
+	overrideString(&config.ApplicationCredentialID, c.Auth.ApplicationCredentialID)
+	overrideString(&config.ApplicationCredentialName, c.Auth.ApplicationCredentialName)
+	overrideString(&config.ApplicationCredentialSecret, c.Auth.ApplicationCredentialSecret)
+	overrideString(&config.Token, c.Auth.Token)
+	overrideString(&config.RegionName, c.RegionName)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCloudsYAML = `clouds:
+  team:
+    region_name: "cloud-region"
+    auth:
+      auth_url: "https://keystone.example.com/v3"
+      username: "cloud-user"
+      user_domain_name: "Users"
+      project_name: "cloud-project"
+`
+
+const testSecureYAML = `clouds:
+  team:
+    auth:
+      password: "cloud-password"
+`
+
+// useCloudConfigDirs isolates the clouds.yaml search paths and the --os-cloud flag for a test
+func useCloudConfigDirs(t *testing.T) {
+	t.Helper()
+	original := systemCloudConfigDir
+	systemCloudConfigDir = t.TempDir()
+	osCloudFlag = ""
+	t.Cleanup(func() {
+		systemCloudConfigDir = original
+		osCloudFlag = ""
+	})
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestLoadConfig_OSCloud(t *testing.T) {
+	writeProfilesConfig(t, `auth_url: "https://ignored.example.com/v3"
+username: "tins-user"
+project_id: "tins-project-id"
+project_name: "tins-project"
+region_name: "tins-region"
+availability_zone: "tins-az"
+image_name: "tins-image"
+network_name: "tins-network"
+`)
+	useCloudConfigDirs(t)
+	t.Setenv("OS_PASSWORD", "")
+
+	cwd, _ := os.Getwd()
+	home, _ := os.UserHomeDir()
+	writeTestFile(t, filepath.Join(cwd, "clouds.yaml"), testCloudsYAML)
+	writeTestFile(t, filepath.Join(home, ".config", "openstack", "secure.yaml"), testSecureYAML)
+	t.Setenv("OS_CLOUD", "team")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if config.CloudName != "team" {
+		t.Errorf("Expected cloud 'team', got '%s'", config.CloudName)
+	}
+	if config.AuthURL != "https://keystone.example.com/v3" || config.Username != "cloud-user" || config.DomainName != "Users" {
+		t.Errorf("Expected auth settings from clouds.yaml, got auth_url '%s' username '%s' domain '%s'", config.AuthURL, config.Username, config.DomainName)
+	}
+	if config.Password != "cloud-password" {
+		t.Errorf("Expected password from secure.yaml, got '%s'", config.Password)
+	}
+	if config.ProjectName != "cloud-project" || config.ProjectID != "" {
+		t.Errorf("Expected project from clouds.yaml only, got name '%s' id '%s'", config.ProjectName, config.ProjectID)
+	}
+	if config.RegionName != "cloud-region" {
+		t.Errorf("Expected region from clouds.yaml, got '%s'", config.RegionName)
+	}
+	if config.ImageName != "tins-image" || config.NetworkName != "tins-network" || config.AvailabilityZone != "tins-az" {
+		t.Errorf("Expected instance settings from tins config, got image '%s' network '%s' az '%s'", config.ImageName, config.NetworkName, config.AvailabilityZone)
+	}
+
+	// OS_PASSWORD still overrides the cloud's password
+	t.Setenv("OS_PASSWORD", "env-password")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.Password != "env-password" {
+		t.Errorf("Expected OS_PASSWORD to override secure.yaml, got '%s'", config.Password)
+	}
+}
+
+func TestLoadConfig_OSCloudFromProfileAndFlag(t *testing.T) {
+	writeProfilesConfig(t, `availability_zone: "tins-az"
+image_name: "tins-image"
+network_name: "tins-network"
+default_profile: "team"
+profiles:
+  team:
+    cloud: "team"
+`)
+	useCloudConfigDirs(t)
+	writeTestFile(t, filepath.Join(systemCloudConfigDir, "clouds.yaml"), testCloudsYAML)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.CloudName != "team" || config.Username != "cloud-user" {
+		t.Errorf("Expected cloud from profile, got cloud '%s' username '%s'", config.CloudName, config.Username)
+	}
+
+	osCloudFlag = "other"
+	_, err = LoadConfig()
+	if err == nil || !strings.Contains(err.Error(), "cloud 'other' not found") {
+		t.Errorf("Expected --os-cloud to take precedence and fail for an unknown cloud, got %v", err)
+	}
+}
+
+func TestLoadCloud_NoCloudsFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	useCloudConfigDirs(t)
+
+	if _, err := loadCloud("team"); err == nil || !strings.Contains(err.Error(), "no clouds.yaml found") {
+		t.Errorf("Expected missing clouds.yaml error, got %v", err)
+	}
+}
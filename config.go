@@ -2,18 +2,43 @@ package main
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
-// ConfigFile represents the YAML configuration file structure
-type ConfigFile struct {
+const (
+	// AuthTypePassword authenticates with a username and password (default)
+	AuthTypePassword = "password"
+	// AuthTypeApplicationCredential authenticates with a Keystone application credential
+	AuthTypeApplicationCredential = "v3applicationcredential"
+	// AuthTypeToken authenticates with a pre-issued Keystone token
+	AuthTypeToken = "token"
+)
+
+// DefaultProfileName is the name of the implicit profile formed by the top-level settings in the config file
+const DefaultProfileName = "default"
+
+// ProfileConfig holds the settings that can be given at the top level of the config file or per profile
+type ProfileConfig struct {
+	Cloud string `yaml:"cloud"` // Named cloud from clouds.yaml providing the auth settings
+
+	AuthType   string `yaml:"auth_type"`
 	AuthURL    string `yaml:"auth_url"`
 	Username   string `yaml:"username"`
 	DomainName string `yaml:"domain_name"`
 
+	PasswordCommand string `yaml:"password_command"` // Command whose stdout is the password
+	PasswordFile    string `yaml:"password_file"`    // File holding the password (must not be group/world readable)
+
+	ApplicationCredentialID   string `yaml:"application_credential_id"`
+	ApplicationCredentialName string `yaml:"application_credential_name"`
+
 	ProjectID   string `yaml:"project_id"`
 	ProjectName string `yaml:"project_name"`
 
@@ -23,20 +48,72 @@ type ConfigFile struct {
 	ImageName  string `yaml:"image_name"`
 	FlavorName string `yaml:"flavor_name"`
 
+	BootVolumeSize int    `yaml:"boot_volume_size"`
+	VolumeType     string `yaml:"volume_type"`
+
 	NetworkName           string `yaml:"network_name"`
 	NetworkAttachmentMode string `yaml:"network_attachment_mode"`
+	FloatingIPPool        string `yaml:"floating_ip_pool"`
+
+	ExternalNetwork string   `yaml:"external_network"`
+	SubnetCIDR      string   `yaml:"subnet_cidr"`
+	DNSNameservers  []string `yaml:"dns_nameservers"`
+
+	SSHAllowedCIDR string `yaml:"ssh_allowed_cidr"`
+	PublicIPURL    string `yaml:"public_ip_url"`
+
+	KeyType              string `yaml:"key_type"`
+	EncryptKey           *bool  `yaml:"encrypt_key"`
+	KeyPassphraseCommand string `yaml:"key_passphrase_command"`
+	SSHAgent             string `yaml:"ssh_agent"`
+	SSHPublicKey         string `yaml:"ssh_public_key"`
+	LoginUser            string `yaml:"login_user"`
+
+	AuthorizedKeys []string `yaml:"authorized_keys"`
+
+	SSHCAKey            string   `yaml:"ssh_ca_key"`
+	SSHCertPrincipals   []string `yaml:"ssh_cert_principals"`
+	SSHCertValidity     string   `yaml:"ssh_cert_validity"`
+	SSHHostCertificates *bool    `yaml:"ssh_host_certificates"`
+	SSHHostCertValidity string   `yaml:"ssh_host_cert_validity"`
+
+	Bastion BastionConfig `yaml:"bastion"`
+}
+
+// ConfigFile represents the YAML configuration file structure.
+// Top-level settings form the implicit "default" profile; named profiles override them.
+type ConfigFile struct {
+	ProfileConfig `yaml:",inline"`
+
+	DefaultProfile string                   `yaml:"default_profile"`
+	Profiles       map[string]ProfileConfig `yaml:"profiles"`
 }
 
 // OpenStackConfig holds the OpenStack-specific configuration loaded from YAML file and environment variables.
 // This is provider-specific configuration for OpenStack. Future providers (AWS, GCP) will have
 // their own config types (e.g., AWSConfig, GCPConfig).
 type OpenStackConfig struct {
+	// Profile
+	ProfileName string // Name of the config file profile in use (default: "default")
+	CloudName   string // Name of the clouds.yaml cloud providing auth settings, empty if none
+
 	// Authentication
+	AuthType   string // Authentication method: "password", "v3applicationcredential" or "token" (default: "password")
 	AuthURL    string // OpenStack Keystone authentication URL
 	Username   string // OpenStack username
-	Password   string // OpenStack password (must come from env var)
+	Password   string // OpenStack password (resolved through the password provider chain, never from tins config)
 	DomainName string // OpenStack domain name (default: "default")
 
+	// Password sources
+	PasswordCommand string // Command whose stdout is the password
+	PasswordFile    string // File holding the password
+
+	// Application credential and token authentication
+	ApplicationCredentialID     string // Application credential ID
+	ApplicationCredentialName   string // Application credential name (requires Username)
+	ApplicationCredentialSecret string // Application credential secret (must come from env var)
+	Token                       string // Pre-issued Keystone token (must come from env var)
+
 	// Project/Tenant
 	ProjectID   string // OpenStack project ID
 	ProjectName string // OpenStack project name
@@ -49,9 +126,40 @@ type OpenStackConfig struct {
 	ImageName  string // Name of the image to use
 	FlavorName string // Instance flavor name (default: "m1.small")
 
+	// Volumes
+	BootVolumeSize int    // Size in GB of a volume to boot from instead of the flavor's disk (0: boot from the image)
+	VolumeType     string // Cinder volume type of created volumes (default: the cloud's default type)
+
 	// Network Configuration
 	NetworkName           string // Name of the network to attach to
 	NetworkAttachmentMode string // Network attachment mode (default: "existing_network")
+	FloatingIPPool        string // External network to allocate floating IPs from (floating_ip mode)
+
+	// Per-instance networks (new_network mode)
+	ExternalNetwork string   // External network the instance router is attached to
+	SubnetCIDR      string   // CIDR of the instance subnet (default: "192.168.42.0/24")
+	DNSNameservers  []string // DNS servers handed out on the instance subnet (optional)
+
+	SSHAllowedCIDR string // Source allowed to SSH into instances with a tins security group (this or PublicIPURL is required to open ports)
+	PublicIPURL    string // URL answering with your public IP, which SSH is then allowed from instead (optional)
+
+	// SSH Configuration
+	KeyType              string   // SSH key type for new instances (default: "ed25519")
+	EncryptKey           bool     // Encrypt instance private keys with a passphrase
+	KeyPassphraseCommand string   // Command whose stdout is the private key passphrase (prompts if empty)
+	SSHAgent             string   // ssh-agent mode: "off", "add" or "only" (default: "off")
+	SSHPublicKey         string   // Personal public key to use instead of generating one per instance (optional)
+	LoginUser            string   // Default user of the image, whose home --home mounts and whom SSH logs in as (default: "ubuntu")
+	AuthorizedKeys       []string // Extra public keys or key files allowed to log in to new instances (optional)
+
+	// SSH Certificate Authority
+	SSHCAKey            string   // CA private key that signs instance keys; enables CA mode (optional)
+	SSHCertPrincipals   []string // Users the signed certificates may log in as (default: root, ubuntu and LoginUser)
+	SSHCertValidity     string   // How long a user certificate stays valid (default: "1h")
+	SSHHostCertificates bool     // Also issue host certificates so host keys are verified against the CA
+	SSHHostCertValidity string   // How long a host certificate stays valid (default: "30d")
+
+	Bastion BastionConfig // Jump host that all SSH connections to instances go through (optional)
 }
 
 // findConfigFile looks for the config file in the following locations:
@@ -94,24 +202,148 @@ func loadConfigFromFile(filePath string) (*ConfigFile, error) {
 	return &config, nil
 }
 
+// profileFlag holds the value of the global --profile flag
+var profileFlag string
+
+// selectedProfileName returns the profile requested via --profile or TINS_PROFILE, or "" if none was requested
+func selectedProfileName() string {
+	if profileFlag != "" {
+		return profileFlag
+	}
+	return os.Getenv("TINS_PROFILE")
+}
+
+// resolveProfile returns the settings for the named profile layered over the top-level settings.
+// An empty name selects default_profile, falling back to the top-level settings alone.
+func (c *ConfigFile) resolveProfile(name string) (string, ProfileConfig, error) {
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return DefaultProfileName, c.ProfileConfig, nil
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		if name == DefaultProfileName {
+			return DefaultProfileName, c.ProfileConfig, nil
+		}
+		return "", ProfileConfig{}, fmt.Errorf("profile '%s' not found (available: %s)", name, strings.Join(c.profileNames(), ", "))
+	}
+
+	merged := c.ProfileConfig
+	merged.override(profile)
+	return name, merged, nil
+}
+
+// profileNames returns the sorted names of all profiles defined in the config file, including the implicit default
+func (c *ConfigFile) profileNames() []string {
+	names := []string{DefaultProfileName}
+	for name := range c.Profiles {
+		if name != DefaultProfileName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// override replaces settings with the non-empty values from other; bools override whenever they are set
+func (p *ProfileConfig) override(other ProfileConfig) {
+	overrideString(&p.Cloud, other.Cloud)
+	overrideString(&p.AuthType, other.AuthType)
+	overrideString(&p.AuthURL, other.AuthURL)
+	overrideString(&p.Username, other.Username)
+	overrideString(&p.DomainName, other.DomainName)
+	overrideString(&p.PasswordCommand, other.PasswordCommand)
+	overrideString(&p.PasswordFile, other.PasswordFile)
+	overrideString(&p.ApplicationCredentialID, other.ApplicationCredentialID)
+	overrideString(&p.ApplicationCredentialName, other.ApplicationCredentialName)
+	overrideString(&p.ProjectID, other.ProjectID)
+	overrideString(&p.ProjectName, other.ProjectName)
+	overrideString(&p.RegionName, other.RegionName)
+	overrideString(&p.AvailabilityZone, other.AvailabilityZone)
+	overrideString(&p.ImageName, other.ImageName)
+	overrideString(&p.FlavorName, other.FlavorName)
+	if other.BootVolumeSize != 0 {
+		p.BootVolumeSize = other.BootVolumeSize
+	}
+	overrideString(&p.VolumeType, other.VolumeType)
+	overrideString(&p.NetworkName, other.NetworkName)
+	overrideString(&p.NetworkAttachmentMode, other.NetworkAttachmentMode)
+	overrideString(&p.FloatingIPPool, other.FloatingIPPool)
+	overrideString(&p.ExternalNetwork, other.ExternalNetwork)
+	overrideString(&p.SubnetCIDR, other.SubnetCIDR)
+	if len(other.DNSNameservers) > 0 {
+		p.DNSNameservers = other.DNSNameservers
+	}
+	overrideString(&p.SSHAllowedCIDR, other.SSHAllowedCIDR)
+	overrideString(&p.PublicIPURL, other.PublicIPURL)
+	overrideString(&p.KeyType, other.KeyType)
+	overrideString(&p.KeyPassphraseCommand, other.KeyPassphraseCommand)
+	overrideString(&p.SSHAgent, other.SSHAgent)
+	overrideString(&p.SSHPublicKey, other.SSHPublicKey)
+	overrideString(&p.LoginUser, other.LoginUser)
+	overrideBool(&p.EncryptKey, other.EncryptKey)
+	if len(other.AuthorizedKeys) > 0 {
+		p.AuthorizedKeys = other.AuthorizedKeys
+	}
+	overrideString(&p.SSHCAKey, other.SSHCAKey)
+	if len(other.SSHCertPrincipals) > 0 {
+		p.SSHCertPrincipals = other.SSHCertPrincipals
+	}
+	overrideString(&p.SSHCertValidity, other.SSHCertValidity)
+	overrideBool(&p.SSHHostCertificates, other.SSHHostCertificates)
+	overrideString(&p.SSHHostCertValidity, other.SSHHostCertValidity)
+	p.Bastion.override(other.Bastion)
+}
+
+func overrideString(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
+
+// overrideBool replaces a bool setting that other sets, so an explicit false wins too
+func overrideBool(target **bool, value *bool) {
+	if value != nil {
+		*target = value
+	}
+}
+
 // LoadConfig loads OpenStack configuration from YAML file and environment variables.
 // Environment variables override values from the config file.
-// Password must be provided via OS_PASSWORD environment variable.
+// The password comes from OS_PASSWORD, the selected clouds.yaml cloud, password_command, password_file
+// or an interactive prompt, in that order (see resolvePassword).
+// With auth_type v3applicationcredential or token, OS_APPLICATION_CREDENTIAL_SECRET or OS_TOKEN is used instead.
 // Config file is searched in:
 //  1. .config/tint.yaml (current directory)
 //  2. ~/.config/tint/tint.yaml (home directory)
+//
+// The profile is chosen by --profile, then TINS_PROFILE, then default_profile in the config file.
 func LoadConfig() (*OpenStackConfig, error) {
-	config := &OpenStackConfig{}
+	config := &OpenStackConfig{ProfileName: DefaultProfileName}
+	requestedProfile := selectedProfileName()
 
 	// Try to load from config file
 	configFile, err := findConfigFile()
 	if err == nil {
-		fileConfig, err := loadConfigFromFile(configFile)
+		file, err := loadConfigFromFile(configFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load config file %s: %w", configFile, err)
 		}
+		profileName, fileConfig, err := file.resolveProfile(requestedProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config file %s: %w", configFile, err)
+		}
+		config.ProfileName = profileName
 		// Load non-sensitive values from file
+		config.AuthType = fileConfig.AuthType
 		config.AuthURL = fileConfig.AuthURL
+		config.PasswordCommand = fileConfig.PasswordCommand
+		config.PasswordFile = fileConfig.PasswordFile
+		config.ApplicationCredentialID = fileConfig.ApplicationCredentialID
+		config.ApplicationCredentialName = fileConfig.ApplicationCredentialName
 		config.Username = fileConfig.Username
 		config.DomainName = fileConfig.DomainName
 		config.ProjectID = fileConfig.ProjectID
@@ -120,11 +352,48 @@ func LoadConfig() (*OpenStackConfig, error) {
 		config.AvailabilityZone = fileConfig.AvailabilityZone
 		config.ImageName = fileConfig.ImageName
 		config.FlavorName = fileConfig.FlavorName
+		config.BootVolumeSize = fileConfig.BootVolumeSize
+		config.VolumeType = fileConfig.VolumeType
 		config.NetworkName = fileConfig.NetworkName
 		config.NetworkAttachmentMode = fileConfig.NetworkAttachmentMode
+		config.FloatingIPPool = fileConfig.FloatingIPPool
+		config.ExternalNetwork = fileConfig.ExternalNetwork
+		config.SubnetCIDR = fileConfig.SubnetCIDR
+		config.DNSNameservers = fileConfig.DNSNameservers
+		config.SSHAllowedCIDR = fileConfig.SSHAllowedCIDR
+		config.PublicIPURL = fileConfig.PublicIPURL
+		config.KeyType = fileConfig.KeyType
+		config.EncryptKey = fileConfig.EncryptKey != nil && *fileConfig.EncryptKey
+		config.KeyPassphraseCommand = fileConfig.KeyPassphraseCommand
+		config.SSHAgent = fileConfig.SSHAgent
+		config.SSHPublicKey = fileConfig.SSHPublicKey
+		config.LoginUser = fileConfig.LoginUser
+		config.AuthorizedKeys = fileConfig.AuthorizedKeys
+		config.SSHCAKey = fileConfig.SSHCAKey
+		config.SSHCertPrincipals = fileConfig.SSHCertPrincipals
+		config.SSHCertValidity = fileConfig.SSHCertValidity
+		config.SSHHostCertificates = fileConfig.SSHHostCertificates != nil && *fileConfig.SSHHostCertificates
+		config.SSHHostCertValidity = fileConfig.SSHHostCertValidity
+		config.Bastion = fileConfig.Bastion
+		config.CloudName = fileConfig.Cloud
+	} else if requestedProfile != "" && requestedProfile != DefaultProfileName {
+		return nil, fmt.Errorf("profile '%s' requested but no config file was found", requestedProfile)
+	}
+
+	// Auth settings from a clouds.yaml cloud replace those from the tins config file
+	config.CloudName = selectedCloudName(config.CloudName)
+	if config.CloudName != "" {
+		cloud, err := loadCloud(config.CloudName)
+		if err != nil {
+			return nil, err
+		}
+		cloud.applyTo(config)
 	}
 
 	// Environment variables override config file values
+	if authType := os.Getenv("OS_AUTH_TYPE"); authType != "" {
+		config.AuthType = authType
+	}
 	if authURL := os.Getenv("OS_AUTH_URL"); authURL != "" {
 		config.AuthURL = authURL
 	}
@@ -158,9 +427,33 @@ func LoadConfig() (*OpenStackConfig, error) {
 	if networkAttachmentMode := os.Getenv("OS_NETWORK_ATTACHMENT_MODE"); networkAttachmentMode != "" {
 		config.NetworkAttachmentMode = networkAttachmentMode
 	}
+	if floatingIPPool := os.Getenv("OS_FLOATING_IP_POOL"); floatingIPPool != "" {
+		config.FloatingIPPool = floatingIPPool
+	}
+	if externalNetwork := os.Getenv("OS_EXTERNAL_NETWORK"); externalNetwork != "" {
+		config.ExternalNetwork = externalNetwork
+	}
+
+	if applicationCredentialID := os.Getenv("OS_APPLICATION_CREDENTIAL_ID"); applicationCredentialID != "" {
+		config.ApplicationCredentialID = applicationCredentialID
+	}
+	if applicationCredentialName := os.Getenv("OS_APPLICATION_CREDENTIAL_NAME"); applicationCredentialName != "" {
+		config.ApplicationCredentialName = applicationCredentialName
+	}
+
+	// Secrets must come from environment variables (sensitive) unless the selected cloud provides them
+	if secret := os.Getenv("OS_APPLICATION_CREDENTIAL_SECRET"); secret != "" {
+		config.ApplicationCredentialSecret = secret
+	}
+	if token := os.Getenv("OS_TOKEN"); token != "" {
+		config.Token = token
+	}
 
-	// Password must come from environment variable (sensitive)
-	config.Password = getEnvRequired("OS_PASSWORD")
+	authType, err := normalizeAuthType(config.AuthType)
+	if err != nil {
+		return nil, err
+	}
+	config.AuthType = authType
 
 	// Set defaults for optional fields
 	if config.DomainName == "" {
@@ -170,21 +463,39 @@ func LoadConfig() (*OpenStackConfig, error) {
 		config.FlavorName = "m1.small"
 	}
 	if config.NetworkAttachmentMode == "" {
-		config.NetworkAttachmentMode = "existing_network"
+		config.NetworkAttachmentMode = NetworkModeExisting
+	}
+	if config.SubnetCIDR == "" {
+		config.SubnetCIDR = DefaultSubnetCIDR
+	}
+	if config.KeyType == "" {
+		config.KeyType = KeyTypeEd25519
+	}
+	if config.SSHAgent == "" {
+		config.SSHAgent = SSHAgentOff
+	}
+	if config.LoginUser == "" {
+		config.LoginUser = DefaultSSHConfigUser
+	}
+	if len(config.SSHCertPrincipals) == 0 {
+		config.SSHCertPrincipals = DefaultCertPrincipals
+		if !slices.Contains(config.SSHCertPrincipals, config.LoginUser) {
+			config.SSHCertPrincipals = append([]string{config.LoginUser}, DefaultCertPrincipals...)
+		}
+	}
+	if config.SSHCertValidity == "" {
+		config.SSHCertValidity = DefaultCertValidity
+	}
+	if config.SSHHostCertValidity == "" {
+		config.SSHHostCertValidity = DefaultHostCertValidity
 	}
 
 	// Validate required fields
 	if config.AuthURL == "" {
 		return nil, fmt.Errorf("OS_AUTH_URL is required (set in config file or environment variable)")
 	}
-	if config.Username == "" {
-		return nil, fmt.Errorf("OS_USERNAME is required (set in config file or environment variable)")
-	}
-	if config.ProjectID == "" {
-		return nil, fmt.Errorf("OS_PROJECT_ID is required (set in config file or environment variable)")
-	}
-	if config.ProjectName == "" {
-		return nil, fmt.Errorf("OS_PROJECT_NAME is required (set in config file or environment variable)")
+	if err := validateAuth(config); err != nil {
+		return nil, err
 	}
 	if config.RegionName == "" {
 		return nil, fmt.Errorf("OS_REGION_NAME is required (set in config file or environment variable)")
@@ -195,20 +506,122 @@ func LoadConfig() (*OpenStackConfig, error) {
 	if config.ImageName == "" {
 		return nil, fmt.Errorf("OS_IMAGE_NAME is required (set in config file or environment variable)")
 	}
-	if config.NetworkName == "" {
+	newNetwork := strings.EqualFold(config.NetworkAttachmentMode, NetworkModeNewNetwork)
+	if config.NetworkName == "" && !newNetwork {
 		return nil, fmt.Errorf("OS_NETWORK_NAME is required (set in config file or environment variable)")
 	}
+	if strings.EqualFold(config.NetworkAttachmentMode, NetworkModeFloatingIP) && config.FloatingIPPool == "" {
+		return nil, fmt.Errorf("floating_ip_pool is required for network_attachment_mode %s (or set OS_FLOATING_IP_POOL)", NetworkModeFloatingIP)
+	}
+	if newNetwork {
+		if config.ExternalNetwork == "" {
+			return nil, fmt.Errorf("external_network is required for network_attachment_mode %s (or set OS_EXTERNAL_NETWORK)", NetworkModeNewNetwork)
+		}
+		if err := validateSubnet(config.SubnetCIDR, config.DNSNameservers); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := parseKeyType(config.KeyType); err != nil {
+		return nil, fmt.Errorf("invalid key_type in config file: %w", err)
+	}
+	if _, err := parseSSHAgentMode(config.SSHAgent); err != nil {
+		return nil, fmt.Errorf("invalid ssh_agent in config file: %w", err)
+	}
+	if _, err := parseTTL(config.SSHCertValidity); err != nil {
+		return nil, fmt.Errorf("invalid ssh_cert_validity in config file: %w", err)
+	}
+	if _, err := parseTTL(config.SSHHostCertValidity); err != nil {
+		return nil, fmt.Errorf("invalid ssh_host_cert_validity in config file: %w", err)
+	}
+	if config.SSHHostCertificates && config.SSHCAKey == "" {
+		return nil, fmt.Errorf("ssh_host_certificates requires ssh_ca_key")
+	}
+	if config.BootVolumeSize < 0 {
+		return nil, fmt.Errorf("invalid boot_volume_size %d in config file", config.BootVolumeSize)
+	}
+	if strings.ContainsAny(config.LoginUser, " \t'\"/\\") {
+		return nil, fmt.Errorf("invalid login_user %q in config file", config.LoginUser)
+	}
+	if config.SSHAllowedCIDR != "" {
+		if _, _, err := net.ParseCIDR(config.SSHAllowedCIDR); err != nil {
+			return nil, fmt.Errorf("invalid ssh_allowed_cidr in config file: %w", err)
+		}
+	}
+	if config.PublicIPURL != "" && !strings.HasPrefix(config.PublicIPURL, "http://") && !strings.HasPrefix(config.PublicIPURL, "https://") {
+		return nil, fmt.Errorf("invalid public_ip_url in config file: must be an http or https URL")
+	}
+	if err := config.Bastion.validate(); err != nil {
+		return nil, fmt.Errorf("invalid bastion in config file: %w", err)
+	}
+
+	// Resolve the password last so an interactive prompt only appears once everything else is valid
+	if config.AuthType == AuthTypePassword {
+		password, err := resolvePassword(config)
+		if err != nil {
+			return nil, err
+		}
+		config.Password = password
+	}
 
 	return config, nil
 }
 
-func getEnvRequired(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		fmt.Fprintf(os.Stderr, "Error: Required environment variable %s is not set\n", key)
-		os.Exit(1)
+// normalizeAuthType maps the accepted auth_type spellings (including the openstack CLI ones) to an AuthType constant
+func normalizeAuthType(authType string) (string, error) {
+	switch strings.ToLower(authType) {
+	case "", "password", "v3password":
+		return AuthTypePassword, nil
+	case "v3applicationcredential", "applicationcredential", "application_credential":
+		return AuthTypeApplicationCredential, nil
+	case "token", "v3token":
+		return AuthTypeToken, nil
+	default:
+		return "", fmt.Errorf("unsupported auth_type '%s' (must be one of: password, v3applicationcredential, token)", authType)
 	}
-	return value
+}
+
+// validateAuth checks that the fields needed by the chosen authentication method are set
+func validateAuth(config *OpenStackConfig) error {
+	switch config.AuthType {
+	case AuthTypeApplicationCredential:
+		// The application credential is bound to a project, so no project settings are needed
+		if config.ApplicationCredentialSecret == "" {
+			return fmt.Errorf("OS_APPLICATION_CREDENTIAL_SECRET is required for application credential authentication")
+		}
+		if config.ApplicationCredentialID == "" && config.ApplicationCredentialName == "" {
+			return fmt.Errorf("OS_APPLICATION_CREDENTIAL_ID or OS_APPLICATION_CREDENTIAL_NAME is required for application credential authentication")
+		}
+		if config.ApplicationCredentialID == "" && config.Username == "" {
+			return fmt.Errorf("OS_USERNAME is required when using OS_APPLICATION_CREDENTIAL_NAME (set in config file or environment variable)")
+		}
+		return nil
+	case AuthTypeToken:
+		if config.Token == "" {
+			return fmt.Errorf("OS_TOKEN is required for token authentication")
+		}
+		if config.ProjectID == "" && config.ProjectName == "" {
+			return fmt.Errorf("OS_PROJECT_ID or OS_PROJECT_NAME is required for token authentication")
+		}
+		return nil
+	}
+
+	if config.Username == "" {
+		return fmt.Errorf("OS_USERNAME is required (set in config file or environment variable)")
+	}
+	if config.CloudName != "" {
+		// clouds.yaml may scope by project ID or project name
+		if config.ProjectID == "" && config.ProjectName == "" {
+			return fmt.Errorf("cloud '%s' must set auth.project_id or auth.project_name", config.CloudName)
+		}
+		return nil
+	}
+	if config.ProjectID == "" {
+		return fmt.Errorf("OS_PROJECT_ID is required (set in config file or environment variable)")
+	}
+	if config.ProjectName == "" {
+		return fmt.Errorf("OS_PROJECT_NAME is required (set in config file or environment variable)")
+	}
+	return nil
 }
 
 func getEnvWithDefault(key, defaultValue string) string {
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -225,6 +226,9 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	if config.NetworkAttachmentMode != "existing_network" {
 		t.Errorf("Expected default NetworkAttachmentMode 'existing_network', got '%s'", config.NetworkAttachmentMode)
 	}
+	if config.LoginUser != DefaultSSHConfigUser {
+		t.Errorf("Expected default LoginUser '%s', got '%s'", DefaultSSHConfigUser, config.LoginUser)
+	}
 }
 
 func TestLoadConfig_MissingRequired(t *testing.T) {
@@ -314,3 +318,257 @@ func TestGetEnvWithDefault(t *testing.T) {
 		t.Errorf("Expected 'default-value', got '%s'", result)
 	}
 }
+
+const profilesConfig = `auth_url: "https://shared.example.com/v3"
+username: "shared-user"
+project_id: "shared-project-id"
+project_name: "shared-project"
+region_name: "region-one"
+availability_zone: "az-one"
+image_name: "ubuntu-22.04"
+network_name: "shared-network"
+default_profile: "staging"
+profiles:
+  staging:
+    project_id: "staging-project-id"
+    project_name: "staging"
+  east:
+    auth_url: "https://east.example.com/v3"
+    region_name: "region-east"
+    availability_zone: "az-east"
+    flavor_name: "m1.large"
+`
+
+// writeProfilesConfig writes a profiles config file to .config/tint.yaml in a fresh working directory
+// and clears environment variables that would override it
+func writeProfilesConfig(t *testing.T, content string) {
+	t.Helper()
+	for _, key := range []string{"OS_AUTH_URL", "OS_USERNAME", "OS_DOMAIN_NAME", "OS_PROJECT_ID", "OS_PROJECT_NAME",
+		"OS_REGION_NAME", "OS_AVAILABILITY_ZONE", "OS_IMAGE_NAME", "OS_FLAVOR_NAME", "OS_NETWORK_NAME",
+		"OS_NETWORK_ATTACHMENT_MODE", "TINS_PROFILE", "OS_CLOUD", "OS_AUTH_TYPE"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("OS_PASSWORD", "test-password")
+	t.Setenv("HOME", t.TempDir())
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".config"), 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".config", "tint.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Chdir(dir)
+
+	profileFlag = ""
+	t.Cleanup(func() { profileFlag = "" })
+}
+
+func TestLoadConfig_Profiles(t *testing.T) {
+	writeProfilesConfig(t, profilesConfig)
+
+	// default_profile is used when nothing else is requested
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.ProfileName != "staging" {
+		t.Errorf("Expected profile 'staging', got '%s'", config.ProfileName)
+	}
+	if config.ProjectID != "staging-project-id" || config.ProjectName != "staging" {
+		t.Errorf("Expected staging project, got '%s' (%s)", config.ProjectName, config.ProjectID)
+	}
+	if config.AuthURL != "https://shared.example.com/v3" || config.ImageName != "ubuntu-22.04" {
+		t.Errorf("Expected top-level settings to be inherited, got auth_url '%s' image '%s'", config.AuthURL, config.ImageName)
+	}
+
+	// TINS_PROFILE overrides default_profile
+	t.Setenv("TINS_PROFILE", "east")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.ProfileName != "east" || config.RegionName != "region-east" || config.FlavorName != "m1.large" {
+		t.Errorf("Expected east profile, got profile '%s' region '%s' flavor '%s'", config.ProfileName, config.RegionName, config.FlavorName)
+	}
+	if config.ProjectID != "shared-project-id" {
+		t.Errorf("Expected top-level project ID, got '%s'", config.ProjectID)
+	}
+
+	// --profile overrides TINS_PROFILE; "default" selects the top-level settings
+	profileFlag = DefaultProfileName
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.ProfileName != DefaultProfileName || config.RegionName != "region-one" || config.ProjectID != "shared-project-id" {
+		t.Errorf("Expected default profile, got profile '%s' region '%s' project '%s'", config.ProfileName, config.RegionName, config.ProjectID)
+	}
+
+	// Environment variables still override profile values
+	profileFlag = "east"
+	t.Setenv("OS_REGION_NAME", "region-override")
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.RegionName != "region-override" {
+		t.Errorf("Expected environment override, got region '%s'", config.RegionName)
+	}
+}
+
+func TestLoadConfig_UnknownProfile(t *testing.T) {
+	writeProfilesConfig(t, profilesConfig)
+	profileFlag = "missing"
+
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("Expected error for unknown profile")
+	}
+	if !strings.Contains(err.Error(), "profile 'missing' not found") || !strings.Contains(err.Error(), "default, east, staging") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestLoadConfig_ProfileBoolOverride(t *testing.T) {
+	writeProfilesConfig(t, `auth_url: "https://shared.example.com/v3"
+username: "shared-user"
+project_id: "shared-project-id"
+project_name: "shared"
+region_name: "region-one"
+availability_zone: "az-one"
+image_name: "ubuntu-22.04"
+network_name: "shared-network"
+encrypt_key: true
+profiles:
+  plain:
+    encrypt_key: false
+  inherit:
+    flavor_name: "m1.large"
+`)
+
+	// An explicit false in a profile turns off a top-level true
+	profileFlag = "plain"
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.EncryptKey {
+		t.Error("Expected encrypt_key: false in the profile to override the top-level true")
+	}
+
+	profileFlag = "inherit"
+	config, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if !config.EncryptKey {
+		t.Error("Expected a profile without encrypt_key to inherit the top-level true")
+	}
+}
+
+func TestLoadConfig_FlatConfigIsDefaultProfile(t *testing.T) {
+	writeProfilesConfig(t, `auth_url: "https://flat.example.com/v3"
+username: "flat-user"
+project_id: "flat-project-id"
+project_name: "flat-project"
+region_name: "flat-region"
+availability_zone: "flat-az"
+image_name: "flat-image"
+network_name: "flat-network"
+`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.ProfileName != DefaultProfileName || config.AuthURL != "https://flat.example.com/v3" {
+		t.Errorf("Expected flat config as default profile, got profile '%s' auth_url '%s'", config.ProfileName, config.AuthURL)
+	}
+
+	profileFlag = "east"
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error when requesting a profile that a flat config does not define")
+	}
+}
+
+func TestLoadConfig_AuthTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "application credential by ID needs no password or project",
+			env: map[string]string{
+				"OS_AUTH_TYPE":                     "v3applicationcredential",
+				"OS_APPLICATION_CREDENTIAL_ID":     "cred-id",
+				"OS_APPLICATION_CREDENTIAL_SECRET": "cred-secret",
+				"OS_USERNAME":                      "",
+				"OS_PASSWORD":                      "",
+				"OS_PROJECT_ID":                    "",
+				"OS_PROJECT_NAME":                  "",
+			},
+		},
+		{
+			name: "application credential without secret",
+			env: map[string]string{
+				"OS_AUTH_TYPE":                 "v3applicationcredential",
+				"OS_APPLICATION_CREDENTIAL_ID": "cred-id",
+			},
+			wantErr: "OS_APPLICATION_CREDENTIAL_SECRET is required",
+		},
+		{
+			name: "application credential by name needs a username",
+			env: map[string]string{
+				"OS_AUTH_TYPE":                     "v3applicationcredential",
+				"OS_APPLICATION_CREDENTIAL_NAME":   "cred-name",
+				"OS_APPLICATION_CREDENTIAL_SECRET": "cred-secret",
+				"OS_USERNAME":                      "",
+			},
+			wantErr: "OS_USERNAME is required",
+		},
+		{
+			name: "token needs no username or password",
+			env: map[string]string{
+				"OS_AUTH_TYPE": "v3token",
+				"OS_TOKEN":     "token-value",
+				"OS_USERNAME":  "",
+				"OS_PASSWORD":  "",
+			},
+		},
+		{
+			name:    "token without token",
+			env:     map[string]string{"OS_AUTH_TYPE": "token"},
+			wantErr: "OS_TOKEN is required",
+		},
+		{
+			name:    "unknown auth type",
+			env:     map[string]string{"OS_AUTH_TYPE": "kerberos"},
+			wantErr: "unsupported auth_type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestConfigEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			config, err := LoadConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig failed: %v", err)
+			}
+			if config.AuthType == AuthTypePassword {
+				t.Errorf("Expected a non-password auth type, got '%s'", config.AuthType)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+// errSelectionCancelled is returned when the user leaves the instance picker without choosing
+var errSelectionCancelled = errors.New("selection cancelled")
+
+var connectCmd = &cobra.Command{
+	Use:   "connect [instance-name-or-id]",
+	Short: "Connect to a temporary instance via SSH",
+	Long:  "Connect to an ephemeral OpenStack instance via SSH using its generated key. If no instance is given, an interactive menu of all tins instances is shown.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sshUser, _ := cmd.Flags().GetString("user")
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		var instance *Instance
+		if len(args) > 0 {
+			instance, err = findInstance(ctx, client, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to find instance: %w", err)
+			}
+		} else {
+			instances, err := client.ListInstances(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list instances: %w", err)
+			}
+			if len(instances) == 0 {
+				fmt.Println("No temporary instances found.")
+				return nil
+			}
+
+			instance, err = selectInstance(instances)
+			if errors.Is(err, errSelectionCancelled) {
+				fmt.Println("Cancelled.")
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to select instance: %w", err)
+			}
+		}
+
+		target, err := sshTargetForInstance(instance, sshUser, config)
+		if err != nil {
+			return err
+		}
+
+		if target.Bastion != nil {
+			fmt.Printf("Connecting to %s (%s) as %s via %s...\n", instance.Name, target.Host, target.User, config.Bastion.ProxyJump())
+		} else {
+			fmt.Printf("Connecting to %s (%s) as %s...\n", instance.Name, target.Host, target.User)
+		}
+		exitCode, err := runInteractiveShell(target)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			// Pass the remote exit code through rather than wrapping it in an error
+			os.Exit(exitCode)
+		}
+
+		return nil
+	},
+}
+
+// sshTargetForInstance builds the SSH target for an instance using its IP and per-instance key.
+// An empty sshUser logs in as login_user.
+func sshTargetForInstance(instance *Instance, sshUser string, config *OpenStackConfig) (SSHTarget, error) {
+	instanceIP := instance.IP()
+	if instanceIP == "" {
+		return SSHTarget{}, fmt.Errorf("instance %s has no IP address (status: %s)", instance.Name, instance.Status)
+	}
+
+	var keyPath string
+	if _, ok := instance.Metadata[KeypairTag]; ok {
+		// Instances created with a personal key use its private key next to ssh_public_key, or any ssh-agent key
+		if config.SSHPublicKey != "" {
+			keyPath = strings.TrimSuffix(expandHome(config.SSHPublicKey), ".pub")
+		}
+	} else {
+		// Keys kept only in ssh-agent have no private key file, just the public key
+		keyPath = GetSSHKeyPath(shortInstanceName(instance.Name))
+		if _, err := os.Stat(keyPath); err != nil {
+			if _, pubErr := os.Stat(keyPath + ".pub"); pubErr != nil {
+				return SSHTarget{}, fmt.Errorf("SSH key for %s not found at %s: %w", instance.Name, keyPath, err)
+			}
+		}
+	}
+
+	// Instances booted in SSH CA mode only accept the key with a valid certificate
+	if _, ok := instance.Metadata[SSHCATag]; ok && instance.Metadata[KeypairTag] == "" {
+		if err := renewUserCertificate(config, keyPath, instance.Name); err != nil {
+			return SSHTarget{}, fmt.Errorf("failed to renew SSH certificate for %s: %w", instance.Name, err)
+		}
+	}
+
+	if sshUser == "" {
+		sshUser = config.LoginUser
+	}
+	target := SSHTarget{
+		User:    sshUser,
+		Host:    instanceIP,
+		Port:    DefaultSSHPort,
+		KeyPath: keyPath,
+		Passphrase: func() ([]byte, error) {
+			return keyPassphrase(config.KeyPassphraseCommand, false)
+		},
+		Bastion: bastionTarget(config),
+	}
+
+	// A CA-signed host certificate makes the host key verifiable without trusting it on first use
+	fingerprint, hasHostCert := instance.Metadata[HostCertTag]
+	if hasHostCert && config.SSHCAKey == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s has a CA-signed host certificate but no ssh_ca_key is configured to verify it\n", instance.Name)
+		hasHostCert = false
+	}
+	if hasHostCert {
+		caKey, err := caPublicKey(config)
+		if err != nil {
+			return SSHTarget{}, err
+		}
+		if ssh.FingerprintSHA256(caKey) != fingerprint {
+			return SSHTarget{}, fmt.Errorf("host certificate of %s was signed by CA %s, but ssh_ca_key is %s", instance.Name, fingerprint, ssh.FingerprintSHA256(caKey))
+		}
+		target.HostKeyCallback = hostCertificateCallback(caKey, instance.Name)
+		return target, nil
+	}
+
+	// Otherwise use the host keys recorded from the console log when the instance was created
+	callback, algorithms, err := instanceHostKeyCallback(instance.Name)
+	if err != nil {
+		return SSHTarget{}, err
+	}
+	if callback == nil {
+		// Nothing was recorded, e.g. the console log never showed the keys; record them under the instance name now
+		callback = trustOnFirstUseCallback(instance.Name)
+	}
+	target.HostKeyCallback = callback
+	target.HostKeyAlgorithms = algorithms
+
+	return target, nil
+}
+
+// selectInstance shows an interactive arrow-key menu and returns the chosen instance.
+// Returns errSelectionCancelled if the user presses Esc or Ctrl+C.
+func selectInstance(instances []Instance) (*Instance, error) {
+	if err := termbox.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize terminal: %w", err)
+	}
+	defer termbox.Close()
+
+	selected := 0
+	for {
+		if err := drawInstanceMenu(instances, selected); err != nil {
+			return nil, err
+		}
+
+		switch ev := termbox.PollEvent(); ev.Type {
+		case termbox.EventKey:
+			switch {
+			case ev.Key == termbox.KeyArrowUp || ev.Ch == 'k':
+				if selected > 0 {
+					selected--
+				}
+			case ev.Key == termbox.KeyArrowDown || ev.Ch == 'j':
+				if selected < len(instances)-1 {
+					selected++
+				}
+			case ev.Key == termbox.KeyEnter:
+				return &instances[selected], nil
+			case ev.Key == termbox.KeyEsc || ev.Key == termbox.KeyCtrlC:
+				return nil, errSelectionCancelled
+			}
+		case termbox.EventError:
+			return nil, fmt.Errorf("terminal error: %w", ev.Err)
+		}
+	}
+}
+
+// drawInstanceMenu renders the instance list with the selected row highlighted
+func drawInstanceMenu(instances []Instance, selected int) error {
+	if err := termbox.Clear(termbox.ColorDefault, termbox.ColorDefault); err != nil {
+		return fmt.Errorf("failed to clear terminal: %w", err)
+	}
+
+	drawText(0, 0, "Select an instance (↑/↓ to move, Enter to connect, Esc to cancel)", termbox.AttrBold, termbox.ColorDefault)
+
+	for i := range instances {
+		fg, bg := termbox.ColorDefault, termbox.ColorDefault
+		marker := "  "
+		if i == selected {
+			fg = termbox.ColorDefault | termbox.AttrReverse
+			marker = "> "
+		}
+
+		ip := instances[i].IP()
+		if ip == "" {
+			ip = "-"
+		}
+		line := fmt.Sprintf("%s%-40s %-10s %s", marker, instances[i].Name, instances[i].Status, ip)
+		drawText(0, i+2, line, fg, bg)
+	}
+
+	return termbox.Flush()
+}
+
+// drawText writes a single line of text at the given position
+func drawText(x, y int, text string, fg, bg termbox.Attribute) {
+	for _, ch := range text {
+		termbox.SetCell(x, y, ch, fg, bg)
+		x++
+	}
+}
+
+func init() {
+	connectCmd.Flags().String("user", "", "SSH user to connect as (default: login_user from the config file)")
+	rootCmd.AddCommand(connectCmd)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -84,16 +86,84 @@ func generateInstanceName() (string, error) {
 	return fmt.Sprintf("%s-%s", adjective, noun), nil
 }
 
+// createRollback records what create has set up for an instance so that all of it can be removed again
+// when the instance itself cannot be created
+type createRollback struct {
+	instanceName  string
+	generatedKey  bool
+	volumes       []Volume
+	network       bool
+	securityGroup bool
+}
+
+// run removes everything recorded, warning about but otherwise ignoring failures.
+// A personal key and its shared keypair are never recorded and so are left alone.
+func (r *createRollback) run(ctx context.Context, client Provider, out io.Writer) {
+	fullInstanceName := fmt.Sprintf("%s%s", InstanceNamePrefix, r.instanceName)
+	if r.network {
+		if err := client.DeleteInstanceNetwork(ctx, fullInstanceName); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to clean up instance network: %v\n", err)
+		}
+	}
+	if r.securityGroup {
+		if err := client.DeleteSecurityGroup(ctx, fullInstanceName); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to clean up security group: %v\n", err)
+		}
+	}
+	deleteVolumes(ctx, client, r.volumes, out)
+	if r.generatedKey {
+		if err := DeleteSSHKey(r.instanceName); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to clean up SSH key: %v\n", err)
+		}
+		if _, err := removeKeyFromAgent(fullInstanceName); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to remove SSH key from ssh-agent: %v\n", err)
+		}
+	}
+}
+
 var createCmd = &cobra.Command{
 	Use:   "create [instance-name]",
 	Short: "Create a new temporary instance",
 	Long:  "Create a new ephemeral OpenStack instance with automatic SSH key generation. If instance-name is not provided, a random Docker-style two-word name (adjective-noun) will be generated. Optionally provide a user-data file for custom instance provisioning.",
 	Args:  cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		out := progressWriter(format)
+
 		// Get user_data file path from flag
 		userDataFile, _ := cmd.Flags().GetString("user-data")
+		ttlValue, _ := cmd.Flags().GetString("ttl")
+		keyTypeValue, _ := cmd.Flags().GetString("key-type")
+		encryptKey, _ := cmd.Flags().GetBool("encrypt-key")
+		agentValue, _ := cmd.Flags().GetString("ssh-agent")
+		sshPublicKeyPath, _ := cmd.Flags().GetString("ssh-public-key")
+		authorizeEntries, _ := cmd.Flags().GetStringArray("authorize")
+		openPortValues, _ := cmd.Flags().GetStringArray("open-port")
+		bootVolumeSize, _ := cmd.Flags().GetInt("boot-volume-size")
+		volumeType, _ := cmd.Flags().GetString("volume-type")
+		volumeValues, _ := cmd.Flags().GetStringArray("volume")
+		withHome, _ := cmd.Flags().GetBool("home")
+		fromSnapshot, _ := cmd.Flags().GetString("from-snapshot")
+		var dataVolumes []DataVolume
+		for _, value := range volumeValues {
+			volume, err := parseDataVolume(value)
+			if err != nil {
+				return fmt.Errorf("invalid --volume: %w", err)
+			}
+			dataVolumes = append(dataVolumes, volume)
+		}
+		var openPorts []PortRule
+		for _, value := range openPortValues {
+			rule, err := parsePortRule(value)
+			if err != nil {
+				return fmt.Errorf("invalid --open-port: %w", err)
+			}
+			openPorts = append(openPorts, rule)
+		}
 		var instanceName string
-		var err error
 
 		if len(args) > 0 && args[0] != "" {
 			instanceName = args[0]
@@ -103,31 +173,100 @@ var createCmd = &cobra.Command{
 			if err != nil {
 				return fmt.Errorf("failed to generate instance name: %w", err)
 			}
-			fmt.Printf("Generated instance name: %s\n", instanceName)
+			fmt.Fprintf(out, "Generated instance name: %s\n", instanceName)
 		}
 
 		fullInstanceName := fmt.Sprintf("%s%s", InstanceNamePrefix, instanceName)
 
+		// Record an expiry time if a TTL was requested
+		metadata := map[string]string{}
+		var ttl time.Duration
+		if ttlValue != "" {
+			ttl, err = parseTTL(ttlValue)
+			if err != nil {
+				return fmt.Errorf("invalid --ttl: %w", err)
+			}
+			metadata[ExpiresAtTag] = formatExpiresAt(time.Now().Add(ttl))
+		}
+
 		// Load configuration
 		config, err := LoadConfig()
 		if err != nil {
 			return err
 		}
 
-		// Create OpenStack client
-		ctx := context.Background()
-		client, err := NewOpenStackClient(ctx, config)
+		// The --key-type flag overrides key_type from the config file
+		if keyTypeValue == "" {
+			keyTypeValue = config.KeyType
+		}
+		keySpec, err := parseKeyType(keyTypeValue)
 		if err != nil {
-			return fmt.Errorf("failed to create OpenStack client: %w", err)
+			return fmt.Errorf("invalid key type: %w", err)
 		}
 
-		// Generate SSH key pair
-		fmt.Printf("Generating SSH key pair for %s...\n", fullInstanceName)
-		keyPair, err := GenerateSSHKey(instanceName)
+		networkMode, err := parseNetworkAttachmentMode(config.NetworkAttachmentMode)
 		if err != nil {
-			return fmt.Errorf("failed to generate SSH key: %w", err)
+			return fmt.Errorf("invalid network_attachment_mode: %w", err)
+		}
+
+		// --boot-volume-size and --volume-type override boot_volume_size and volume_type from the config file
+		if bootVolumeSize == 0 {
+			bootVolumeSize = config.BootVolumeSize
+		}
+		if bootVolumeSize < 0 {
+			return fmt.Errorf("invalid --boot-volume-size %d", bootVolumeSize)
+		}
+		if volumeType != "" && bootVolumeSize == 0 && len(dataVolumes) == 0 {
+			return fmt.Errorf("--volume-type requires --boot-volume-size, boot_volume_size or --volume")
+		}
+		if volumeType == "" {
+			volumeType = config.VolumeType
+		}
+		for i := range dataVolumes {
+			if dataVolumes[i].VolumeType == "" {
+				dataVolumes[i].VolumeType = volumeType
+			}
+		}
+
+		// Opened ports go into a security group of the instance's own, together with SSH from the caller
+		var groupRules []PortRule
+		if len(openPorts) > 0 {
+			groupRules, err = securityGroupRules(config, openPorts)
+			if err != nil {
+				return err
+			}
+		}
+
+		// A personal public key replaces the generated per-instance key
+		if sshPublicKeyPath == "" {
+			sshPublicKeyPath = config.SSHPublicKey
+		}
+		var sharedKeypair, sharedPublicKey string
+		keyStorage := KeyStorage{AgentLifetime: ttl}
+		if sshPublicKeyPath != "" {
+			publicKey, authorizedKey, err := loadPublicKey(sshPublicKeyPath)
+			if err != nil {
+				return err
+			}
+			sharedKeypair = sharedKeypairName(publicKey)
+			sharedPublicKey = authorizedKey
+			metadata[KeypairTag] = sharedKeypair
+		} else {
+			// Decide how the private key is stored; the agent keeps it only as long as the instance lives
+			if agentValue == "" {
+				agentValue = config.SSHAgent
+			}
+			keyStorage.Agent, err = parseSSHAgentMode(agentValue)
+			if err != nil {
+				return err
+			}
+			if (encryptKey || config.EncryptKey) && keyStorage.Agent != SSHAgentOnly {
+				keyStorage.Passphrase, err = keyPassphrase(config.KeyPassphraseCommand, true)
+				if err != nil {
+					return err
+				}
+			}
 		}
-		fmt.Printf("SSH key pair created: %s\n", keyPair.PrivateKeyPath)
 
 		// Read user_data file if provided
 		var userData []byte
@@ -137,83 +276,357 @@ var createCmd = &cobra.Command{
 				return fmt.Errorf("failed to read user-data file: %w", err)
 			}
 			userData = data
-			fmt.Printf("Loaded user-data from: %s\n", userDataFile)
+			fmt.Fprintf(out, "Loaded user-data from: %s\n", userDataFile)
 		}
 
-		// Create instance
-		fmt.Printf("Creating instance %s...\n", fullInstanceName)
-		server, err := client.CreateInstance(ctx, fullInstanceName, keyPair.PublicKey, userData)
+		// Team keys from authorized_keys and --authorize are added to the boot configuration
+		cloudConfig := map[string]interface{}{}
+		authorizedKeys, err := resolveAuthorizedKeys(append(append([]string{}, config.AuthorizedKeys...), authorizeEntries...))
+		if err != nil {
+			return err
+		}
+		if len(authorizedKeys) > 0 {
+			cloudConfig["ssh_authorized_keys"] = authorizedKeys
+			fmt.Fprintf(out, "Authorizing %d additional SSH key(s)\n", len(authorizedKeys))
+		}
+
+		// In SSH CA mode the instance trusts certificates signed by the CA instead of a per-instance keypair
+		ca, releaseCA, err := loadCertificateAuthority(config)
+		if err != nil {
+			return err
+		}
+		defer releaseCA()
+		if ca != nil {
+			fmt.Fprintf(out, "Using SSH CA %s\n", ca.Fingerprint())
+			for key, value := range userCACloudConfig(ca.Signer.PublicKey()) {
+				cloudConfig[key] = value
+			}
+			metadata[SSHCATag] = ca.Fingerprint()
+			keyStorage.CA = ca
+
+			if config.SSHHostCertificates {
+				hostConfig, err := hostCertificateCloudConfig(ca, []string{fullInstanceName})
+				if err != nil {
+					return err
+				}
+				for key, value := range hostConfig {
+					cloudConfig[key] = value
+				}
+				metadata[HostCertTag] = ca.Fingerprint()
+				if ttl > ca.HostValidity {
+					fmt.Fprintf(out, "Warning: The host certificate expires after %s (ssh_host_cert_validity), before the instance's --ttl of %s\n", ca.HostValidity, ttl)
+				}
+			}
+		}
+
+		if len(cloudConfig) > 0 {
+			userData, err = mergeCloudConfig(userData, cloudConfig)
+			if err != nil {
+				return fmt.Errorf("failed to add SSH settings to user-data: %w", err)
+			}
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		// Everything set up from here on is removed again unless the instance gets created
+		rollback := &createRollback{instanceName: instanceName}
+		defer func() {
+			if rollback != nil {
+				rollback.run(ctx, client, out)
+			}
+		}()
+
+		// A snapshot replaces the configured image; it is booted by name like any other image
+		if fromSnapshot != "" {
+			snapshot, err := findSnapshot(ctx, client, fromSnapshot)
+			if err != nil {
+				return err
+			}
+			if snapshot.Status != "active" {
+				return fmt.Errorf("snapshot '%s' is not active (status: %s)", snapshot.Name, snapshot.Status)
+			}
+			fmt.Fprintf(out, "Booting from snapshot %s of %s\n", snapshot.Name, valueOrDash(snapshot.SourceInstance))
+		}
+
+		// The home volume must exist and be free; it is never attached to two instances at once
+		var homeVolume *Volume
+		if withHome {
+			name, err := homeVolumeName()
+			if err != nil {
+				return err
+			}
+			homeVolume, err = findHomeVolume(ctx, client, name)
+			if err != nil {
+				return err
+			}
+			user, err := homeVolumeUser(ctx, client, homeVolume)
+			if err != nil {
+				return err
+			}
+			if user != "" {
+				return fmt.Errorf("home volume %s is already in use by %s", homeVolume.Name, user)
+			}
+			metadata[HomeVolumeTag] = homeVolume.Name
+		}
+
+		spec := InstanceSpec{
+			Name:     fullInstanceName,
+			Metadata: metadata,
+			UserData: userData,
+		}
+		spec.ImageName = fromSnapshot
+		if bootVolumeSize > 0 {
+			spec.BootVolumeSize = bootVolumeSize
+			spec.VolumeType = volumeType
+			metadata[BootVolumeTag] = volumeDescription(bootVolumeSize, volumeType)
+		}
+		var privateKeyPath string
+		if sharedKeypair != "" {
+			// Reuse one keypair for every instance created with this key
+			fmt.Fprintf(out, "Using SSH public key %s (keypair %s)\n", sshPublicKeyPath, sharedKeypair)
+			if err := client.EnsureKeypair(ctx, sharedKeypair, sharedPublicKey); err != nil {
+				return fmt.Errorf("failed to import SSH public key: %w", err)
+			}
+			spec.KeyName = sharedKeypair
+			if _, err := os.Stat(strings.TrimSuffix(expandHome(sshPublicKeyPath), ".pub")); err == nil {
+				privateKeyPath = strings.TrimSuffix(expandHome(sshPublicKeyPath), ".pub")
+			}
+		} else {
+			// Generate SSH key pair
+			fmt.Fprintf(out, "Generating %s SSH key pair for %s...\n", keySpec, fullInstanceName)
+			rollback.generatedKey = true
+			keyPair, err := GenerateSSHKey(instanceName, keySpec, keyStorage)
+			if err != nil {
+				return fmt.Errorf("failed to generate SSH key: %w", err)
+			}
+			if keyStorage.Agent != SSHAgentOnly {
+				fmt.Fprintf(out, "SSH key pair created: %s\n", keyPair.PrivateKeyPath)
+				privateKeyPath = keyPair.PrivateKeyPath
+			}
+			if keyStorage.Agent != SSHAgentOff {
+				fmt.Fprintf(out, "SSH key added to ssh-agent\n")
+			}
+			if ca != nil {
+				// The certificate replaces the keypair, so only CA-signed keys can log in
+				fmt.Fprintf(out, "SSH certificate created: %s (valid for %s)\n", certificatePath(keyPair.PrivateKeyPath), ca.Validity)
+			} else {
+				spec.PublicKey = keyPair.PublicKey
+			}
+		}
+
+		// Data volumes are created up front so cloud-init can be told which disks to mount.
+		// They are attached once the instance is active.
+		volumes, err := createDataVolumes(ctx, client, fullInstanceName, dataVolumes, out)
 		if err != nil {
-			// Clean up SSH keys on failure
-			if deleteErr := DeleteSSHKey(instanceName); deleteErr != nil {
-				// Log but don't fail on cleanup error
-				fmt.Printf("Warning: Failed to clean up SSH key: %v\n", deleteErr)
+			return fmt.Errorf("failed to create volume: %w", err)
+		}
+		rollback.volumes = volumes
+		var mounts []volumeMount
+		for i, volume := range volumes {
+			if dataVolumes[i].MountPoint != "" {
+				mounts = append(mounts, volumeMount{VolumeID: volume.ID, MountPoint: dataVolumes[i].MountPoint})
+			}
+		}
+		if homeVolume != nil {
+			mounts = append(mounts, volumeMount{VolumeID: homeVolume.ID, MountPoint: homeMountPoint(config.LoginUser), Owner: config.LoginUser})
+		}
+		if len(mounts) > 0 {
+			spec.UserData, err = mergeCloudConfig(spec.UserData, volumeMountCloudConfig(mounts))
+			if err != nil {
+				return fmt.Errorf("failed to add volume mounts to user-data: %w", err)
+			}
+		}
+
+		// In new_network mode the instance boots on a network of its own
+		if networkMode == NetworkModeNewNetwork {
+			fmt.Fprintf(out, "Creating network %s (%s) with a router to %s...\n", fullInstanceName, config.SubnetCIDR, config.ExternalNetwork)
+			networkSpec := NetworkSpec{
+				Name:            fullInstanceName,
+				CIDR:            config.SubnetCIDR,
+				DNSNameservers:  config.DNSNameservers,
+				ExternalNetwork: config.ExternalNetwork,
 			}
+			spec.NetworkID, err = client.CreateInstanceNetwork(ctx, networkSpec)
+			if err != nil {
+				return fmt.Errorf("failed to create instance network: %w", err)
+			}
+			rollback.network = true
+			metadata[NetworkTag] = spec.NetworkID
+		}
+
+		if len(groupRules) > 0 {
+			fmt.Fprintf(out, "Creating security group %s...\n", fullInstanceName)
+			for _, rule := range groupRules {
+				fmt.Fprintf(out, "  Allow %s\n", rule)
+			}
+			if err := client.CreateSecurityGroup(ctx, fullInstanceName, groupRules); err != nil {
+				return fmt.Errorf("failed to create security group: %w", err)
+			}
+			rollback.securityGroup = true
+			// Like 'tins ports open', the group is added to the project default rather than replacing it
+			spec.SecurityGroups = []string{defaultSecurityGroup, fullInstanceName}
+			metadata[SecurityGroupTag] = fullInstanceName
+		}
+
+		// Create instance
+		fmt.Fprintf(out, "Creating instance %s...\n", fullInstanceName)
+		instance, err := client.CreateInstance(ctx, spec)
+		if err != nil {
 			return fmt.Errorf("failed to create instance: %w", err)
 		}
+		// From here on terminate cleans up after the instance
+		rollback = nil
 
-		fmt.Printf("Instance created successfully!\n")
-		fmt.Printf("  ID: %s\n", server.ID)
-		fmt.Printf("  Name: %s\n", server.Name)
-		fmt.Printf("  Status: %s\n", server.Status)
+		fmt.Fprintf(out, "Instance created successfully!\n")
+		fmt.Fprintf(out, "  ID: %s\n", instance.ID)
+		fmt.Fprintf(out, "  Name: %s\n", instance.Name)
+		fmt.Fprintf(out, "  Status: %s\n", instance.Status)
+		if expiresAt, ok := metadata[ExpiresAtTag]; ok {
+			fmt.Fprintf(out, "  Expires: %s\n", expiresAt)
+		}
 
 		// Wait for instance to become active
-		fmt.Printf("Waiting for instance to become active...\n")
+		fmt.Fprintf(out, "Waiting for instance to become active...\n")
 		timeout := 5 * time.Minute
-		if err := client.WaitForInstanceActive(ctx, server.ID, timeout); err != nil {
-			fmt.Printf("Warning: Instance may not be ready yet: %v\n", err)
+		active := false
+		if err := client.WaitForInstanceActive(ctx, instance.ID, timeout); err != nil {
+			fmt.Fprintf(out, "Warning: Instance may not be ready yet: %v\n", err)
 		} else {
-			fmt.Printf("Instance is now ACTIVE\n")
+			fmt.Fprintf(out, "Instance is now ACTIVE\n")
+			active = true
+		}
+
+		// In floating_ip and new_network mode the instance gets a public address once it is active and its port exists
+		var floatingIP *FloatingIP
+		pool := floatingIPPool(config)
+		if networkMode == NetworkModeFloatingIP || networkMode == NetworkModeNewNetwork {
+			if !active {
+				fmt.Fprintf(out, "Warning: Instance is not active, no floating IP allocated\n")
+			} else {
+				fmt.Fprintf(out, "Allocating floating IP from %s...\n", pool)
+				floatingIP, err = attachFloatingIP(ctx, client, instance, pool)
+				if err != nil {
+					fmt.Fprintf(out, "Warning: Failed to allocate floating IP: %v\n", err)
+				} else {
+					fmt.Fprintf(out, "Floating IP %s associated\n", floatingIP.Address)
+				}
+			}
 		}
 
-		// Get updated server info to show IP addresses
+		if len(volumes) > 0 {
+			if active {
+				attachDataVolumes(ctx, client, instance, volumes, out)
+			} else {
+				fmt.Fprintf(out, "Warning: Instance is not active, volumes not attached (terminate deletes them)\n")
+			}
+		}
+		if homeVolume != nil {
+			if !active {
+				fmt.Fprintf(out, "Warning: Instance is not active, home volume %s not attached\n", homeVolume.Name)
+			} else {
+				fmt.Fprintf(out, "Attaching home volume %s at %s...\n", homeVolume.Name, homeMountPoint(config.LoginUser))
+				if err := client.AttachVolume(ctx, instance.ID, homeVolume.ID); err != nil {
+					fmt.Fprintf(out, "Warning: Failed to attach home volume %s: %v\n", homeVolume.Name, err)
+				} else {
+					fmt.Fprintf(out, "Home volume %s attached\n", homeVolume.Name)
+				}
+			}
+		}
+
+		// Get updated instance info to show IP addresses
 		var instanceIP string
-		server, err = client.GetInstance(ctx, server.ID)
-		if err == nil {
-			if len(server.Addresses) > 0 {
-				fmt.Printf("\nInstance IP addresses:\n")
-				for networkName, addrList := range server.Addresses {
-					// Type assert to []interface{} and then extract address info
-					if addresses, ok := addrList.([]interface{}); ok {
-						for _, addrInterface := range addresses {
-							if addrMap, ok := addrInterface.(map[string]interface{}); ok {
-								if addrType, ok := addrMap["OS-EXT-IPS:type"].(string); ok {
-									if addrType == "fixed" || addrType == "floating" {
-										if addr, ok := addrMap["addr"].(string); ok {
-											fmt.Printf("  %s: %s\n", networkName, addr)
-											// Use the first IP address found for SSH connection
-											if instanceIP == "" {
-												instanceIP = addr
-											}
-										}
-									}
-								} else if addr, ok := addrMap["addr"].(string); ok {
-									// Fallback: show address if type is not available
-									fmt.Printf("  %s: %s\n", networkName, addr)
-									// Use the first IP address found for SSH connection
-									if instanceIP == "" {
-										instanceIP = addr
-									}
-								}
-							}
-						}
-					}
+		if updated, err := client.GetInstance(ctx, instance.ID); err == nil {
+			instance = updated
+			if floatingIP != nil {
+				// Nova may not report a new floating IP right away
+				addFloatingAddress(instance, pool, floatingIP.Address)
+			}
+			if len(instance.Addresses) > 0 {
+				fmt.Fprintf(out, "\nInstance IP addresses:\n")
+				for _, address := range instance.Addresses {
+					fmt.Fprintf(out, "  %s: %s\n", address.Network, address.Addr)
 				}
 			}
+			instanceIP = instance.IP()
 		}
 
-		fmt.Printf("\nSSH connection:\n")
-		if instanceIP != "" {
-			fmt.Printf("  ssh -i %s ubuntu@%s\n", keyPair.PrivateKeyPath, instanceIP)
-		} else {
-			fmt.Printf("  ssh -i %s ubuntu@<instance-ip>\n", keyPair.PrivateKeyPath)
+		// Record the host keys cloud-init prints to the console so connect and exec can verify them
+		hostKeysRecorded := false
+		if active {
+			fmt.Fprintf(out, "Waiting for host keys in the console log...\n")
+			if keys, err := waitForHostKeys(ctx, client, instance.ID, hostKeyWaitTimeout); err != nil {
+				fmt.Fprintf(out, "Warning: Could not read host keys, they will not be verified: %v\n", err)
+			} else {
+				var addresses []string
+				for _, address := range instance.Addresses {
+					addresses = append(addresses, address.Addr)
+				}
+				if err := recordHostKeys(instance.Name, addresses, keys); err != nil {
+					fmt.Fprintf(out, "Warning: Failed to record host keys: %v\n", err)
+				} else {
+					fmt.Fprintf(out, "Recorded %d host key(s) in %s\n", len(keys), knownHostsPath())
+					hostKeysRecorded = true
+				}
+			}
+		}
+
+		// Make the instance reachable by name from plain ssh, scp and Remote-SSH
+		sshConfigWritten := false
+		if instance.IP() != "" {
+			if err := addSSHConfigEntryForInstance(instance, config); err != nil {
+				fmt.Fprintf(out, "Warning: Failed to update %s: %v\n", sshConfigPath(), err)
+			} else {
+				sshConfigWritten = true
+			}
 		}
 
+		fmt.Fprintf(out, "\nSSH connection:\n")
+		if instanceIP == "" {
+			instanceIP = "<instance-ip>"
+		}
+		sshOptions := ""
+		if privateKeyPath != "" {
+			sshOptions += fmt.Sprintf("-i %s ", privateKeyPath)
+		}
+		if hostKeysRecorded {
+			sshOptions += fmt.Sprintf("-o UserKnownHostsFile=%s ", knownHostsPath())
+		}
+		if config.Bastion.Enabled() {
+			sshOptions += fmt.Sprintf("-J %s ", config.Bastion.ProxyJump())
+		}
+		fmt.Fprintf(out, "  ssh %s%s@%s\n", sshOptions, config.LoginUser, instanceIP)
+		if sshConfigWritten {
+			fmt.Fprintf(out, "  ssh %s\n", instance.Name)
+			if !sshConfigIncluded() {
+				fmt.Fprintf(out, "  (add 'Include config.d/tins' to the top of ~/.ssh/config to connect by name)\n")
+			}
+		}
+
+		if isStructuredOutput(format) {
+			return writeStructured(os.Stdout, format, newInstanceOutput(instance))
+		}
 		return nil
 	},
 }
 
 func init() {
 	createCmd.Flags().String("user-data", "", "Path to user-data file for custom instance provisioning (optional)")
+	createCmd.Flags().String("key-type", "", "SSH key type: ed25519 (default), ecdsa-p256, ecdsa-p384, rsa or rsa-<bits> (overrides key_type in config)")
+	createCmd.Flags().Bool("encrypt-key", false, "Encrypt the private key with a passphrase from key_passphrase_command or a prompt")
+	createCmd.Flags().String("ssh-agent", "", "Add the key to ssh-agent: off, add (also write the key file) or only (no key file)")
+	createCmd.Flags().String("ssh-public-key", "", "Use this existing public key (e.g. ~/.ssh/id_ed25519.pub) instead of generating one per instance")
+	createCmd.Flags().StringArray("authorize", nil, "Also allow this public key (file or key string) to log in; repeatable, added to authorized_keys from config")
+	createCmd.Flags().StringArray("open-port", nil, "Open a port in a security group of the instance's own, added to the project default, e.g. 8080/tcp or 5432,10.0.0.0/8; repeatable, SSH is always allowed (requires ssh_allowed_cidr or public_ip_url)")
+	createCmd.Flags().Int("boot-volume-size", 0, "Boot from a new volume of this many GB instead of the flavor's disk; the volume is deleted with the instance (overrides boot_volume_size in config)")
+	createCmd.Flags().String("volume-type", "", "Cinder volume type of the boot volume and of --volume volumes without a type (overrides volume_type in config)")
+	createCmd.Flags().String("from-snapshot", "", "Boot from this image created by 'tins snapshot' instead of the configured image")
+	createCmd.Flags().Bool("home", false, "Attach your persistent home volume (see 'tins home create') at the home directory of login_user (default: /home/ubuntu); terminate detaches but keeps it")
+	createCmd.Flags().StringArray("volume", nil, "Attach a new data volume: <size>[:<type>][:<mount-point>], e.g. 100 or 50:ssd:/data; repeatable, deleted on terminate")
+	createCmd.Flags().String("ttl", "", "Time-to-live after which 'tins reap' terminates the instance, e.g. 4h or 2d (optional)")
 	rootCmd.AddCommand(createCmd)
 }
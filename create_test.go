@@ -1,8 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func TestGenerateInstanceName(t *testing.T) {
@@ -10,7 +19,7 @@ func TestGenerateInstanceName(t *testing.T) {
 	if err != nil {
 		t.Fatalf("generateInstanceName failed: %v", err)
 	}
-	
+
 	// Verify format: adjective-noun
 	pattern := `^[a-z]+-[a-z]+$`
 	matched, err := regexp.MatchString(pattern, name)
@@ -20,7 +29,7 @@ func TestGenerateInstanceName(t *testing.T) {
 	if !matched {
 		t.Errorf("Instance name '%s' does not match expected pattern '%s'", name, pattern)
 	}
-	
+
 	// Verify it contains a hyphen
 	if len(name) < 3 {
 		t.Errorf("Instance name '%s' is too short", name)
@@ -31,20 +40,20 @@ func TestGenerateInstanceName_Uniqueness(t *testing.T) {
 	// Generate multiple names and verify they're different
 	names := make(map[string]bool)
 	iterations := 100
-	
+
 	for i := 0; i < iterations; i++ {
 		name, err := generateInstanceName()
 		if err != nil {
 			t.Fatalf("generateInstanceName failed: %v", err)
 		}
-		
+
 		if names[name] {
 			// It's okay if we get duplicates occasionally, but log it
 			t.Logf("Duplicate name generated: %s (iteration %d)", name, i)
 		}
 		names[name] = true
 	}
-	
+
 	// With 100 iterations, we should have some variety
 	// (though duplicates are possible with the word lists)
 	if len(names) < 10 {
@@ -83,7 +92,7 @@ func TestGenerateInstanceName_ValidWords(t *testing.T) {
 		"vigorous": true, "wizardly": true, "wonderful": true, "xenodochial": true,
 		"youthful": true, "zealous": true, "zen": true,
 	}
-	
+
 	nouns := map[string]bool{
 		"albattani": true, "allen": true, "almeida": true, "agnesi": true,
 		"archimedes": true, "ardinghelli": true, "aryabhata": true, "austin": true,
@@ -145,23 +154,23 @@ func TestGenerateInstanceName_ValidWords(t *testing.T) {
 		"wing": true, "wozniak": true, "wright": true, "wu": true,
 		"yalow": true, "yonath": true, "zhukovsky": true,
 	}
-	
+
 	// Generate multiple names and verify they use valid words
 	for i := 0; i < 50; i++ {
 		name, err := generateInstanceName()
 		if err != nil {
 			t.Fatalf("generateInstanceName failed: %v", err)
 		}
-		
+
 		parts := regexp.MustCompile(`-`).Split(name, 2)
 		if len(parts) != 2 {
 			t.Errorf("Instance name '%s' should have exactly two parts separated by '-'", name)
 			continue
 		}
-		
+
 		adjective := parts[0]
 		noun := parts[1]
-		
+
 		if !adjectives[adjective] {
 			t.Errorf("Instance name '%s' uses invalid adjective '%s'", name, adjective)
 		}
@@ -170,3 +179,245 @@ func TestGenerateInstanceName_ValidWords(t *testing.T) {
 		}
 	}
 }
+
+// runCommand executes the root command with the given arguments and returns its stdout
+func runCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var err error
+	output := captureStdout(t, func() {
+		rootCmd.SetArgs(args)
+		err = rootCmd.Execute()
+	})
+	return output, err
+}
+
+// resetFlagsAfterTest restores every flag of cmd to its default when the test ends,
+// since cobra keeps parsed flag values between Execute calls
+func resetFlagsAfterTest(t *testing.T, cmd *cobra.Command) {
+	t.Helper()
+	t.Cleanup(func() {
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if slice, ok := flag.Value.(pflag.SliceValue); ok {
+				_ = slice.Replace(nil)
+			} else {
+				_ = flag.Value.Set(flag.DefValue)
+			}
+			flag.Changed = false
+		})
+	})
+}
+
+func TestCreateListTerminate_FakeOpenStack(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	fake.BuildPolls = 2
+
+	output, err := runCommand(t, "create", "e2e-test")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "Instance is now ACTIVE") {
+		t.Errorf("Expected create to wait for ACTIVE, got:\n%s", output)
+	}
+
+	server := fake.Server("tins-e2e-test")
+	if server == nil {
+		t.Fatal("Expected server tins-e2e-test to be created")
+	}
+	if server.Metadata[TempInstanceTag] != "true" {
+		t.Errorf("Expected server to be tagged with %s metadata, got %v", TempInstanceTag, server.Metadata)
+	}
+	if server.KeyName != "tins-e2e-test" {
+		t.Errorf("Expected server key_name 'tins-e2e-test', got '%s'", server.KeyName)
+	}
+	if !fake.HasKeypair("tins-e2e-test") {
+		t.Error("Expected keypair tins-e2e-test to be created")
+	}
+	if _, err := os.Stat(GetSSHKeyPath("e2e-test")); err != nil {
+		t.Errorf("Expected local private key to exist: %v", err)
+	}
+
+	output, err = runCommand(t, "list")
+	if err != nil {
+		t.Fatalf("list command failed: %v", err)
+	}
+	if !strings.Contains(output, "tins-e2e-test") || !strings.Contains(output, "ACTIVE") {
+		t.Errorf("Expected list to show the ACTIVE instance, got:\n%s", output)
+	}
+
+	output, err = runCommand(t, "terminate", "e2e-test")
+	if err != nil {
+		t.Fatalf("terminate command failed: %v\n%s", err, output)
+	}
+	if fake.ServerCount() != 0 {
+		t.Errorf("Expected no servers after terminate, got %d", fake.ServerCount())
+	}
+	if fake.HasKeypair("tins-e2e-test") {
+		t.Error("Expected keypair to be deleted on terminate")
+	}
+	if _, err := os.Stat(GetSSHKeyPath("e2e-test")); !os.IsNotExist(err) {
+		t.Error("Expected local private key to be deleted on terminate")
+	}
+}
+
+func TestCreate_ServerCreateFault(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	fake.InjectFault(http.MethodPost, "/compute/v2.1/servers", http.StatusInternalServerError)
+
+	_, err := runCommand(t, "create", "faulty")
+	if err == nil || !strings.Contains(err.Error(), "failed to create server") {
+		t.Fatalf("create command should fail when the server cannot be created, got %v", err)
+	}
+	if n := fake.Requests(http.MethodPost, "/compute/v2.1/servers"); n != 1 {
+		t.Fatalf("Expected the faulty server create to be attempted once, got %d requests", n)
+	}
+	// The keypair is imported before the server create and rolled back after it fails
+	if fake.Requests(http.MethodPost, "/compute/v2.1/os-keypairs") != 1 || fake.Requests(http.MethodDelete, "/compute/v2.1/os-keypairs/tins-faulty") != 1 {
+		t.Error("Expected the keypair to be created and then deleted")
+	}
+
+	if fake.ServerCount() != 0 {
+		t.Errorf("Expected no servers, got %d", fake.ServerCount())
+	}
+	if fake.HasKeypair("tins-faulty") {
+		t.Error("Expected keypair to be cleaned up after a failed create")
+	}
+	if _, err := os.Stat(GetSSHKeyPath("faulty")); !os.IsNotExist(err) {
+		t.Error("Expected local private key to be cleaned up after a failed create")
+	}
+}
+
+// failingSecurityGroupProvider is a fakeProvider that cannot create security groups
+type failingSecurityGroupProvider struct {
+	*fakeProvider
+}
+
+func (p failingSecurityGroupProvider) CreateSecurityGroup(context.Context, string, []PortRule) error {
+	return fmt.Errorf("security group quota exceeded")
+}
+
+func TestCreate_RollbackBeforeServerCreate(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_NETWORK_ATTACHMENT_MODE", "new_network")
+	t.Setenv("OS_EXTERNAL_NETWORK", "public")
+	provider := newFakeProvider()
+	useFakeProvider(t, failingSecurityGroupProvider{provider})
+	writePublicIPURLConfig(t, useCallerIP(t, "198.51.100.7"))
+	resetFlagsAfterTest(t, createCmd)
+
+	// The key, volume and network all exist by the time the security group fails
+	_, err := runCommand(t, "create", "doomed", "--volume", "10", "--open-port", "8080")
+	if err == nil || !strings.Contains(err.Error(), "failed to create security group") {
+		t.Fatalf("create command should fail when the security group cannot be created, got %v", err)
+	}
+	if len(provider.instances) != 0 || len(provider.volumes) != 0 || len(provider.networks) != 0 {
+		t.Errorf("Expected everything created to be rolled back, got instances %v, volumes %v, networks %v",
+			provider.instances, provider.volumes, provider.networks)
+	}
+	for _, path := range []string{GetSSHKeyPath("doomed"), GetSSHKeyPath("doomed") + ".pub"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be cleaned up after a failed create", path)
+		}
+	}
+}
+
+func TestCreateTerminate_PersonalPublicKey(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+
+	// A personal key pair that tins must never delete
+	home, _ := os.UserHomeDir()
+	personal, err := GenerateSSHKey("personal", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	publicKeyPath := filepath.Join(home, "id_personal.pub")
+	if err := os.Rename(personal.PublicKeyPath, publicKeyPath); err != nil {
+		t.Fatalf("Failed to move public key: %v", err)
+	}
+
+	for _, name := range []string{"first", "second"} {
+		output, err := runCommand(t, "create", name, "--ssh-public-key", publicKeyPath)
+		if err != nil {
+			t.Fatalf("create command failed: %v\n%s", err, output)
+		}
+		if _, err := os.Stat(GetSSHKeyPath(name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no generated key for %s", name)
+		}
+	}
+
+	// Both instances share one keypair holding the personal key
+	if len(provider.keypairs) != 1 {
+		t.Fatalf("Expected a single shared keypair, got %v", provider.keypairs)
+	}
+	var keypairName string
+	for name, publicKey := range provider.keypairs {
+		keypairName = name
+		if publicKey != personal.PublicKey {
+			t.Errorf("Expected keypair to hold the personal public key, got %q", publicKey)
+		}
+	}
+	if !strings.HasPrefix(keypairName, SharedKeypairPrefix) {
+		t.Errorf("Expected shared keypair name to start with %s, got %s", SharedKeypairPrefix, keypairName)
+	}
+	// An instance named key-<fingerprint> must not be able to claim the shared keypair's name
+	if strings.HasPrefix(keypairName, InstanceNamePrefix) {
+		t.Errorf("Expected shared keypair name %s not to look like an instance keypair", keypairName)
+	}
+
+	if _, err := runCommand(t, "terminate", "first"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	if _, ok := provider.keypairs[keypairName]; !ok {
+		t.Error("Expected shared keypair to survive terminate")
+	}
+	if _, err := os.Stat(publicKeyPath); err != nil {
+		t.Errorf("Expected personal public key to survive terminate: %v", err)
+	}
+	if _, err := os.Stat(personal.PrivateKeyPath); err != nil {
+		t.Errorf("Expected personal private key to survive terminate: %v", err)
+	}
+}
+
+func TestCreate_AuthorizedKeys(t *testing.T) {
+	userDataPath, err := filepath.Abs("testdata/user-data.sh")
+	if err != nil {
+		t.Fatalf("failed to resolve user-data path: %v", err)
+	}
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+
+	teammate, err := GenerateSSHKey("teammate", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	colleague, err := GenerateSSHKey("colleague", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	output, err := runCommand(t, "create", "shared",
+		"--user-data", userDataPath,
+		"--authorize", teammate.PublicKeyPath,
+		"--authorize", strings.TrimSpace(colleague.PublicKey))
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+
+	var userData string
+	for _, spec := range provider.specs {
+		userData = string(spec.UserData)
+	}
+	if !strings.Contains(userData, "text/x-shellscript") || !strings.Contains(userData, "GitHub CLI") {
+		t.Errorf("Expected the user-data script to be kept, got:\n%s", userData)
+	}
+	for _, key := range []string{teammate.PublicKey, colleague.PublicKey} {
+		fields := strings.Fields(key)
+		if !strings.Contains(userData, fields[1]) {
+			t.Errorf("Expected user-data to authorize %s, got:\n%s", fields[1], userData)
+		}
+	}
+}
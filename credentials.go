@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// errNoTerminal is returned by promptPassword when stdin is not an interactive terminal
+var errNoTerminal = errors.New("stdin is not a terminal")
+
+// credentialSource is one link in the password provider chain.
+// It returns an empty string and no error when it has nothing to offer, so the next source is tried.
+type credentialSource struct {
+	name string
+	get  func(config *OpenStackConfig) (string, error)
+}
+
+// passwordSources is the chain consulted for the OpenStack password, in order
+var passwordSources = []credentialSource{
+	{name: "OS_PASSWORD", get: passwordFromEnv},
+	{name: "clouds.yaml", get: passwordFromCloud},
+	{name: "password_command", get: passwordFromCommand},
+	{name: "password_file", get: passwordFromFile},
+	{name: "prompt", get: passwordFromPrompt},
+}
+
+// resolvePassword walks the password provider chain and returns the first password found
+func resolvePassword(config *OpenStackConfig) (string, error) {
+	for _, source := range passwordSources {
+		password, err := source.get(config)
+		if err != nil {
+			return "", fmt.Errorf("failed to get password from %s: %w", source.name, err)
+		}
+		if password != "" {
+			return password, nil
+		}
+	}
+	return "", fmt.Errorf("OS_PASSWORD is required (set the environment variable, password_command or password_file in the config file, or run interactively)")
+}
+
+func passwordFromEnv(_ *OpenStackConfig) (string, error) {
+	return os.Getenv("OS_PASSWORD"), nil
+}
+
+// passwordFromCloud returns the password already loaded from clouds.yaml or secure.yaml
+func passwordFromCloud(config *OpenStackConfig) (string, error) {
+	return config.Password, nil
+}
+
+// passwordFromCommand runs password_command through the shell and uses its stdout as the password
+func passwordFromCommand(config *OpenStackConfig) (string, error) {
+	if config.PasswordCommand == "" {
+		return "", nil
+	}
+	return runSecretCommand(config.PasswordCommand)
+}
+
+// runSecretCommand runs a command through the shell and returns its stdout without the trailing newline
+func runSecretCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	// Let password managers prompt for their own unlock passphrase
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("command '%s' failed: %w", command, err)
+	}
+
+	secret := strings.TrimRight(string(output), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("command '%s' printed an empty secret", command)
+	}
+	return secret, nil
+}
+
+// passwordFromFile reads the password from password_file, refusing files other users can read
+func passwordFromFile(config *OpenStackConfig) (string, error) {
+	if config.PasswordFile == "" {
+		return "", nil
+	}
+
+	path := expandHome(config.PasswordFile)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := checkSecretFilePermissions(path, info); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	password := strings.TrimRight(string(data), "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return password, nil
+}
+
+// passwordFromPrompt asks for the password without echo when running interactively
+func passwordFromPrompt(config *OpenStackConfig) (string, error) {
+	password, err := promptPassword(fmt.Sprintf("OpenStack password for %s at %s: ", config.Username, config.AuthURL))
+	if errors.Is(err, errNoTerminal) {
+		return "", nil
+	}
+	return password, err
+}
+
+// keyPassphrase returns the passphrase for instance private keys from key_passphrase_command,
+// or by prompting. With confirm set, the prompted passphrase must be entered twice.
+func keyPassphrase(command string, confirm bool) ([]byte, error) {
+	if command != "" {
+		passphrase, err := runSecretCommand(command)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key passphrase from key_passphrase_command: %w", err)
+		}
+		return []byte(passphrase), nil
+	}
+
+	passphrase, err := promptPassword("SSH key passphrase: ")
+	if errors.Is(err, errNoTerminal) {
+		return nil, fmt.Errorf("a key passphrase is required: set key_passphrase_command or run interactively")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("key passphrase must not be empty")
+	}
+
+	if confirm {
+		again, err := promptPassword("Confirm SSH key passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if again != passphrase {
+			return nil, fmt.Errorf("key passphrases do not match")
+		}
+	}
+	return []byte(passphrase), nil
+}
+
+// promptPassword reads a secret from the terminal without echoing it. Tests replace it.
+var promptPassword = func(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errNoTerminal
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[2:])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// usePromptPassword replaces the interactive prompt for the duration of a test
+func usePromptPassword(t *testing.T, fn func(prompt string) (string, error)) {
+	t.Helper()
+	original := promptPassword
+	promptPassword = fn
+	t.Cleanup(func() { promptPassword = original })
+}
+
+func TestResolvePassword(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(secretFile, []byte("file-secret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		env     string
+		config  OpenStackConfig
+		prompt  string
+		want    string
+		wantErr string
+	}{
+		{name: "environment variable wins", env: "env-secret", config: OpenStackConfig{Password: "cloud-secret", PasswordFile: secretFile}, want: "env-secret"},
+		{name: "clouds.yaml password", config: OpenStackConfig{Password: "cloud-secret", PasswordFile: secretFile}, want: "cloud-secret"},
+		{name: "password command", config: OpenStackConfig{PasswordCommand: "echo cmd-secret", PasswordFile: secretFile}, want: "cmd-secret"},
+		{name: "failing password command", config: OpenStackConfig{PasswordCommand: "exit 3"}, wantErr: "password_command"},
+		{name: "password file", config: OpenStackConfig{PasswordFile: secretFile}, want: "file-secret"},
+		{name: "missing password file", config: OpenStackConfig{PasswordFile: filepath.Join(dir, "missing")}, wantErr: "password_file"},
+		{name: "interactive prompt", prompt: "typed-secret", want: "typed-secret"},
+		{name: "no source", wantErr: "OS_PASSWORD is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OS_PASSWORD", tt.env)
+			usePromptPassword(t, func(string) (string, error) {
+				if tt.prompt == "" {
+					return "", errNoTerminal
+				}
+				return tt.prompt, nil
+			})
+
+			got, err := resolvePassword(&tt.config)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePassword failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected password %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPasswordFromFile_RejectsOpenPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not checked on Windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+
+	_, err := passwordFromFile(&OpenStackConfig{PasswordFile: path})
+	if err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("Expected permission error, got %v", err)
+	}
+}
+
+func TestLoadConfig_MissingPasswordReturnsError(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_PASSWORD", "")
+	usePromptPassword(t, func(string) (string, error) { return "", errNoTerminal })
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "OS_PASSWORD is required") {
+		t.Errorf("Expected missing password error, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkSecretFilePermissions rejects secret files that are readable or writable by group or others
+func checkSecretFilePermissions(path string, info os.FileInfo) error {
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return fmt.Errorf("%s has permissions %04o, must not be accessible by group or others (run: chmod 600 %s)", path, mode, path)
+	}
+	return nil
+}
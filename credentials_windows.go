@@ -0,0 +1,10 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// checkSecretFilePermissions is a no-op on Windows, where POSIX permission bits don't reflect file ACLs
+func checkSecretFilePermissions(_ string, _ os.FileInfo) error {
+	return nil
+}
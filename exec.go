@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <instance-name-or-id> -- <command> [args...]",
+	Short: "Run a command on a temporary instance",
+	Long:  "Run a command on an ephemeral OpenStack instance over SSH and exit with its exit code. Standard input, output and error are streamed to and from the remote command. Arguments are passed unchanged; use sh -c for pipes and redirects.",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sshUser, _ := cmd.Flags().GetString("user")
+		instanceIdentifier := args[0]
+		remoteCommand := remoteCommandLine(args[1:])
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, instanceIdentifier)
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		target, err := sshTargetForInstance(instance, sshUser, config)
+		if err != nil {
+			return err
+		}
+
+		exitCode, err := runRemoteCommand(target, remoteCommand, os.Stdin, os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+
+		return nil
+	},
+}
+
+// remoteCommandLine joins a command and its arguments into a line for the remote shell.
+// Every argument is single-quoted so spaces and shell metacharacters reach the command unchanged.
+func remoteCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote single-quotes a string for a POSIX shell, closing the quotes around embedded single quotes
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+func init() {
+	execCmd.Flags().String("user", "", "SSH user to connect as (default: login_user from the config file)")
+	rootCmd.AddCommand(execCmd)
+}
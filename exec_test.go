@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestRemoteCommandLine(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"hostname"}, "'hostname'"},
+		{[]string{"touch", "a b"}, "'touch' 'a b'"},
+		{[]string{"echo", "it's", "$HOME"}, `'echo' 'it'\''s' '$HOME'`},
+		{[]string{"printf", ""}, "'printf' ''"},
+	}
+	for _, test := range tests {
+		if got := remoteCommandLine(test.args); got != test.expected {
+			t.Errorf("remoteCommandLine(%q) = %s, expected %s", test.args, got, test.expected)
+		}
+	}
+}
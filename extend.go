@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var extendCmd = &cobra.Command{
+	Use:   "extend <instance-name-or-id> <duration>",
+	Short: "Extend the time-to-live of a temporary instance",
+	Long:  "Push back the expiry time of an ephemeral OpenStack instance by the given duration (e.g. 2h or 1d). Instances that have already expired, or have no TTL, get a new expiry counted from now.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		instanceIdentifier := args[0]
+		extension, err := parseTTL(args[1])
+		if err != nil {
+			return err
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, instanceIdentifier)
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		// Extend from the current expiry if it is still in the future, otherwise from now
+		base := time.Now()
+		if expiresAt, ok := instance.ExpiresAt(); ok && expiresAt.After(base) {
+			base = expiresAt
+		}
+		newExpiry := base.Add(extension)
+
+		if err := client.UpdateInstanceMetadata(ctx, instance.ID, map[string]string{
+			ExpiresAtTag: formatExpiresAt(newExpiry),
+		}); err != nil {
+			return fmt.Errorf("failed to extend instance: %w", err)
+		}
+
+		fmt.Printf("Instance %s now expires at %s (in %s).\n",
+			instance.Name,
+			formatExpiresAt(newExpiry),
+			time.Until(newExpiry).Truncate(time.Minute),
+		)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(extendCmd)
+}
@@ -0,0 +1,868 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeToken     = "fake-token"
+	fakeRegion    = "test-region"
+	fakeProjectID = "test-project-id"
+)
+
+// fakeServer is the state the fake Nova keeps for a server
+type fakeServer struct {
+	ID        string
+	Name      string
+	Status    string
+	Created   time.Time
+	ImageRef  string
+	FlavorRef string
+	KeyName   string
+	Networks  []string
+	Metadata  map[string]string
+	UserData  string
+	// BlockDevices is the block_device_mapping_v2 the server was created with
+	BlockDevices []fakeBlockDevice
+	// ConsoleOutput is the console log, in which "cloud-init" prints a generated host key
+	ConsoleOutput string
+	// buildPolls is the number of GETs left before a BUILD server reaches buildResult
+	buildPolls  int
+	buildResult string
+}
+
+// fakeBlockDevice is an entry of a server's block_device_mapping_v2
+type fakeBlockDevice struct {
+	SourceType          string `json:"source_type"`
+	UUID                string `json:"uuid"`
+	DestinationType     string `json:"destination_type"`
+	VolumeSize          int    `json:"volume_size"`
+	VolumeType          string `json:"volume_type"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+	BootIndex           int    `json:"boot_index"`
+}
+
+// fakeVolume is the state the fake Cinder keeps for a volume
+type fakeVolume struct {
+	ID         string
+	Name       string
+	Status     string
+	Size       int
+	VolumeType string
+	Metadata   map[string]string
+	Created    time.Time
+	// ServerID is the server the volume is attached to, if any
+	ServerID string
+}
+
+// fakeOpenStack is an in-memory fake of the Keystone v3, Nova, Glance, Neutron and Cinder APIs used by tins.
+// Point auth_url at URL()+"/v3" to use it.
+type fakeOpenStack struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	servers  map[string]*fakeServer
+	keypairs map[string]string
+	volumes  map[string]*fakeVolume
+	images   map[string]string // name -> ID
+	flavors  map[string]string // name -> ID
+	networks map[string]string // name -> ID
+	faults   map[string][]int  // "METHOD /path" -> queued status codes
+	requests map[string]int    // "METHOD /path" -> number of requests received
+
+	// BuildPolls is how many status polls a new server stays in BUILD
+	BuildPolls int
+	// BuildResult is the status a server ends up in after BUILD (default: ACTIVE)
+	BuildResult string
+}
+
+// newFakeOpenStack starts a fake OpenStack API server that is shut down when the test ends
+func newFakeOpenStack(t *testing.T) *fakeOpenStack {
+	t.Helper()
+	f := &fakeOpenStack{
+		servers:     make(map[string]*fakeServer),
+		keypairs:    make(map[string]string),
+		volumes:     make(map[string]*fakeVolume),
+		images:      map[string]string{"test-image": "image-1"},
+		flavors:     map[string]string{"m1.small": "flavor-1"},
+		networks:    map[string]string{"test-network": "network-1"},
+		faults:      make(map[string][]int),
+		requests:    make(map[string]int),
+		BuildPolls:  1,
+		BuildResult: InstanceStatusActive,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/auth/tokens", f.handleAuth)
+
+	// gophercloud discovers the API versions behind each catalog endpoint when it creates a service client
+	mux.HandleFunc("GET /compute/{$}", f.handleVersions("v2.1"))
+	mux.HandleFunc("GET /image/{$}", f.handleVersions("v2.0"))
+	mux.HandleFunc("GET /network/{$}", f.handleVersions("v2.0"))
+
+	mux.HandleFunc("GET /compute/v2.1/servers/detail", f.handleListServers)
+	mux.HandleFunc("POST /compute/v2.1/servers", f.handleCreateServer)
+	mux.HandleFunc("GET /compute/v2.1/servers/{id}", f.handleGetServer)
+	mux.HandleFunc("DELETE /compute/v2.1/servers/{id}", f.handleDeleteServer)
+	mux.HandleFunc("POST /compute/v2.1/servers/{id}/metadata", f.handleUpdateServerMetadata)
+	mux.HandleFunc("POST /compute/v2.1/servers/{id}/action", f.handleServerAction)
+	mux.HandleFunc("GET /compute/v2.1/flavors/detail", f.handleListFlavors)
+	mux.HandleFunc("GET /compute/v2.1/os-keypairs", f.handleListKeypairs)
+	mux.HandleFunc("POST /compute/v2.1/os-keypairs", f.handleCreateKeypair)
+	mux.HandleFunc("GET /compute/v2.1/os-keypairs/{name}", f.handleGetKeypair)
+	mux.HandleFunc("DELETE /compute/v2.1/os-keypairs/{name}", f.handleDeleteKeypair)
+	mux.HandleFunc("POST /compute/v2.1/servers/{id}/os-volume_attachments", f.handleAttachVolume)
+	mux.HandleFunc("DELETE /compute/v2.1/servers/{id}/os-volume_attachments/{volume}", f.handleDetachVolume)
+
+	mux.HandleFunc("GET /image/v2/images", f.handleListImages)
+
+	mux.HandleFunc("GET /network/v2.0/networks", f.handleListNetworks)
+
+	mux.HandleFunc("POST /volume/v3/{project}/volumes", f.handleCreateVolume)
+	mux.HandleFunc("GET /volume/v3/{project}/volumes/detail", f.handleListVolumes)
+	mux.HandleFunc("GET /volume/v3/{project}/volumes/{id}", f.handleGetVolume)
+	mux.HandleFunc("DELETE /volume/v3/{project}/volumes/{id}", f.handleDeleteVolume)
+
+	f.server = httptest.NewServer(f.middleware(mux))
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+// URL returns the base URL of the fake
+func (f *fakeOpenStack) URL() string {
+	return f.server.URL
+}
+
+// InjectFault makes the next request matching method and path fail with the given status code
+func (f *fakeOpenStack) InjectFault(method, path string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := method + " " + path
+	f.faults[key] = append(f.faults[key], status)
+}
+
+// Requests returns how many requests matching method and path the fake has received, including failed ones
+func (f *fakeOpenStack) Requests(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method+" "+path]
+}
+
+// AddServer creates a server directly in the fake, bypassing the API, and returns its ID
+func (f *fakeOpenStack) AddServer(name, status string, metadata map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	server := &fakeServer{
+		ID:        f.newID("server"),
+		Name:      name,
+		Status:    status,
+		Created:   time.Now(),
+		ImageRef:  "image-1",
+		FlavorRef: "flavor-1",
+		Networks:  []string{"network-1"},
+		Metadata:  metadata,
+	}
+	f.servers[server.ID] = server
+	return server.ID
+}
+
+// Server returns a copy of the server with the given name, or nil
+func (f *fakeOpenStack) Server(name string) *fakeServer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, server := range f.servers {
+		if server.Name == name {
+			copied := *server
+			return &copied
+		}
+	}
+	return nil
+}
+
+// Volume returns a copy of the volume with the given name, or nil
+func (f *fakeOpenStack) Volume(name string) *fakeVolume {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, volume := range f.volumes {
+		if volume.Name == name {
+			copied := *volume
+			return &copied
+		}
+	}
+	return nil
+}
+
+// ServerCount returns the number of servers that exist
+func (f *fakeOpenStack) ServerCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.servers)
+}
+
+// HasKeypair reports whether a keypair with the given name exists
+func (f *fakeOpenStack) HasKeypair(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.keypairs[name]
+	return ok
+}
+
+// middleware applies fault injection and token checks to every request
+func (f *fakeOpenStack) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + r.URL.Path
+		f.mu.Lock()
+		f.requests[key]++
+		queued := f.faults[key]
+		if len(queued) > 0 {
+			f.faults[key] = queued[1:]
+		}
+		f.mu.Unlock()
+
+		if len(queued) > 0 {
+			writeFakeError(w, queued[0], "injected fault")
+			return
+		}
+
+		if r.URL.Path != "/v3/auth/tokens" && r.Header.Get("X-Auth-Token") != fakeToken {
+			writeFakeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeOpenStack) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeFakeError(w http.ResponseWriter, status int, message string) {
+	writeFakeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"code": status, "message": message},
+	})
+}
+
+func (f *fakeOpenStack) catalogEntry(serviceType, name, path string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":   serviceType,
+		"type": serviceType,
+		"name": name,
+		"endpoints": []map[string]interface{}{
+			{
+				"id":        serviceType + "-public",
+				"interface": "public",
+				"region":    fakeRegion,
+				"region_id": fakeRegion,
+				"url":       f.server.URL + path,
+			},
+		},
+	}
+}
+
+func (f *fakeOpenStack) handleAuth(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Auth.Identity.Methods) == 0 {
+		writeFakeError(w, http.StatusBadRequest, "no auth methods")
+		return
+	}
+
+	w.Header().Set("X-Subject-Token", fakeToken)
+	writeFakeJSON(w, http.StatusCreated, map[string]interface{}{
+		"token": map[string]interface{}{
+			"methods":    req.Auth.Identity.Methods,
+			"expires_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"issued_at":  time.Now().UTC().Format(time.RFC3339),
+			"project": map[string]interface{}{
+				"id":     fakeProjectID,
+				"name":   "test-project",
+				"domain": map[string]interface{}{"id": "default", "name": "Default"},
+			},
+			"user": map[string]interface{}{
+				"id":     "user-1",
+				"name":   req.Auth.Identity.Password.User.Name,
+				"domain": map[string]interface{}{"id": "default", "name": "Default"},
+			},
+			"catalog": []map[string]interface{}{
+				f.catalogEntry("identity", "keystone", "/v3/"),
+				f.catalogEntry("compute", "nova", "/compute/v2.1/"),
+				f.catalogEntry("image", "glance", "/image/"),
+				f.catalogEntry("network", "neutron", "/network/"),
+				f.catalogEntry("volumev3", "cinderv3", "/volume/v3/"+fakeProjectID+"/"),
+			},
+		},
+	})
+}
+
+// handleVersions serves the version discovery document of a service that supports a single API version
+func (f *fakeOpenStack) handleVersions(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+			"versions": []map[string]interface{}{
+				{"id": id, "status": "CURRENT"},
+			},
+		})
+	}
+}
+
+// serverJSON renders a server the way Nova returns it from GET /servers/{id}
+func (f *fakeOpenStack) serverJSON(server *fakeServer) map[string]interface{} {
+	addresses := map[string]interface{}{}
+	if server.Status == InstanceStatusActive {
+		for i, networkID := range server.Networks {
+			networkName := networkID
+			for name, id := range f.networks {
+				if id == networkID {
+					networkName = name
+				}
+			}
+			addresses[networkName] = []interface{}{
+				map[string]interface{}{
+					"version":         4,
+					"addr":            fmt.Sprintf("10.0.%d.%s", i, strings.TrimPrefix(server.ID, "server-")),
+					"OS-EXT-IPS:type": "fixed",
+				},
+			}
+		}
+	}
+
+	return map[string]interface{}{
+		"id":        server.ID,
+		"name":      server.Name,
+		"status":    server.Status,
+		"tenant_id": fakeProjectID,
+		"user_id":   "user-1",
+		"created":   server.Created.UTC().Format(time.RFC3339),
+		"updated":   server.Created.UTC().Format(time.RFC3339),
+		"key_name":  server.KeyName,
+		"image":     map[string]interface{}{"id": server.ImageRef},
+		"flavor":    map[string]interface{}{"id": server.FlavorRef},
+		"addresses": addresses,
+		"metadata":  server.Metadata,
+		"links":     []interface{}{},
+	}
+}
+
+func (f *fakeOpenStack) handleListServers(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []interface{}{}
+	for _, server := range f.servers {
+		list = append(list, f.serverJSON(server))
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"servers": list})
+}
+
+func (f *fakeOpenStack) handleCreateServer(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Server struct {
+			Name      string            `json:"name"`
+			ImageRef  string            `json:"imageRef"`
+			FlavorRef string            `json:"flavorRef"`
+			KeyName   string            `json:"key_name"`
+			Metadata  map[string]string `json:"metadata"`
+			UserData  string            `json:"user_data"`
+			Networks  []struct {
+				UUID string `json:"uuid"`
+			} `json:"networks"`
+			BlockDevices []fakeBlockDevice `json:"block_device_mapping_v2"`
+		} `json:"server"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if req.Server.FlavorRef == "" {
+		writeFakeError(w, http.StatusBadRequest, "flavorRef is required")
+		return
+	}
+	if req.Server.ImageRef == "" && len(req.Server.BlockDevices) == 0 {
+		writeFakeError(w, http.StatusBadRequest, "imageRef or block_device_mapping_v2 is required")
+		return
+	}
+	if req.Server.KeyName != "" {
+		if _, ok := f.keypairs[req.Server.KeyName]; !ok {
+			writeFakeError(w, http.StatusBadRequest, "Invalid key_name provided.")
+			return
+		}
+	}
+
+	server := &fakeServer{
+		ID:          f.newID("server"),
+		Name:        req.Server.Name,
+		Status:      "BUILD",
+		Created:     time.Now(),
+		ImageRef:    req.Server.ImageRef,
+		FlavorRef:   req.Server.FlavorRef,
+		KeyName:     req.Server.KeyName,
+		Metadata:    req.Server.Metadata,
+		UserData:    req.Server.UserData,
+		buildPolls:  f.BuildPolls,
+		buildResult: f.BuildResult,
+	}
+	server.ConsoleOutput = fakeConsoleOutput(newFakeHostKey())
+	server.BlockDevices = req.Server.BlockDevices
+	for _, network := range req.Server.Networks {
+		server.Networks = append(server.Networks, network.UUID)
+	}
+	if server.buildPolls <= 0 {
+		server.Status = server.buildResult
+	}
+	f.servers[server.ID] = server
+
+	writeFakeJSON(w, http.StatusAccepted, map[string]interface{}{"server": f.serverJSON(server)})
+}
+
+func (f *fakeOpenStack) handleGetServer(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Instance could not be found.")
+		return
+	}
+
+	// Advance the BUILD state machine on every poll
+	if server.Status == "BUILD" {
+		server.buildPolls--
+		if server.buildPolls <= 0 {
+			server.Status = server.buildResult
+		}
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"server": f.serverJSON(server)})
+}
+
+func (f *fakeOpenStack) handleDeleteServer(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := r.PathValue("id")
+	if _, ok := f.servers[id]; !ok {
+		writeFakeError(w, http.StatusNotFound, "Instance could not be found.")
+		return
+	}
+	delete(f.servers, id)
+	// Like Nova, deleting a server detaches its volumes
+	for _, volume := range f.volumes {
+		if volume.ServerID == id {
+			volume.ServerID = ""
+			volume.Status = "available"
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *fakeOpenStack) handleUpdateServerMetadata(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Instance could not be found.")
+		return
+	}
+	if server.Metadata == nil {
+		server.Metadata = map[string]string{}
+	}
+	for key, value := range req.Metadata {
+		server.Metadata[key] = value
+	}
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"metadata": server.Metadata})
+}
+
+func (f *fakeOpenStack) handleServerAction(w http.ResponseWriter, r *http.Request) {
+	var req map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	server, ok := f.servers[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Instance could not be found.")
+		return
+	}
+
+	switch {
+	case req["os-getConsoleOutput"] != nil:
+		writeFakeJSON(w, http.StatusOK, map[string]interface{}{"output": server.ConsoleOutput})
+	default:
+		writeFakeError(w, http.StatusBadRequest, "Unsupported server action.")
+	}
+}
+
+func (f *fakeOpenStack) handleListFlavors(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []interface{}{}
+	for name, id := range f.flavors {
+		list = append(list, map[string]interface{}{
+			"id":                         id,
+			"name":                       name,
+			"ram":                        2048,
+			"vcpus":                      1,
+			"disk":                       20,
+			"swap":                       0,
+			"os-flavor-access:is_public": true,
+		})
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"flavors": list})
+}
+
+func (f *fakeOpenStack) handleListKeypairs(w http.ResponseWriter, _ *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	list := []interface{}{}
+	for name, publicKey := range f.keypairs {
+		list = append(list, map[string]interface{}{
+			"keypair": map[string]interface{}{"name": name, "public_key": publicKey},
+		})
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"keypairs": list})
+}
+
+func (f *fakeOpenStack) handleCreateKeypair(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keypair struct {
+			Name      string `json:"name"`
+			PublicKey string `json:"public_key"`
+		} `json:"keypair"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.keypairs[req.Keypair.Name]; ok {
+		writeFakeError(w, http.StatusConflict, "Key pair already exists.")
+		return
+	}
+	f.keypairs[req.Keypair.Name] = req.Keypair.PublicKey
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+		"keypair": map[string]interface{}{
+			"name":       req.Keypair.Name,
+			"public_key": req.Keypair.PublicKey,
+			"user_id":    "user-1",
+			"type":       "ssh",
+		},
+	})
+}
+
+func (f *fakeOpenStack) handleGetKeypair(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := r.PathValue("name")
+	publicKey, ok := f.keypairs[name]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Keypair not found.")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+		"keypair": map[string]interface{}{"name": name, "public_key": publicKey},
+	})
+}
+
+func (f *fakeOpenStack) handleDeleteKeypair(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := r.PathValue("name")
+	if _, ok := f.keypairs[name]; !ok {
+		writeFakeError(w, http.StatusNotFound, "Keypair not found.")
+		return
+	}
+	delete(f.keypairs, name)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeOpenStack) handleListImages(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	nameFilter := r.URL.Query().Get("name")
+	list := []interface{}{}
+	for name, id := range f.images {
+		if nameFilter != "" && name != nameFilter {
+			continue
+		}
+		list = append(list, map[string]interface{}{
+			"id":     id,
+			"name":   name,
+			"status": "active",
+		})
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"images": list})
+}
+
+func (f *fakeOpenStack) handleListNetworks(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	nameFilter := r.URL.Query().Get("name")
+	list := []interface{}{}
+	for name, id := range f.networks {
+		if nameFilter != "" && name != nameFilter {
+			continue
+		}
+		list = append(list, map[string]interface{}{
+			"id":     id,
+			"name":   name,
+			"status": "ACTIVE",
+		})
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"networks": list})
+}
+
+// volumeJSON renders a volume the way Cinder returns it
+func volumeJSON(volume *fakeVolume) map[string]interface{} {
+	attachments := []interface{}{}
+	if volume.ServerID != "" {
+		attachments = append(attachments, map[string]interface{}{
+			"id":        volume.ID,
+			"volume_id": volume.ID,
+			"server_id": volume.ServerID,
+			"device":    "/dev/vdb",
+		})
+	}
+	return map[string]interface{}{
+		"id":          volume.ID,
+		"name":        volume.Name,
+		"status":      volume.Status,
+		"size":        volume.Size,
+		"volume_type": volume.VolumeType,
+		"metadata":    volume.Metadata,
+		"attachments": attachments,
+		"created_at":  volume.Created.UTC().Format("2006-01-02T15:04:05.000000"),
+	}
+}
+
+// parseFakeMetadataFilter parses the {'key':'value', ...} form gophercloud uses for metadata query parameters
+func parseFakeMetadataFilter(value string) map[string]string {
+	filter := map[string]string{}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "{"), "}")
+	for _, pair := range strings.Split(value, ", ") {
+		key, val, ok := strings.Cut(pair, ":")
+		if ok {
+			filter[strings.Trim(key, "'")] = strings.Trim(val, "'")
+		}
+	}
+	return filter
+}
+
+func (f *fakeOpenStack) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Volume struct {
+			Name       string            `json:"name"`
+			Size       int               `json:"size"`
+			VolumeType string            `json:"volume_type"`
+			Metadata   map[string]string `json:"metadata"`
+		} `json:"volume"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Volume.Size < 1 {
+		writeFakeError(w, http.StatusBadRequest, "size is required")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volume := &fakeVolume{
+		ID:         f.newID("volume"),
+		Name:       req.Volume.Name,
+		Status:     "available",
+		Size:       req.Volume.Size,
+		VolumeType: req.Volume.VolumeType,
+		Metadata:   req.Volume.Metadata,
+		Created:    time.Now(),
+	}
+	f.volumes[volume.ID] = volume
+
+	writeFakeJSON(w, http.StatusAccepted, map[string]interface{}{"volume": volumeJSON(volume)})
+}
+
+func (f *fakeOpenStack) handleListVolumes(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	filter := parseFakeMetadataFilter(r.URL.Query().Get("metadata"))
+	list := []interface{}{}
+	for _, volume := range f.volumes {
+		matches := true
+		for key, value := range filter {
+			if volume.Metadata[key] != value {
+				matches = false
+			}
+		}
+		if matches {
+			list = append(list, volumeJSON(volume))
+		}
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"volumes": list})
+}
+
+func (f *fakeOpenStack) handleGetVolume(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volume, ok := f.volumes[r.PathValue("id")]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Volume could not be found.")
+		return
+	}
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{"volume": volumeJSON(volume)})
+}
+
+func (f *fakeOpenStack) handleDeleteVolume(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := r.PathValue("id")
+	volume, ok := f.volumes[id]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Volume could not be found.")
+		return
+	}
+	if volume.Status != "available" && volume.Status != "error" {
+		writeFakeError(w, http.StatusBadRequest, "Volume status must be available or error.")
+		return
+	}
+	delete(f.volumes, id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeOpenStack) handleAttachVolume(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		VolumeAttachment struct {
+			VolumeID string `json:"volumeId"`
+		} `json:"volumeAttachment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeFakeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	serverID := r.PathValue("id")
+	if _, ok := f.servers[serverID]; !ok {
+		writeFakeError(w, http.StatusNotFound, "Instance could not be found.")
+		return
+	}
+	volume, ok := f.volumes[req.VolumeAttachment.VolumeID]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "Volume could not be found.")
+		return
+	}
+	if volume.Status != "available" {
+		writeFakeError(w, http.StatusBadRequest, "Invalid volume: volume status must be 'available'.")
+		return
+	}
+	volume.ServerID = serverID
+	volume.Status = "in-use"
+
+	writeFakeJSON(w, http.StatusOK, map[string]interface{}{
+		"volumeAttachment": map[string]interface{}{
+			"id":       volume.ID,
+			"volumeId": volume.ID,
+			"serverId": serverID,
+			"device":   "/dev/vdb",
+		},
+	})
+}
+
+func (f *fakeOpenStack) handleDetachVolume(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	volume, ok := f.volumes[r.PathValue("volume")]
+	if !ok || volume.ServerID != r.PathValue("id") {
+		writeFakeError(w, http.StatusNotFound, "Volume attachment could not be found.")
+		return
+	}
+	volume.ServerID = ""
+	volume.Status = "available"
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// useFakeOpenStack points the configuration at the fake and speeds up status polling
+func useFakeOpenStack(t *testing.T) *fakeOpenStack {
+	t.Helper()
+	fake := newFakeOpenStack(t)
+
+	setTestConfigEnv(t)
+	t.Setenv("OS_AUTH_URL", fake.URL()+"/v3")
+	t.Setenv("OS_REGION_NAME", fakeRegion)
+
+	originalInterval := instanceStatusPollInterval
+	instanceStatusPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { instanceStatusPollInterval = originalInterval })
+
+	originalVolumeInterval := volumeStatusPollInterval
+	volumeStatusPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { volumeStatusPollInterval = originalVolumeInterval })
+
+	return fake
+}
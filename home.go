@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// HomeVolumePrefix is the name prefix of persistent home volumes, followed by the local user name
+	HomeVolumePrefix = "tins-home-"
+	// DefaultHomeVolumeSize is the size in GB of home volumes created without --size
+	DefaultHomeVolumeSize = 10
+)
+
+// homeMountPoint returns where create --home mounts the home volume: the home directory of the login user
+func homeMountPoint(loginUser string) string {
+	if loginUser == "root" {
+		return "/root"
+	}
+	return "/home/" + loginUser
+}
+
+// homeVolumeName returns the name of the local user's home volume, e.g. tins-home-alice.
+// Characters that don't belong in a volume name are replaced with dashes.
+func homeVolumeName() (string, error) {
+	user := localUserName()
+	if user == "" {
+		return "", fmt.Errorf("cannot determine the local user name for the home volume")
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '-'
+		}
+	}, user)
+	return HomeVolumePrefix + name, nil
+}
+
+// findHomeVolume looks up a home volume by name
+func findHomeVolume(ctx context.Context, client Provider, name string) (*Volume, error) {
+	volumes, err := client.ListVolumes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range volumes {
+		if _, ok := volumes[i].Metadata[HomeOwnerTag]; ok && volumes[i].Name == name {
+			return &volumes[i], nil
+		}
+	}
+	return nil, fmt.Errorf("home volume %s not found (create it with 'tins home create')", name)
+}
+
+// homeVolumeUser returns the name of the instance that has the home volume attached or is waiting for it,
+// or "" if the volume is free to attach
+func homeVolumeUser(ctx context.Context, client Provider, volume *Volume) (string, error) {
+	instances, err := client.ListInstances(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list instances: %w", err)
+	}
+	for _, instance := range instances {
+		for _, serverID := range volume.ServerIDs {
+			if instance.ID == serverID {
+				return instance.Name, nil
+			}
+		}
+		// An instance created with --home before the volume was attached still owns it
+		if instance.Metadata[HomeVolumeTag] == volume.Name {
+			return instance.Name, nil
+		}
+	}
+	if len(volume.ServerIDs) > 0 {
+		return volume.ServerIDs[0], nil
+	}
+	return "", nil
+}
+
+// detachHomeVolume detaches the home volume from a terminated instance. The volume itself is never deleted.
+// Nova may still list the deleted instance as attached, so anything but an available volume is detached,
+// and DetachVolume waiting for the volume to become available confirms the detach.
+func detachHomeVolume(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	name, ok := instance.Metadata[HomeVolumeTag]
+	if !ok {
+		return
+	}
+	volume, err := findHomeVolume(ctx, client, name)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: Failed to find home volume %s: %v\n", name, err)
+		return
+	}
+	if volume.Status == "available" && len(volume.ServerIDs) == 0 {
+		fmt.Fprintf(out, "Home volume %s detached and kept.\n", name)
+		return
+	}
+	for _, serverID := range volume.ServerIDs {
+		if serverID != instance.ID {
+			fmt.Fprintf(out, "Warning: Home volume %s is attached to %s, not to %s; leaving it alone\n", name, serverID, instance.Name)
+			return
+		}
+	}
+	if err := client.DetachVolume(ctx, instance.ID, volume.ID); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to detach home volume %s (it is kept): %v\n", name, err)
+		return
+	}
+	fmt.Fprintf(out, "Home volume %s detached and kept.\n", name)
+}
+
+var homeCmd = &cobra.Command{
+	Use:   "home",
+	Short: "Manage persistent home volumes",
+	Long:  "Manage the named volumes that 'create --home' mounts at the home directory of the login user (login_user, default ubuntu). Home volumes outlive the instances they are attached to; terminate only detaches them.",
+}
+
+var homeCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create your home volume",
+	Long:  "Create the home volume of the local user, named " + HomeVolumePrefix + "<user>. It is formatted on first use by an instance created with --home.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		size, _ := cmd.Flags().GetInt("size")
+		volumeType, _ := cmd.Flags().GetString("volume-type")
+		if size < 1 {
+			return fmt.Errorf("invalid --size %d", size)
+		}
+		name, err := homeVolumeName()
+		if err != nil {
+			return err
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		if volumeType == "" {
+			volumeType = config.VolumeType
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		if _, err := findHomeVolume(ctx, client, name); err == nil {
+			return fmt.Errorf("home volume %s already exists", name)
+		}
+
+		spec := VolumeSpec{
+			Name:       name,
+			SizeGB:     size,
+			VolumeType: volumeType,
+			Metadata:   map[string]string{HomeOwnerTag: localUserName()},
+		}
+		if _, err := client.CreateVolume(ctx, spec); err != nil {
+			return err
+		}
+		fmt.Printf("Created home volume %s (%s)\n", name, volumeDescription(size, volumeType))
+		return nil
+	},
+}
+
+var homeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List home volumes",
+	Long:  "List the home volumes in the project and the instances they are attached to.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		volumes, err := client.ListVolumes(ctx)
+		if err != nil {
+			return err
+		}
+		instances, err := client.ListInstances(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %w", err)
+		}
+		instanceNames := make(map[string]string, len(instances))
+		for _, instance := range instances {
+			instanceNames[instance.ID] = instance.Name
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tTYPE\tSTATUS\tOWNER\tATTACHED TO\t")
+		fmt.Fprintln(w, "----\t----\t----\t------\t-----\t-----------\t")
+		for _, volume := range volumes {
+			owner, ok := volume.Metadata[HomeOwnerTag]
+			if !ok {
+				continue
+			}
+			var attachedTo []string
+			for _, serverID := range volume.ServerIDs {
+				if name, ok := instanceNames[serverID]; ok {
+					attachedTo = append(attachedTo, name)
+				} else {
+					attachedTo = append(attachedTo, serverID)
+				}
+			}
+			fmt.Fprintf(w, "%s\t%dGB\t%s\t%s\t%s\t%s\t\n",
+				volume.Name,
+				volume.SizeGB,
+				valueOrDash(volume.VolumeType),
+				volume.Status,
+				valueOrDash(owner),
+				valueOrDash(strings.Join(attachedTo, ",")),
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var homeDeleteCmd = &cobra.Command{
+	Use:   "delete <volume-name>",
+	Short: "Delete a home volume",
+	Long:  "Delete a home volume and everything on it. The volume must not be attached to an instance; terminate that instance first.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		volume, err := findHomeVolume(ctx, client, args[0])
+		if err != nil {
+			return err
+		}
+		user, err := homeVolumeUser(ctx, client, volume)
+		if err != nil {
+			return err
+		}
+		if user != "" {
+			return fmt.Errorf("home volume %s is in use by %s; terminate it first", volume.Name, user)
+		}
+
+		if err := client.DeleteVolume(ctx, volume.ID); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted home volume %s\n", volume.Name)
+		return nil
+	},
+}
+
+var homeSnapshotCmd = &cobra.Command{
+	Use:   "snapshot [volume-name]",
+	Short: "Snapshot a home volume",
+	Long:  "Start a Cinder snapshot of a home volume, your own by default. Volumes that are attached are snapshotted as they are, like after a power loss.",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var name string
+		if len(args) > 0 {
+			name = args[0]
+		} else {
+			var err error
+			if name, err = homeVolumeName(); err != nil {
+				return err
+			}
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		volume, err := findHomeVolume(ctx, client, name)
+		if err != nil {
+			return err
+		}
+		snapshotName := fmt.Sprintf("%s-%s", volume.Name, time.Now().UTC().Format("20060102-150405"))
+		snapshotID, err := client.CreateVolumeSnapshot(ctx, volume.ID, snapshotName)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Started snapshot %s (ID: %s) of home volume %s\n", snapshotName, snapshotID, volume.Name)
+		return nil
+	},
+}
+
+func init() {
+	homeCreateCmd.Flags().Int("size", DefaultHomeVolumeSize, "Size of the home volume in GB")
+	homeCreateCmd.Flags().String("volume-type", "", "Cinder volume type of the home volume (overrides volume_type in config)")
+	homeCmd.AddCommand(homeCreateCmd)
+	homeCmd.AddCommand(homeListCmd)
+	homeCmd.AddCommand(homeDeleteCmd)
+	homeCmd.AddCommand(homeSnapshotCmd)
+	rootCmd.AddCommand(homeCmd)
+}
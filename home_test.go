@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHomeVolumeName(t *testing.T) {
+	name, err := homeVolumeName()
+	if err != nil {
+		t.Fatalf("homeVolumeName failed: %v", err)
+	}
+	suffix := strings.TrimPrefix(name, HomeVolumePrefix)
+	if suffix == name || suffix == "" || strings.Trim(suffix, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+		t.Errorf("Expected %s followed by a sanitized user name, got %q", HomeVolumePrefix, name)
+	}
+}
+
+func TestHomeCreateListDelete(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, homeCreateCmd)
+	name, err := homeVolumeName()
+	if err != nil {
+		t.Fatalf("homeVolumeName failed: %v", err)
+	}
+
+	if _, err := runCommand(t, "home", "create", "--size", "25", "--volume-type", "ssd"); err != nil {
+		t.Fatalf("home create failed: %v", err)
+	}
+	volume, err := findHomeVolume(t.Context(), provider, name)
+	if err != nil {
+		t.Fatalf("findHomeVolume failed: %v", err)
+	}
+	if volume.SizeGB != 25 || volume.VolumeType != "ssd" || volume.Metadata[HomeOwnerTag] != localUserName() {
+		t.Errorf("Expected a 25GB ssd volume owned by the local user, got %+v", volume)
+	}
+	if _, err := runCommand(t, "home", "create"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected a second home create to fail, got %v", err)
+	}
+
+	output, err := runCommand(t, "home", "list")
+	if err != nil {
+		t.Fatalf("home list failed: %v", err)
+	}
+	if !strings.Contains(output, name) || !strings.Contains(output, "25GB") {
+		t.Errorf("Expected home list to show %s, got:\n%s", name, output)
+	}
+
+	output, err = runCommand(t, "home", "snapshot")
+	if err != nil {
+		t.Fatalf("home snapshot failed: %v", err)
+	}
+	if len(provider.volumeSnapshots) != 1 || !strings.Contains(output, "Started snapshot "+name+"-") {
+		t.Errorf("Expected a snapshot of %s, got %v:\n%s", name, provider.volumeSnapshots, output)
+	}
+
+	if _, err := runCommand(t, "home", "delete", "tins-home-nobody"); err == nil {
+		t.Error("Expected deleting an unknown home volume to fail")
+	}
+	if _, err := runCommand(t, "home", "delete", name); err != nil {
+		t.Fatalf("home delete failed: %v", err)
+	}
+	if len(provider.volumes) != 0 {
+		t.Errorf("Expected the home volume to be deleted, got %v", provider.volumes)
+	}
+}
+
+func TestCreateTerminate_Home(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+	resetFlagsAfterTest(t, terminateCmd)
+	name, err := homeVolumeName()
+	if err != nil {
+		t.Fatalf("homeVolumeName failed: %v", err)
+	}
+
+	if _, err := runCommand(t, "create", "early", "--home"); err == nil || !strings.Contains(err.Error(), "tins home create") {
+		t.Errorf("Expected create --home without a home volume to fail, got %v", err)
+	}
+	if _, err := runCommand(t, "home", "create"); err != nil {
+		t.Fatalf("home create failed: %v", err)
+	}
+
+	output, err := runCommand(t, "create", "dev", "--home")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	instance, err := findInstance(t.Context(), provider, "dev")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	volume, err := findHomeVolume(t.Context(), provider, name)
+	if err != nil {
+		t.Fatalf("findHomeVolume failed: %v", err)
+	}
+	if len(volume.ServerIDs) != 1 || volume.ServerIDs[0] != instance.ID || instance.Metadata[HomeVolumeTag] != name {
+		t.Errorf("Expected the home volume to be attached to and recorded on the instance, got %+v, %v", volume, instance.Metadata)
+	}
+	userData := string(createdSpec(t, provider, "tins-dev").UserData)
+	if !strings.Contains(userData, "mount_home '"+volume.ID+"' '/home/ubuntu' 'ubuntu'") {
+		t.Errorf("Expected user-data to mount the home volume, got:\n%s", userData)
+	}
+
+	// The same home volume is never attached to two instances
+	if _, err := runCommand(t, "create", "other", "--home"); err == nil || !strings.Contains(err.Error(), "in use by tins-dev") {
+		t.Errorf("Expected a second create --home to fail, got %v", err)
+	}
+	if _, err := runCommand(t, "home", "delete", name); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("Expected deleting an attached home volume to fail, got %v", err)
+	}
+
+	output, err = runCommand(t, "terminate", "dev")
+	if err != nil {
+		t.Fatalf("terminate command failed: %v\n%s", err, output)
+	}
+	volume, err = findHomeVolume(t.Context(), provider, name)
+	if err != nil {
+		t.Fatalf("Expected terminate to keep the home volume: %v", err)
+	}
+	if len(volume.ServerIDs) != 0 || !strings.Contains(output, "detached and kept") {
+		t.Errorf("Expected terminate to detach the home volume, got %+v:\n%s", volume, output)
+	}
+
+	// The volume can be reused, and terminate --all keeps it as well
+	if _, err := runCommand(t, "create", "again", "--home"); err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	if _, err := findHomeVolume(t.Context(), provider, name); err != nil {
+		t.Errorf("Expected terminate --all to keep the home volume: %v", err)
+	}
+
+	// Images with another login user get the home volume at that user's home directory
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte("login_user: debian\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	output, err = runCommand(t, "create", "bookworm", "--home")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	userData = string(createdSpec(t, provider, "tins-bookworm").UserData)
+	if !strings.Contains(userData, "mount_home '"+volume.ID+"' '/home/debian' 'debian'") || !strings.Contains(output, "debian@") {
+		t.Errorf("Expected the home volume and ssh hint to use login_user, got:\n%s\n%s", userData, output)
+	}
+}
+
+// failingDetachProvider is a fakeProvider that cannot detach volumes
+type failingDetachProvider struct {
+	*fakeProvider
+}
+
+func (p failingDetachProvider) DetachVolume(context.Context, string, string) error {
+	return fmt.Errorf("timeout waiting for volume to become available")
+}
+
+func TestDetachHomeVolume(t *testing.T) {
+	ctx := t.Context()
+	provider := newFakeProvider()
+	created, err := provider.CreateVolume(ctx, VolumeSpec{Name: "tins-home-alice", SizeGB: 10, Metadata: map[string]string{HomeOwnerTag: "alice"}})
+	if err != nil {
+		t.Fatalf("CreateVolume failed: %v", err)
+	}
+	volume := provider.volumes[created.ID]
+	instance := &Instance{ID: "id-gone", Name: "tins-gone", Metadata: map[string]string{HomeVolumeTag: volume.Name}}
+
+	// Nova may still list a deleted instance as attached; success is only reported once the detach went through
+	volume.ServerIDs = []string{instance.ID}
+	volume.Status = "in-use"
+	var out strings.Builder
+	detachHomeVolume(ctx, failingDetachProvider{provider}, instance, &out)
+	if strings.Contains(out.String(), "detached and kept") || !strings.Contains(out.String(), "Failed to detach home volume") {
+		t.Errorf("Expected a failed detach to be reported as such, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	detachHomeVolume(ctx, provider, instance, &out)
+	if len(volume.ServerIDs) != 0 || volume.Status != "available" || !strings.Contains(out.String(), "detached and kept") {
+		t.Errorf("Expected the stale attachment to be detached, got %+v:\n%s", volume, out.String())
+	}
+
+	// A volume attached to another instance is not touched
+	volume.ServerIDs = []string{"id-other"}
+	volume.Status = "in-use"
+	out.Reset()
+	detachHomeVolume(ctx, provider, instance, &out)
+	if len(volume.ServerIDs) != 1 || strings.Contains(out.String(), "detached and kept") {
+		t.Errorf("Expected a volume attached elsewhere to be left alone, got %+v:\n%s", volume, out.String())
+	}
+}
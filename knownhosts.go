@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	// hostKeysBeginMarker and hostKeysEndMarker surround the host keys cloud-init prints to the console
+	hostKeysBeginMarker = "-----BEGIN SSH HOST KEY KEYS-----"
+	hostKeysEndMarker   = "-----END SSH HOST KEY KEYS-----"
+	// hostKeyWaitTimeout bounds how long create waits for cloud-init to print the host keys
+	hostKeyWaitTimeout = 5 * time.Minute
+	// knownHostsFileName is the tins-managed known_hosts file in ~/.ssh
+	knownHostsFileName = "tins_known_hosts"
+)
+
+// hostKeyPollInterval is how often the console log is checked for host keys. Tests shorten it.
+var hostKeyPollInterval = 10 * time.Second
+
+// knownHostsPath returns the path of the tins-managed known_hosts file
+func knownHostsPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh", knownHostsFileName)
+}
+
+// parseConsoleHostKeys extracts the host keys from the last cloud-init host key block in a console log.
+// Console lines may carry prefixes such as "ec2: " or kernel timestamps, so each line is searched for a key.
+func parseConsoleHostKeys(consoleOutput string) []ssh.PublicKey {
+	begin := strings.LastIndex(consoleOutput, hostKeysBeginMarker)
+	if begin < 0 {
+		return nil
+	}
+	block := consoleOutput[begin+len(hostKeysBeginMarker):]
+	end := strings.Index(block, hostKeysEndMarker)
+	if end < 0 {
+		// The block is still being written
+		return nil
+	}
+
+	var keys []ssh.PublicKey
+	for _, line := range strings.Split(block[:end], "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[i] + " " + fields[i+1]))
+			if err == nil && key.Type() == fields[i] {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// waitForHostKeys polls the console log until cloud-init has printed the instance's host keys
+func waitForHostKeys(ctx context.Context, client Provider, instanceID string, timeout time.Duration) ([]ssh.PublicKey, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := client.GetConsoleOutput(ctx, instanceID)
+		if err != nil {
+			return nil, err
+		}
+		if keys := parseConsoleHostKeys(output); len(keys) > 0 {
+			return keys, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for host keys in the console log")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(hostKeyPollInterval):
+		}
+	}
+}
+
+// recordHostKeys stores an instance's host keys in the tins known_hosts file under its name and addresses.
+// Entries left behind for the same name or addresses, e.g. by an earlier instance that had the same IP, are replaced.
+func recordHostKeys(instanceName string, addresses []string, keys []ssh.PublicKey) error {
+	hosts := append([]string{instanceName}, addresses...)
+	lines, err := readKnownHosts(func(entryHosts []string) bool {
+		for _, host := range hosts {
+			if containsHost(entryHosts, host) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	normalized := make([]string, len(hosts))
+	for i, host := range hosts {
+		normalized[i] = knownhosts.Normalize(host)
+	}
+	for _, key := range keys {
+		lines = append(lines, knownhosts.Line(normalized, key))
+	}
+	return writeKnownHosts(lines)
+}
+
+// removeHostKeys deletes the known_hosts entries recorded for an instance and reports whether any were removed
+func removeHostKeys(instanceName string) (bool, error) {
+	removed := false
+	lines, err := readKnownHosts(func(entryHosts []string) bool {
+		if containsHost(entryHosts, instanceName) {
+			removed = true
+			return false
+		}
+		return true
+	})
+	if err != nil || !removed {
+		return false, err
+	}
+	return true, writeKnownHosts(lines)
+}
+
+// recordedHostKeys returns the host keys recorded for an instance
+func recordedHostKeys(instanceName string) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	lines, _ := readKnownHosts(func(entryHosts []string) bool {
+		return containsHost(entryHosts, instanceName)
+	})
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || !containsHost(strings.Split(fields[0], ","), instanceName) {
+			continue
+		}
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(fields[1] + " " + fields[2])); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// instanceHostKeyCallback verifies host keys against the entries recorded for an instance in the
+// tins known_hosts file. Entries are looked up by instance name, so they still apply if its address changes.
+// It returns a nil callback when no host keys have been recorded for the instance.
+func instanceHostKeyCallback(instanceName string) (ssh.HostKeyCallback, []string, error) {
+	keys := recordedHostKeys(instanceName)
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	callback, err := knownhosts.New(knownHostsPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", knownHostsPath(), err)
+	}
+	hostname := net.JoinHostPort(instanceName, strconv.Itoa(DefaultSSHPort))
+	return func(_ string, remote net.Addr, key ssh.PublicKey) error {
+		if err := callback(hostname, remote, key); err != nil {
+			return fmt.Errorf("host key of %s does not match the key recorded in %s: %w", instanceName, knownHostsPath(), err)
+		}
+		return nil
+	}, hostKeyAlgorithms(keys), nil
+}
+
+// trustOnFirstUseCallback verifies host keys against the entries recorded for host in the tins known_hosts file.
+// A host without recorded keys is trusted on first use: its key is recorded and its fingerprint printed with a warning.
+func trustOnFirstUseCallback(host string) ssh.HostKeyCallback {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		recorded := recordedHostKeys(host)
+		for _, known := range recorded {
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return nil
+			}
+		}
+		if len(recorded) > 0 {
+			return fmt.Errorf("host key of %s (%s) does not match the key recorded in %s", host, ssh.FingerprintSHA256(key), knownHostsPath())
+		}
+
+		fmt.Fprintf(os.Stderr, "Warning: No host key recorded for %s, trusting %s key %s on first use\n", host, key.Type(), ssh.FingerprintSHA256(key))
+		if err := recordHostKeys(host, nil, []ssh.PublicKey{key}); err != nil {
+			return fmt.Errorf("failed to record host key of %s: %w", host, err)
+		}
+		return nil
+	}
+}
+
+// readKnownHosts returns the lines of the tins known_hosts file for which keep returns true.
+// Comments, blank lines and lines that aren't host entries are always kept.
+func readKnownHosts(keep func(hosts []string) bool) ([]string, error) {
+	data, err := os.ReadFile(knownHostsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			lines = append(lines, line)
+			continue
+		}
+		if keep(strings.Split(fields[0], ",")) {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	return lines, nil
+}
+
+// writeKnownHosts replaces the contents of the tins known_hosts file
+func writeKnownHosts(lines []string) error {
+	path := knownHostsPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create .ssh directory: %w", err)
+	}
+
+	content := strings.Join(lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return nil
+}
+
+// containsHost reports whether a known_hosts host list names host
+func containsHost(hosts []string, host string) bool {
+	normalized := knownhosts.Normalize(host)
+	for _, entry := range hosts {
+		if entry == host || entry == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// hostKeyAlgorithms lists the host key algorithms to negotiate so the server presents one of the recorded keys
+func hostKeyAlgorithms(keys []ssh.PublicKey) []string {
+	var algorithms []string
+	for _, key := range keys {
+		if key.Type() == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, key.Type())
+	}
+	return algorithms
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestParseConsoleHostKeys(t *testing.T) {
+	first, second := newFakeHostKey(), newFakeHostKey()
+
+	keys := parseConsoleHostKeys(fakeConsoleOutput(first))
+	if len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), first.Marshal()) {
+		t.Fatalf("Expected the host key from the console log, got %v", keys)
+	}
+
+	// After a reboot the last block wins
+	keys = parseConsoleHostKeys(fakeConsoleOutput(first) + fakeConsoleOutput(second))
+	if len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), second.Marshal()) {
+		t.Errorf("Expected the host key from the last block, got %v", keys)
+	}
+
+	// Timestamps and other prefixes in front of the keys are skipped
+	prefixed := strings.ReplaceAll(fakeConsoleOutput(first), "ssh-ed25519", "[   42.000000] cloud-init[812]: ssh-ed25519")
+	if keys := parseConsoleHostKeys(prefixed); len(keys) != 1 {
+		t.Errorf("Expected a key behind a console prefix, got %v", keys)
+	}
+
+	// A block that hasn't been completely written yet is ignored
+	incomplete := strings.Split(fakeConsoleOutput(first), hostKeysEndMarker)[0]
+	if keys := parseConsoleHostKeys(incomplete); keys != nil {
+		t.Errorf("Expected no keys from an incomplete block, got %v", keys)
+	}
+	if keys := parseConsoleHostKeys("[    1.0] Booting\n"); keys != nil {
+		t.Errorf("Expected no keys without a host key block, got %v", keys)
+	}
+}
+
+func TestRecordHostKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	oldKey, newKey := newFakeHostKey(), newFakeHostKey()
+
+	if err := recordHostKeys("tins-old", []string{"10.0.0.5"}, []ssh.PublicKey{oldKey}); err != nil {
+		t.Fatalf("recordHostKeys failed: %v", err)
+	}
+	if keys := recordedHostKeys("tins-old"); len(keys) != 1 {
+		t.Fatalf("Expected one recorded key, got %v", keys)
+	}
+
+	// A new instance that reuses the IP replaces the stale entry
+	if err := recordHostKeys("tins-new", []string{"10.0.0.5"}, []ssh.PublicKey{newKey}); err != nil {
+		t.Fatalf("recordHostKeys failed: %v", err)
+	}
+	if keys := recordedHostKeys("tins-old"); len(keys) != 0 {
+		t.Errorf("Expected the stale entry for the reused IP to be replaced, got %v", keys)
+	}
+
+	callback, algorithms, err := instanceHostKeyCallback("tins-new")
+	if err != nil || callback == nil {
+		t.Fatalf("Expected a host key callback, got %v", err)
+	}
+	if len(algorithms) != 1 || algorithms[0] != ssh.KeyAlgoED25519 {
+		t.Errorf("Expected ed25519 host key algorithm, got %v", algorithms)
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 22}
+	if err := callback("10.0.0.9:22", remote, newKey); err != nil {
+		t.Errorf("Expected the recorded key to be accepted even on a new address: %v", err)
+	}
+	if err := callback("10.0.0.9:22", remote, oldKey); err == nil {
+		t.Error("Expected a different host key to be rejected")
+	}
+
+	removed, err := removeHostKeys("tins-new")
+	if err != nil || !removed {
+		t.Fatalf("Expected host keys to be removed, got %v, %v", removed, err)
+	}
+	if callback, _, _ := instanceHostKeyCallback("tins-new"); callback != nil {
+		t.Error("Expected no host key callback once the keys are removed")
+	}
+	if data, _ := os.ReadFile(knownHostsPath()); len(data) != 0 {
+		t.Errorf("Expected an empty known_hosts file, got %q", data)
+	}
+}
+
+func TestCreateTerminate_RecordsHostKeys(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	output, err := runCommand(t, "create", "verified")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+
+	var consoleHostKeys []ssh.PublicKey
+	for _, console := range provider.consoleOutput {
+		consoleHostKeys = parseConsoleHostKeys(console)
+	}
+	keys := recordedHostKeys("tins-verified")
+	if len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), consoleHostKeys[0].Marshal()) {
+		t.Fatalf("Expected the console host key to be recorded, got %v", keys)
+	}
+
+	instance, err := findInstance(t.Context(), provider, "verified")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	target, err := sshTargetForInstance(instance, "root", &OpenStackConfig{})
+	if err != nil {
+		t.Fatalf("sshTargetForInstance failed: %v", err)
+	}
+	if target.HostKeyCallback == nil {
+		t.Error("Expected connect to verify the recorded host key")
+	}
+
+	if _, err := runCommand(t, "terminate", "verified"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	if keys := recordedHostKeys("tins-verified"); len(keys) != 0 {
+		t.Errorf("Expected terminate to remove the host keys, got %v", keys)
+	}
+}
+
+func TestTrustOnFirstUseCallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	firstKey, otherKey := newFakeHostKey(), newFakeHostKey()
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 22}
+
+	callback := trustOnFirstUseCallback("tins-fresh")
+	if err := callback("10.0.0.5:22", remote, firstKey); err != nil {
+		t.Fatalf("Expected the first host key to be trusted: %v", err)
+	}
+	if keys := recordedHostKeys("tins-fresh"); len(keys) != 1 || !bytes.Equal(keys[0].Marshal(), firstKey.Marshal()) {
+		t.Fatalf("Expected the first host key to be recorded, got %v", keys)
+	}
+
+	if err := callback("10.0.0.5:22", remote, firstKey); err != nil {
+		t.Errorf("Expected the recorded host key to be accepted: %v", err)
+	}
+	if err := trustOnFirstUseCallback("tins-fresh")("10.0.0.5:22", remote, otherKey); err == nil {
+		t.Error("Expected a host key that doesn't match the recorded one to be rejected")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -14,47 +15,89 @@ var listCmd = &cobra.Command{
 	Short: "List all temporary instances",
 	Long:  "List all ephemeral OpenStack instances tagged as temporary instances.",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+
 		// Load configuration
 		config, err := LoadConfig()
 		if err != nil {
 			return err
 		}
 
-		// Create OpenStack client
+		// Create provider client
 		ctx := context.Background()
-		client, err := NewOpenStackClient(ctx, config)
+		client, err := newProvider(ctx, config)
 		if err != nil {
-			return fmt.Errorf("failed to create OpenStack client: %w", err)
+			return err
 		}
 
 		// List instances
-		servers, err := client.ListInstances(ctx)
+		instances, err := client.ListInstances(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to list instances: %w", err)
 		}
 
-		if len(servers) == 0 {
+		if isStructuredOutput(format) {
+			output := make([]InstanceOutput, 0, len(instances))
+			for i := range instances {
+				output = append(output, newInstanceOutput(&instances[i]))
+			}
+			return writeStructured(os.Stdout, format, output)
+		}
+
+		if len(instances) == 0 {
 			fmt.Println("No temporary instances found.")
 			return nil
 		}
 
-		// Display instances in a table
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCREATED\t")
-		fmt.Fprintln(w, "---\t----\t------\t-------\t")
-
-		for _, server := range servers {
-			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n",
-				server.ID,
-				server.Name,
-				server.Status,
-				server.Created.Format("2006-01-02 15:04:05"),
+		printInstanceTable(instances, format == OutputWide)
+		return nil
+	},
+}
+
+// printInstanceTable displays instances in a table; wide adds network, flavor, image, boot volume and key columns
+func printInstanceTable(instances []Instance, wide bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	if wide {
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCREATED\tEXPIRES IN\tIP\tFLAVOR\tIMAGE\tBOOT VOLUME\tKEY\t")
+		fmt.Fprintln(w, "---\t----\t------\t-------\t----------\t--\t------\t-----\t-----------\t---\t")
+	} else {
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tCREATED\tEXPIRES IN\t")
+		fmt.Fprintln(w, "---\t----\t------\t-------\t----------\t")
+	}
+
+	now := time.Now()
+	for _, instance := range instances {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t",
+			instance.ID,
+			instance.Name,
+			instance.Status,
+			instance.Created.Format("2006-01-02 15:04:05"),
+			formatRemaining(&instance, now),
+		)
+		if wide {
+			output := newInstanceOutput(&instance)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t",
+				valueOrDash(output.IP),
+				valueOrDash(output.FlavorID),
+				valueOrDash(output.ImageID),
+				valueOrDash(output.BootVolume),
+				valueOrDash(output.PrivateKeyPath),
 			)
 		}
-		w.Flush()
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+}
 
-		return nil
-	},
+// valueOrDash returns "-" for empty table cells
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
 }
 
 func init() {
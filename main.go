@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -19,6 +20,32 @@ const (
 	InstanceNamePrefix = "tins-"
 	// TempInstanceTag is the metadata tag used to identify temporary instances
 	TempInstanceTag = "tins"
+	// ExpiresAtTag is the metadata key holding the RFC 3339 expiry time of an instance with a TTL
+	ExpiresAtTag = "tins_expires_at"
+	// KeypairTag is the metadata key naming the shared keypair of an instance created with the user's own public key
+	KeypairTag = "tins_keypair"
+	// SSHCATag is the metadata key holding the fingerprint of the SSH CA an instance trusts for user certificates
+	SSHCATag = "tins_ssh_ca"
+	// HostCertTag is the metadata key holding the fingerprint of the SSH CA that signed an instance's host key
+	HostCertTag = "tins_host_cert"
+	// FloatingIPTag is the metadata key holding the ID of the floating IP allocated for an instance
+	FloatingIPTag = "tins_floating_ip"
+	// NetworkTag is the metadata key holding the ID of the network tins created for an instance
+	NetworkTag = "tins_network"
+	// SecurityGroupTag is the metadata key naming the security group tins created for an instance
+	SecurityGroupTag = "tins_security_group"
+	// BootVolumeTag is the metadata key describing the volume an instance boots from, e.g. "100GB (ssd)"
+	BootVolumeTag = "tins_boot_volume"
+	// VolumeInstanceTag is the volume metadata key naming the instance a data volume was created for
+	VolumeInstanceTag = "tins_instance"
+	// HomeVolumeTag is the metadata key naming the home volume attached to an instance
+	HomeVolumeTag = "tins_home_volume"
+	// HomeOwnerTag is the volume metadata key marking a persistent home volume, holding its owner's user name
+	HomeOwnerTag = "tins_home"
+	// SnapshotTag is the image tag marking snapshots created by tins snapshot
+	SnapshotTag = "tins-snapshot"
+	// SnapshotSourceTag is the image property holding the name of the instance a snapshot was taken of
+	SnapshotSourceTag = "tins_snapshot_of"
 )
 
 var rootCmd = &cobra.Command{
@@ -36,7 +63,15 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+// shortInstanceName strips the tins- prefix from a full instance name
+func shortInstanceName(fullName string) string {
+	return strings.TrimPrefix(fullName, InstanceNamePrefix)
+}
+
 func init() {
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "Config file profile to use (overrides TINS_PROFILE and default_profile)")
+	rootCmd.PersistentFlags().StringVar(&osCloudFlag, "os-cloud", "", "Named cloud from clouds.yaml to authenticate with (overrides OS_CLOUD)")
+	rootCmd.PersistentFlags().StringP("output", "o", OutputTable, "Output format: table, wide, json or yaml")
 	rootCmd.AddCommand(versionCmd)
 }
 
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+const (
+	// NetworkModeExisting attaches instances to the configured network as is (default)
+	NetworkModeExisting = "existing_network"
+	// NetworkModeFloatingIP also gives each instance a floating IP from floating_ip_pool
+	NetworkModeFloatingIP = "floating_ip"
+	// NetworkModeNewNetwork boots each instance on its own network, subnet and router
+	NetworkModeNewNetwork = "new_network"
+
+	// DefaultSubnetCIDR is the address range of per-instance subnets
+	DefaultSubnetCIDR = "192.168.42.0/24"
+)
+
+// parseNetworkAttachmentMode validates a network_attachment_mode / OS_NETWORK_ATTACHMENT_MODE value
+func parseNetworkAttachmentMode(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", NetworkModeExisting:
+		return NetworkModeExisting, nil
+	case NetworkModeFloatingIP, NetworkModeNewNetwork:
+		return strings.ToLower(value), nil
+	default:
+		return "", fmt.Errorf("invalid network attachment mode '%s' (must be one of: %s, %s, %s)", value, NetworkModeExisting, NetworkModeFloatingIP, NetworkModeNewNetwork)
+	}
+}
+
+// validateSubnet checks subnet_cidr and dns_nameservers
+func validateSubnet(cidr string, nameservers []string) error {
+	if _, _, err := net.ParseCIDR(cidr); err != nil {
+		return fmt.Errorf("invalid subnet_cidr '%s': %w", cidr, err)
+	}
+	for _, nameserver := range nameservers {
+		if net.ParseIP(nameserver) == nil {
+			return fmt.Errorf("invalid dns_nameservers entry '%s'", nameserver)
+		}
+	}
+	return nil
+}
+
+// floatingIPPool returns the external network floating IPs are allocated from. Instances on their own
+// network are reached through a floating IP on the router's external network unless a pool is configured.
+func floatingIPPool(config *OpenStackConfig) string {
+	if config.FloatingIPPool != "" {
+		return config.FloatingIPPool
+	}
+	return config.ExternalNetwork
+}
+
+// attachFloatingIP allocates a floating IP for an active instance and records it in the instance metadata
+// so terminate can release it. The address is released again if it cannot be recorded.
+func attachFloatingIP(ctx context.Context, client Provider, instance *Instance, pool string) (*FloatingIP, error) {
+	floatingIP, err := client.AllocateFloatingIP(ctx, instance.ID, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.UpdateInstanceMetadata(ctx, instance.ID, map[string]string{FloatingIPTag: floatingIP.ID}); err != nil {
+		if releaseErr := client.ReleaseFloatingIP(ctx, floatingIP.ID); releaseErr != nil {
+			return nil, fmt.Errorf("failed to record floating IP %s (%w) and to release it: %v", floatingIP.Address, err, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to record floating IP: %w", err)
+	}
+	return floatingIP, nil
+}
+
+// addFloatingAddress adds a floating IP to the instance's addresses unless the cloud already reports it
+func addFloatingAddress(instance *Instance, network, address string) {
+	for _, existing := range instance.Addresses {
+		if existing.Addr == address {
+			return
+		}
+	}
+	instance.Addresses = append(instance.Addresses, InstanceAddress{Network: network, Addr: address, Type: "floating"})
+}
+
+// releaseInstanceFloatingIP releases the floating IP allocated for an instance, if it has one
+func releaseInstanceFloatingIP(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	floatingIPID, ok := instance.Metadata[FloatingIPTag]
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(out, "Releasing floating IP %s...\n", floatingIPID)
+	if err := client.ReleaseFloatingIP(ctx, floatingIPID); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to release floating IP (it may already be gone): %v\n", err)
+	} else {
+		fmt.Fprintf(out, "Floating IP released.\n")
+	}
+}
+
+// releaseOrphanedFloatingIPs releases tins floating IPs that no longer belong to an instance,
+// e.g. after a failed create. Floating IPs of the instances in keep are left alone.
+func releaseOrphanedFloatingIPs(ctx context.Context, client Provider, keep map[string]bool, out io.Writer) error {
+	floatingIPs, err := client.ListFloatingIPs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, floatingIP := range floatingIPs {
+		if keep[floatingIP.ID] {
+			continue
+		}
+		if err := client.ReleaseFloatingIP(ctx, floatingIP.ID); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to release floating IP %s: %v\n", floatingIP.Address, err)
+			continue
+		}
+		fmt.Fprintf(out, "Released orphaned floating IP %s.\n", floatingIP.Address)
+	}
+	return nil
+}
+
+// deleteInstanceNetwork tears down the network tins created for an instance, if it has one
+func deleteInstanceNetwork(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	if _, ok := instance.Metadata[NetworkTag]; !ok {
+		return
+	}
+
+	fmt.Fprintf(out, "Deleting network, subnet and router %s...\n", instance.Name)
+	if err := client.DeleteInstanceNetwork(ctx, instance.Name); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to delete instance network: %v\n", err)
+	} else {
+		fmt.Fprintf(out, "Instance network deleted.\n")
+	}
+}
+
+// deleteOrphanedNetworks deletes tins instance networks whose instance is gone.
+// Networks of the instances in keep are left alone.
+func deleteOrphanedNetworks(ctx context.Context, client Provider, keep map[string]bool, out io.Writer) error {
+	names, err := client.ListInstanceNetworks(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if keep[name] {
+			continue
+		}
+		if err := client.DeleteInstanceNetwork(ctx, name); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to delete network %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted orphaned network %s.\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNetworkAttachmentMode(t *testing.T) {
+	for value, want := range map[string]string{"": NetworkModeExisting, "existing_network": NetworkModeExisting, "Floating_IP": NetworkModeFloatingIP} {
+		mode, err := parseNetworkAttachmentMode(value)
+		if err != nil || mode != want {
+			t.Errorf("parseNetworkAttachmentMode(%q) = %q, %v; expected %q", value, mode, err, want)
+		}
+	}
+	if _, err := parseNetworkAttachmentMode("public"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestLoadConfig_FloatingIPPoolRequired(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_NETWORK_ATTACHMENT_MODE", "floating_ip")
+	t.Setenv("OS_FLOATING_IP_POOL", "")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "floating_ip_pool") {
+		t.Errorf("Expected an error about the missing pool, got %v", err)
+	}
+
+	t.Setenv("OS_FLOATING_IP_POOL", "public")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.NetworkAttachmentMode != NetworkModeFloatingIP || config.FloatingIPPool != "public" {
+		t.Errorf("Expected floating_ip mode with pool 'public', got %q, %q", config.NetworkAttachmentMode, config.FloatingIPPool)
+	}
+}
+
+func TestCreateTerminate_FloatingIP(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_NETWORK_ATTACHMENT_MODE", "floating_ip")
+	t.Setenv("OS_FLOATING_IP_POOL", "public")
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, terminateCmd)
+
+	output, err := runCommand(t, "create", "public")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	if len(provider.floatingIPs) != 1 {
+		t.Fatalf("Expected one floating IP, got %v", provider.floatingIPs)
+	}
+	var floatingIP FloatingIP
+	for _, allocated := range provider.floatingIPs {
+		floatingIP = *allocated
+	}
+	if !strings.Contains(output, "ubuntu@"+floatingIP.Address) {
+		t.Errorf("Expected the ssh hint to use the floating IP %s, got:\n%s", floatingIP.Address, output)
+	}
+
+	instance, err := findInstance(t.Context(), provider, "public")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	if instance.Metadata[FloatingIPTag] != floatingIP.ID {
+		t.Errorf("Expected the floating IP to be recorded in metadata, got %v", instance.Metadata)
+	}
+	target, err := sshTargetForInstance(instance, "root", &OpenStackConfig{})
+	if err != nil {
+		t.Fatalf("sshTargetForInstance failed: %v", err)
+	}
+	if target.Host != floatingIP.Address {
+		t.Errorf("Expected connect to use the floating IP, got %s", target.Host)
+	}
+
+	if _, err := runCommand(t, "terminate", "public"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	if len(provider.floatingIPs) != 0 {
+		t.Errorf("Expected terminate to release the floating IP, got %v", provider.floatingIPs)
+	}
+
+	// terminate --all also releases addresses that lost their instance
+	provider.floatingIPs["fip-orphan"] = &FloatingIP{ID: "fip-orphan", Address: "203.0.113.99"}
+	output, err = runCommand(t, "terminate", "--all")
+	if err != nil {
+		t.Fatalf("terminate --all failed: %v\n%s", err, output)
+	}
+	if len(provider.floatingIPs) != 0 {
+		t.Errorf("Expected terminate --all to release orphaned floating IPs, got %v", provider.floatingIPs)
+	}
+}
+
+func TestLoadConfig_NewNetwork(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_NETWORK_ATTACHMENT_MODE", "new_network")
+	t.Setenv("OS_NETWORK_NAME", "")
+	t.Setenv("OS_EXTERNAL_NETWORK", "")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "external_network") {
+		t.Errorf("Expected an error about the missing external network, got %v", err)
+	}
+
+	t.Setenv("OS_EXTERNAL_NETWORK", "public")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected new_network mode to work without a network name: %v", err)
+	}
+	if config.SubnetCIDR != DefaultSubnetCIDR || floatingIPPool(config) != "public" {
+		t.Errorf("Expected default CIDR and the external network as pool, got %q, %q", config.SubnetCIDR, floatingIPPool(config))
+	}
+
+	if err := validateSubnet("10.1.0.0/33", nil); err == nil {
+		t.Error("Expected an error for an invalid CIDR")
+	}
+	if err := validateSubnet("10.1.0.0/24", []string{"1.1.1.1", "dns.example.com"}); err == nil {
+		t.Error("Expected an error for a nameserver that isn't an IP")
+	}
+}
+
+func TestCreateTerminate_NewNetwork(t *testing.T) {
+	setTestConfigEnv(t)
+	t.Setenv("OS_NETWORK_ATTACHMENT_MODE", "new_network")
+	t.Setenv("OS_EXTERNAL_NETWORK", "public")
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, terminateCmd)
+
+	content := "subnet_cidr: 10.99.0.0/24\ndns_nameservers: [\"9.9.9.9\"]\n"
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	output, err := runCommand(t, "create", "isolated")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	network, ok := provider.networks["tins-isolated"]
+	if !ok {
+		t.Fatalf("Expected an instance network, got %v", provider.networks)
+	}
+	if network.CIDR != "10.99.0.0/24" || len(network.DNSNameservers) != 1 || network.ExternalNetwork != "public" {
+		t.Errorf("Expected the configured subnet settings, got %+v", network)
+	}
+	var spec InstanceSpec
+	for _, created := range provider.specs {
+		spec = created
+	}
+	if spec.NetworkID != "net-tins-isolated" || spec.Metadata[NetworkTag] != spec.NetworkID {
+		t.Errorf("Expected the instance to boot on its network, got %q, %v", spec.NetworkID, spec.Metadata)
+	}
+	if len(provider.floatingIPs) != 1 {
+		t.Errorf("Expected a floating IP to reach the instance, got %v", provider.floatingIPs)
+	}
+
+	if _, err := runCommand(t, "terminate", "isolated"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	if len(provider.networks) != 0 || len(provider.floatingIPs) != 0 {
+		t.Errorf("Expected terminate to delete the network and floating IP, got %v, %v", provider.networks, provider.floatingIPs)
+	}
+
+	// terminate --all deletes networks whose instance is already gone
+	provider.networks["tins-orphan"] = NetworkSpec{Name: "tins-orphan"}
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	if len(provider.networks) != 0 {
+		t.Errorf("Expected terminate --all to delete orphaned networks, got %v", provider.networks)
+	}
+}
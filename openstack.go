@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"time"
 
 	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
@@ -19,22 +22,58 @@ type OpenStackClient struct {
 	computeClient *gophercloudv2.ServiceClient
 	networkClient *gophercloudv2.ServiceClient
 	imageClient   *gophercloudv2.ServiceClient
+	volumeClient  *gophercloudv2.ServiceClient // nil if the cloud has no block storage service
 	config        *OpenStackConfig
 }
 
+// OpenStackClient is the OpenStack implementation of Provider
+var _ Provider = (*OpenStackClient)(nil)
 
-// NewOpenStackClient creates a new OpenStack client
-func NewOpenStackClient(ctx context.Context, config *OpenStackConfig) (*OpenStackClient, error) {
-	// Authenticate with OpenStack (v2)
+// instanceStatusPollInterval is how often WaitForInstanceActive checks the server status
+var instanceStatusPollInterval = 5 * time.Second
+
+// authOptions builds the Keystone auth options for the configured authentication method
+func authOptions(config *OpenStackConfig) gophercloudv2.AuthOptions {
 	opts := gophercloudv2.AuthOptions{
 		IdentityEndpoint: config.AuthURL,
-		Username:         config.Username,
-		Password:         config.Password,
-		DomainName:       config.DomainName,
-		TenantID:         config.ProjectID,
 	}
 
-	provider, err := openstack.AuthenticatedClient(ctx, opts)
+	switch config.AuthType {
+	case AuthTypeApplicationCredential:
+		// Application credentials carry their own project scope
+		opts.ApplicationCredentialID = config.ApplicationCredentialID
+		opts.ApplicationCredentialName = config.ApplicationCredentialName
+		opts.ApplicationCredentialSecret = config.ApplicationCredentialSecret
+		if config.ApplicationCredentialID == "" {
+			opts.Username = config.Username
+			opts.DomainName = config.DomainName
+		}
+	case AuthTypeToken:
+		// Keystone rejects user and domain fields alongside a token, so the project goes in an explicit scope
+		opts.TokenID = config.Token
+		opts.Scope = &gophercloudv2.AuthScope{ProjectID: config.ProjectID}
+		if config.ProjectID == "" {
+			opts.Scope.ProjectName = config.ProjectName
+			opts.Scope.DomainName = config.DomainName
+		}
+	default:
+		opts.Username = config.Username
+		opts.Password = config.Password
+		opts.DomainName = config.DomainName
+		opts.TenantID = config.ProjectID
+		if config.ProjectID == "" {
+			// clouds.yaml clouds may only name the project
+			opts.TenantName = config.ProjectName
+		}
+	}
+
+	return opts
+}
+
+// NewOpenStackClient creates a new OpenStack client
+func NewOpenStackClient(ctx context.Context, config *OpenStackConfig) (*OpenStackClient, error) {
+	// Authenticate with OpenStack (v2)
+	provider, err := openstack.AuthenticatedClient(ctx, authOptions(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to authenticate: %w", err)
 	}
@@ -63,10 +102,19 @@ func NewOpenStackClient(ctx context.Context, config *OpenStackConfig) (*OpenStac
 		return nil, fmt.Errorf("failed to create image client: %w", err)
 	}
 
+	// Initialize Block Storage service client (Cinder); only volumes need it, so clouds without it still work
+	volumeClient, err := openstack.NewBlockStorageV3(provider, gophercloudv2.EndpointOpts{
+		Region: config.RegionName,
+	})
+	if err != nil {
+		volumeClient = nil
+	}
+
 	return &OpenStackClient{
 		computeClient: computeClient,
 		networkClient: networkClient,
 		imageClient:   imageClient,
+		volumeClient:  volumeClient,
 		config:        config,
 	}, nil
 }
@@ -156,6 +204,19 @@ func (c *OpenStackClient) CreateKeypair(ctx context.Context, keypairName string,
 	return nil
 }
 
+// EnsureKeypair imports a public key under the given name unless a keypair with that name already exists
+func (c *OpenStackClient) EnsureKeypair(ctx context.Context, keypairName string, publicKey string) error {
+	_, err := keypairs.Get(ctx, c.computeClient, keypairName, keypairs.GetOpts{}).Extract()
+	if err == nil {
+		return nil
+	}
+	if !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to get keypair: %w", err)
+	}
+
+	return c.CreateKeypair(ctx, keypairName, publicKey)
+}
+
 // DeleteKeypair deletes an OpenStack keypair by name
 func (c *OpenStackClient) DeleteKeypair(ctx context.Context, keypairName string) error {
 	err := keypairs.Delete(ctx, c.computeClient, keypairName, keypairs.DeleteOpts{}).ExtractErr()
@@ -166,10 +227,37 @@ func (c *OpenStackClient) DeleteKeypair(ctx context.Context, keypairName string)
 	return nil
 }
 
+// ListKeypairs lists the names of the OpenStack keypairs that start with the tins instance name prefix
+func (c *OpenStackClient) ListKeypairs(ctx context.Context) ([]string, error) {
+	allPages, err := keypairs.List(c.computeClient, keypairs.ListOpts{}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keypairs: %w", err)
+	}
+	allKeypairs, err := keypairs.ExtractKeyPairs(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract keypairs: %w", err)
+	}
+
+	var names []string
+	for _, keypair := range allKeypairs {
+		if strings.HasPrefix(keypair.Name, InstanceNamePrefix) {
+			names = append(names, keypair.Name)
+		}
+	}
+	return names, nil
+}
+
 // CreateInstance creates a new temporary instance
-func (c *OpenStackClient) CreateInstance(ctx context.Context, instanceName string, publicKey string, userData []byte) (*servers.Server, error) {
+func (c *OpenStackClient) CreateInstance(ctx context.Context, spec InstanceSpec) (*Instance, error) {
+	instanceName := spec.Name
+	publicKey := spec.PublicKey
+
 	// Find image ID
-	imageID, err := c.FindImageByName(ctx, c.config.ImageName)
+	imageName := c.config.ImageName
+	if spec.ImageName != "" {
+		imageName = spec.ImageName
+	}
+	imageID, err := c.FindImageByName(ctx, imageName)
 	if err != nil {
 		return nil, err
 	}
@@ -180,19 +268,33 @@ func (c *OpenStackClient) CreateInstance(ctx context.Context, instanceName strin
 		return nil, err
 	}
 
-	// Find network ID
-	networkID, err := c.FindNetworkByName(ctx, c.config.NetworkName)
-	if err != nil {
-		return nil, err
+	// Find network ID unless the instance boots on its own network
+	networkID := spec.NetworkID
+	if networkID == "" {
+		networkID, err = c.FindNetworkByName(ctx, c.config.NetworkName)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create OpenStack keypair for management purposes (not linked to instance)
-	if publicKey != "" {
+	keyName := spec.KeyName
+	ownKeypair := keyName == "" && publicKey != ""
+	if ownKeypair {
+		keyName = instanceName
 		if err := c.CreateKeypair(ctx, instanceName, publicKey); err != nil {
 			return nil, fmt.Errorf("failed to create keypair: %w", err)
 		}
 	}
 
+	// Tag the instance so it can be identified as temporary
+	metadata := map[string]string{
+		TempInstanceTag: "true",
+	}
+	for key, value := range spec.Metadata {
+		metadata[key] = value
+	}
+
 	// Create base server options
 	baseOpts := servers.CreateOpts{
 		Name:      instanceName,
@@ -202,18 +304,33 @@ func (c *OpenStackClient) CreateInstance(ctx context.Context, instanceName strin
 			{UUID: networkID},
 		},
 		AvailabilityZone: c.config.AvailabilityZone,
-		Metadata: map[string]string{
-			TempInstanceTag: "true",
-		},
-		UserData: userData,
+		Metadata:         metadata,
+		UserData:         spec.UserData,
+		SecurityGroups:   spec.SecurityGroups,
+	}
+
+	// Boot from a volume created from the image, so the root disk isn't limited to the flavor's disk
+	if spec.BootVolumeSize > 0 {
+		baseOpts.ImageRef = ""
+		baseOpts.BlockDevice = []servers.BlockDevice{
+			{
+				SourceType:          servers.SourceImage,
+				UUID:                imageID,
+				DestinationType:     servers.DestinationVolume,
+				VolumeSize:          spec.BootVolumeSize,
+				VolumeType:          spec.VolumeType,
+				DeleteOnTermination: true,
+				BootIndex:           0,
+			},
+		}
 	}
 
 	// Use official keypairs.CreateOptsExt for KeyName support
 	var createOpts servers.CreateOptsBuilder
-	if publicKey != "" {
+	if keyName != "" {
 		createOpts = keypairs.CreateOptsExt{
 			CreateOptsBuilder: baseOpts,
-			KeyName:           instanceName,
+			KeyName:           keyName,
 		}
 	} else {
 		createOpts = baseOpts
@@ -222,18 +339,22 @@ func (c *OpenStackClient) CreateInstance(ctx context.Context, instanceName strin
 	// Note: Tags are added after instance creation via separate API call
 	// as some OpenStack versions don't support tags in CreateOpts
 
-
 	// Create the server
 	server, err := servers.Create(ctx, c.computeClient, createOpts, nil).Extract()
 	if err != nil {
+		// Don't leave the keypair behind if the server could not be created
+		if ownKeypair {
+			_ = c.DeleteKeypair(ctx, instanceName)
+		}
 		return nil, fmt.Errorf("failed to create server: %w", err)
 	}
 
-	return server, nil
+	instance := toInstance(server)
+	return &instance, nil
 }
 
 // ListInstances lists all temporary instances
-func (c *OpenStackClient) ListInstances(ctx context.Context) ([]servers.Server, error) {
+func (c *OpenStackClient) ListInstances(ctx context.Context) ([]Instance, error) {
 	// List all servers and filter by metadata since tags aren't supported in all OpenStack versions
 	listOpts := servers.ListOpts{}
 	allPages, err := servers.List(c.computeClient, listOpts).AllPages(ctx)
@@ -247,18 +368,18 @@ func (c *OpenStackClient) ListInstances(ctx context.Context) ([]servers.Server,
 	}
 
 	// Filter by tins metadata and name prefix
-	var tinsInstances []servers.Server
+	var tinsInstances []Instance
 	for _, server := range allServers {
 		// Check if it has the tins metadata or starts with tins- prefix
 		if server.Metadata != nil {
 			if val, ok := server.Metadata[TempInstanceTag]; ok && val == "true" {
-				tinsInstances = append(tinsInstances, server)
+				tinsInstances = append(tinsInstances, toInstance(&server))
 				continue
 			}
 		}
 		// Also check by name prefix as fallback
 		if len(server.Name) >= len(InstanceNamePrefix) && server.Name[:len(InstanceNamePrefix)] == InstanceNamePrefix {
-			tinsInstances = append(tinsInstances, server)
+			tinsInstances = append(tinsInstances, toInstance(&server))
 		}
 	}
 
@@ -266,12 +387,13 @@ func (c *OpenStackClient) ListInstances(ctx context.Context) ([]servers.Server,
 }
 
 // GetInstance retrieves a server by ID
-func (c *OpenStackClient) GetInstance(ctx context.Context, serverID string) (*servers.Server, error) {
+func (c *OpenStackClient) GetInstance(ctx context.Context, serverID string) (*Instance, error) {
 	server, err := servers.Get(ctx, c.computeClient, serverID).Extract()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get server: %w", err)
 	}
-	return server, nil
+	instance := toInstance(server)
+	return &instance, nil
 }
 
 // DeleteInstance deletes a server
@@ -283,10 +405,19 @@ func (c *OpenStackClient) DeleteInstance(ctx context.Context, serverID string) e
 	return nil
 }
 
+// UpdateInstanceMetadata sets or replaces the given metadata keys on a server
+func (c *OpenStackClient) UpdateInstanceMetadata(ctx context.Context, serverID string, metadata map[string]string) error {
+	_, err := servers.UpdateMetadata(ctx, c.computeClient, serverID, servers.MetadataOpts(metadata)).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to update server metadata: %w", err)
+	}
+	return nil
+}
+
 // WaitForInstanceActive waits for an instance to become active
 func (c *OpenStackClient) WaitForInstanceActive(ctx context.Context, serverID string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
-	ticker := time.NewTicker(5 * time.Second)
+	ticker := time.NewTicker(instanceStatusPollInterval)
 	defer ticker.Stop()
 
 	for {
@@ -298,10 +429,10 @@ func (c *OpenStackClient) WaitForInstanceActive(ctx context.Context, serverID st
 			if err != nil {
 				return err
 			}
-			if server.Status == "ACTIVE" {
+			if server.Status == InstanceStatusActive {
 				return nil
 			}
-			if server.Status == "ERROR" {
+			if server.Status == InstanceStatusError {
 				return fmt.Errorf("server entered ERROR state")
 			}
 			if time.Now().After(deadline) {
@@ -310,3 +441,71 @@ func (c *OpenStackClient) WaitForInstanceActive(ctx context.Context, serverID st
 		}
 	}
 }
+
+// GetConsoleOutput returns the console log of a server
+func (c *OpenStackClient) GetConsoleOutput(ctx context.Context, serverID string) (string, error) {
+	output, err := servers.ShowConsoleOutput(ctx, c.computeClient, serverID, servers.ShowConsoleOutputOpts{}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to get console output: %w", err)
+	}
+	return output, nil
+}
+
+// toInstance converts a Nova server into the provider-neutral Instance type
+func toInstance(server *servers.Server) Instance {
+	instance := Instance{
+		ID:        server.ID,
+		Name:      server.Name,
+		Status:    strings.ToUpper(server.Status),
+		Created:   server.Created,
+		Addresses: serverAddresses(server),
+		Metadata:  server.Metadata,
+	}
+	if flavorID, ok := server.Flavor["id"].(string); ok {
+		instance.FlavorID = flavorID
+	}
+	if imageID, ok := server.Image["id"].(string); ok {
+		instance.ImageID = imageID
+	}
+	return instance
+}
+
+// serverAddresses flattens the Nova addresses map of a server into a list.
+// Networks are returned in name order so the output is stable between calls.
+func serverAddresses(server *servers.Server) []InstanceAddress {
+	networkNames := make([]string, 0, len(server.Addresses))
+	for networkName := range server.Addresses {
+		networkNames = append(networkNames, networkName)
+	}
+	sort.Strings(networkNames)
+
+	var result []InstanceAddress
+	for _, networkName := range networkNames {
+		// Type assert to []interface{} and then extract address info
+		addresses, ok := server.Addresses[networkName].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, addrInterface := range addresses {
+			addrMap, ok := addrInterface.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			addr, ok := addrMap["addr"].(string)
+			if !ok {
+				continue
+			}
+			addrType, hasType := addrMap["OS-EXT-IPS:type"].(string)
+			if hasType && addrType != "fixed" && addrType != "floating" {
+				continue
+			}
+			result = append(result, InstanceAddress{
+				Network: networkName,
+				Addr:    addr,
+				Type:    addrType,
+			})
+		}
+	}
+
+	return result
+}
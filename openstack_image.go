@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+	"github.com/gophercloud/gophercloud/v2/openstack/image/v2/images"
+)
+
+// snapshotTimeout bounds how long a snapshot is waited for to be uploaded to Glance
+const snapshotTimeout = 30 * time.Minute
+
+// snapshotPollInterval is how often the status of a snapshot image is checked while waiting
+var snapshotPollInterval = 5 * time.Second
+
+// toSnapshot converts a Glance image into the provider-neutral Snapshot type
+func toSnapshot(image *images.Image) Snapshot {
+	snapshot := Snapshot{
+		ID:      image.ID,
+		Name:    image.Name,
+		Status:  string(image.Status),
+		Created: image.CreatedAt,
+	}
+	if source, ok := image.Properties[SnapshotSourceTag].(string); ok {
+		snapshot.SourceInstance = source
+	}
+	return snapshot
+}
+
+// CreateSnapshot creates an image of a server with Nova and waits for Glance to mark it active.
+// The image is tagged before waiting so that a snapshot which never becomes active can still be listed and deleted.
+func (c *OpenStackClient) CreateSnapshot(ctx context.Context, instance *Instance, name string) (*Snapshot, error) {
+	createOpts := servers.CreateImageOpts{
+		Name:     name,
+		Metadata: map[string]string{SnapshotSourceTag: instance.Name},
+	}
+	imageID, err := servers.CreateImage(ctx, c.computeClient, instance.ID, createOpts).ExtractImageID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	updateOpts := images.UpdateOpts{
+		images.ReplaceImageTags{NewTags: []string{TempInstanceTag, SnapshotTag}},
+	}
+	if _, err := images.Update(ctx, c.imageClient, imageID, updateOpts).Extract(); err != nil {
+		return nil, fmt.Errorf("failed to tag snapshot %s: %w", imageID, err)
+	}
+
+	deadline := time.Now().Add(snapshotTimeout)
+	for {
+		image, err := images.Get(ctx, c.imageClient, imageID).Extract()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get snapshot: %w", err)
+		}
+		switch image.Status {
+		case images.ImageStatusActive:
+			snapshot := toSnapshot(image)
+			return &snapshot, nil
+		case images.ImageStatusKilled, images.ImageStatusDeleted:
+			return nil, fmt.Errorf("snapshot %s failed (status: %s)", imageID, image.Status)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout waiting for snapshot %s to become active (status: %s)", imageID, image.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(snapshotPollInterval):
+		}
+	}
+}
+
+// ListSnapshots lists the images tagged as tins snapshots
+func (c *OpenStackClient) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	listOpts := images.ListOpts{
+		Tags: []string{SnapshotTag},
+	}
+	allPages, err := images.List(c.imageClient, listOpts).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	allImages, err := images.ExtractImages(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract snapshots: %w", err)
+	}
+
+	result := make([]Snapshot, 0, len(allImages))
+	for i := range allImages {
+		result = append(result, toSnapshot(&allImages[i]))
+	}
+	return result, nil
+}
+
+// DeleteSnapshot deletes a snapshot image. An image that is already gone is not an error.
+func (c *OpenStackClient) DeleteSnapshot(ctx context.Context, snapshotID string) error {
+	err := images.Delete(ctx, c.imageClient, snapshotID).ExtractErr()
+	if err != nil && !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/secgroups"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/attributestags"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/layer3/floatingips"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/layer3/routers"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/security/groups"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/security/rules"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/ports"
+	"github.com/gophercloud/gophercloud/v2/openstack/networking/v2/subnets"
+)
+
+// networkDeleteTimeout bounds how long a network or security group deletion waits for the deleted server's port to go away
+const networkDeleteTimeout = 2 * time.Minute
+
+// networkDeletePollInterval is how often deleting a network or security group that is still in use is retried
+var networkDeletePollInterval = 5 * time.Second
+
+// findInstancePort returns the ID of the instance's port on the configured network, or its first port
+func (c *OpenStackClient) findInstancePort(ctx context.Context, serverID string) (string, error) {
+	allPages, err := ports.List(c.networkClient, ports.ListOpts{DeviceID: serverID}).AllPages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list ports: %w", err)
+	}
+
+	allPorts, err := ports.ExtractPorts(allPages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract ports: %w", err)
+	}
+	if len(allPorts) == 0 {
+		return "", fmt.Errorf("server %s has no ports", serverID)
+	}
+
+	if networkID, err := c.FindNetworkByName(ctx, c.config.NetworkName); err == nil {
+		for _, port := range allPorts {
+			if port.NetworkID == networkID {
+				return port.ID, nil
+			}
+		}
+	}
+	return allPorts[0].ID, nil
+}
+
+// AllocateFloatingIP allocates a floating IP from the pool network, associates it with the server's port
+// and tags it so orphaned addresses can be found later
+func (c *OpenStackClient) AllocateFloatingIP(ctx context.Context, serverID string, pool string) (*FloatingIP, error) {
+	poolID, err := c.FindNetworkByName(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find floating IP pool: %w", err)
+	}
+
+	portID, err := c.findInstancePort(ctx, serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	createOpts := floatingips.CreateOpts{
+		FloatingNetworkID: poolID,
+		PortID:            portID,
+		Description:       fmt.Sprintf("tins floating IP for server %s", serverID),
+	}
+	floatingIP, err := floatingips.Create(ctx, c.networkClient, createOpts).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create floating IP: %w", err)
+	}
+
+	if err := attributestags.Add(ctx, c.networkClient, "floatingips", floatingIP.ID, TempInstanceTag).ExtractErr(); err != nil {
+		// An untagged address would not be found by terminate --all, so don't keep it
+		_ = c.ReleaseFloatingIP(ctx, floatingIP.ID)
+		return nil, fmt.Errorf("failed to tag floating IP: %w", err)
+	}
+
+	return &FloatingIP{ID: floatingIP.ID, Address: floatingIP.FloatingIP, PortID: floatingIP.PortID}, nil
+}
+
+// ListFloatingIPs lists the floating IPs tagged as allocated by tins
+func (c *OpenStackClient) ListFloatingIPs(ctx context.Context) ([]FloatingIP, error) {
+	allPages, err := floatingips.List(c.networkClient, floatingips.ListOpts{Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list floating IPs: %w", err)
+	}
+
+	allFloatingIPs, err := floatingips.ExtractFloatingIPs(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract floating IPs: %w", err)
+	}
+
+	result := make([]FloatingIP, 0, len(allFloatingIPs))
+	for _, floatingIP := range allFloatingIPs {
+		result = append(result, FloatingIP{ID: floatingIP.ID, Address: floatingIP.FloatingIP, PortID: floatingIP.PortID})
+	}
+	return result, nil
+}
+
+// ReleaseFloatingIP deletes a floating IP, which also disassociates it
+func (c *OpenStackClient) ReleaseFloatingIP(ctx context.Context, floatingIPID string) error {
+	if err := floatingips.Delete(ctx, c.networkClient, floatingIPID).ExtractErr(); err != nil {
+		return fmt.Errorf("failed to delete floating IP: %w", err)
+	}
+	return nil
+}
+
+// CreateInstanceNetwork creates a network, subnet and router named after the instance, all tagged as tins resources.
+// The router is attached to the external network and the subnet. Anything created is removed again on failure.
+func (c *OpenStackClient) CreateInstanceNetwork(ctx context.Context, spec NetworkSpec) (string, error) {
+	externalNetworkID, err := c.FindNetworkByName(ctx, spec.ExternalNetwork)
+	if err != nil {
+		return "", fmt.Errorf("failed to find external network: %w", err)
+	}
+
+	// Undo steps run in reverse order if a later step fails
+	var undo []func()
+	rollback := func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+
+	network, err := networks.Create(ctx, c.networkClient, networks.CreateOpts{Name: spec.Name}).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create network: %w", err)
+	}
+	undo = append(undo, func() { _ = networks.Delete(ctx, c.networkClient, network.ID).ExtractErr() })
+	if err := c.tagResource(ctx, "networks", network.ID); err != nil {
+		rollback()
+		return "", err
+	}
+
+	subnetOpts := subnets.CreateOpts{
+		NetworkID:      network.ID,
+		Name:           spec.Name,
+		CIDR:           spec.CIDR,
+		IPVersion:      gophercloudv2.IPv4,
+		DNSNameservers: spec.DNSNameservers,
+	}
+	subnet, err := subnets.Create(ctx, c.networkClient, subnetOpts).Extract()
+	if err != nil {
+		rollback()
+		return "", fmt.Errorf("failed to create subnet: %w", err)
+	}
+	undo = append(undo, func() { _ = subnets.Delete(ctx, c.networkClient, subnet.ID).ExtractErr() })
+	if err := c.tagResource(ctx, "subnets", subnet.ID); err != nil {
+		rollback()
+		return "", err
+	}
+
+	routerOpts := routers.CreateOpts{
+		Name:        spec.Name,
+		GatewayInfo: &routers.GatewayInfo{NetworkID: externalNetworkID},
+	}
+	router, err := routers.Create(ctx, c.networkClient, routerOpts).Extract()
+	if err != nil {
+		rollback()
+		return "", fmt.Errorf("failed to create router: %w", err)
+	}
+	undo = append(undo, func() { _ = routers.Delete(ctx, c.networkClient, router.ID).ExtractErr() })
+	if err := c.tagResource(ctx, "routers", router.ID); err != nil {
+		rollback()
+		return "", err
+	}
+
+	if _, err := routers.AddInterface(ctx, c.networkClient, router.ID, routers.AddInterfaceOpts{SubnetID: subnet.ID}).Extract(); err != nil {
+		rollback()
+		return "", fmt.Errorf("failed to attach subnet to router: %w", err)
+	}
+
+	return network.ID, nil
+}
+
+// tagResource marks a Neutron resource as created by tins
+func (c *OpenStackClient) tagResource(ctx context.Context, resourceType, resourceID string) error {
+	if err := attributestags.Add(ctx, c.networkClient, resourceType, resourceID, TempInstanceTag).ExtractErr(); err != nil {
+		return fmt.Errorf("failed to tag %s %s: %w", resourceType, resourceID, err)
+	}
+	return nil
+}
+
+// DeleteInstanceNetwork deletes the tins router and network with the given name in dependency order:
+// router interfaces, router, then the network together with its subnet. Deleting the network is retried
+// while the port of a just-deleted server still exists.
+func (c *OpenStackClient) DeleteInstanceNetwork(ctx context.Context, name string) error {
+	networkPages, err := networks.List(c.networkClient, networks.ListOpts{Name: name, Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+	allNetworks, err := networks.ExtractNetworks(networkPages)
+	if err != nil {
+		return fmt.Errorf("failed to extract networks: %w", err)
+	}
+
+	routerPages, err := routers.List(c.networkClient, routers.ListOpts{Name: name, Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list routers: %w", err)
+	}
+	allRouters, err := routers.ExtractRouters(routerPages)
+	if err != nil {
+		return fmt.Errorf("failed to extract routers: %w", err)
+	}
+
+	for _, router := range allRouters {
+		for _, network := range allNetworks {
+			for _, subnetID := range network.Subnets {
+				_, err := routers.RemoveInterface(ctx, c.networkClient, router.ID, routers.RemoveInterfaceOpts{SubnetID: subnetID}).Extract()
+				if err != nil && !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+					return fmt.Errorf("failed to detach subnet from router: %w", err)
+				}
+			}
+		}
+		if err := routers.Delete(ctx, c.networkClient, router.ID).ExtractErr(); err != nil && !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+			return fmt.Errorf("failed to delete router: %w", err)
+		}
+	}
+
+	for _, network := range allNetworks {
+		err := deleteWhenUnused(ctx, func() error {
+			return networks.Delete(ctx, c.networkClient, network.ID).ExtractErr()
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete network: %w", err)
+		}
+	}
+	return nil
+}
+
+// deleteWhenUnused calls del until the resource is gone, retrying while Neutron reports it as still in use
+// by the port of a server that is still being deleted
+func deleteWhenUnused(ctx context.Context, del func() error) error {
+	deadline := time.Now().Add(networkDeleteTimeout)
+	for {
+		err := del()
+		if err == nil || gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+			return nil
+		}
+		if !gophercloudv2.ResponseCodeIs(err, http.StatusConflict) || time.Now().After(deadline) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(networkDeletePollInterval):
+		}
+	}
+}
+
+// ListInstanceNetworks lists the names of the tins-tagged networks and routers
+func (c *OpenStackClient) ListInstanceNetworks(ctx context.Context) ([]string, error) {
+	names := map[string]bool{}
+
+	networkPages, err := networks.List(c.networkClient, networks.ListOpts{Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+	allNetworks, err := networks.ExtractNetworks(networkPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract networks: %w", err)
+	}
+	for _, network := range allNetworks {
+		names[network.Name] = true
+	}
+
+	routerPages, err := routers.List(c.networkClient, routers.ListOpts{Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routers: %w", err)
+	}
+	allRouters, err := routers.ExtractRouters(routerPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract routers: %w", err)
+	}
+	for _, router := range allRouters {
+		names[router.Name] = true
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// findSecurityGroup returns the ID of the tins security group with the given name
+func (c *OpenStackClient) findSecurityGroup(ctx context.Context, name string) (string, error) {
+	allPages, err := groups.List(c.networkClient, groups.ListOpts{Name: name, Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list security groups: %w", err)
+	}
+	allGroups, err := groups.ExtractGroups(allPages)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract security groups: %w", err)
+	}
+	if len(allGroups) == 0 {
+		return "", fmt.Errorf("security group '%s' not found", name)
+	}
+	return allGroups[0].ID, nil
+}
+
+// CreateSecurityGroup creates a tagged security group with the given ingress rules. Neutron adds the
+// default egress rules. The group is deleted again if a rule cannot be added.
+func (c *OpenStackClient) CreateSecurityGroup(ctx context.Context, name string, portRules []PortRule) error {
+	createOpts := groups.CreateOpts{
+		Name:        name,
+		Description: fmt.Sprintf("tins security group for %s", name),
+	}
+	group, err := groups.Create(ctx, c.networkClient, createOpts).Extract()
+	if err != nil {
+		return fmt.Errorf("failed to create security group: %w", err)
+	}
+
+	err = c.tagResource(ctx, "security-groups", group.ID)
+	for _, rule := range portRules {
+		if err != nil {
+			break
+		}
+		err = c.createSecurityGroupRule(ctx, group.ID, rule)
+	}
+	if err != nil {
+		_ = groups.Delete(ctx, c.networkClient, group.ID).ExtractErr()
+		return err
+	}
+	return nil
+}
+
+// createSecurityGroupRule adds an ingress rule to a security group by ID
+func (c *OpenStackClient) createSecurityGroupRule(ctx context.Context, groupID string, rule PortRule) error {
+	etherType := rules.EtherType4
+	if rule.IPv6() {
+		etherType = rules.EtherType6
+	}
+	createOpts := rules.CreateOpts{
+		Direction:      rules.DirIngress,
+		EtherType:      etherType,
+		SecGroupID:     groupID,
+		Protocol:       rules.RuleProtocol(rule.Protocol),
+		PortRangeMin:   rule.PortMin,
+		PortRangeMax:   rule.PortMax,
+		RemoteIPPrefix: rule.CIDR,
+	}
+	if _, err := rules.Create(ctx, c.networkClient, createOpts).Extract(); err != nil {
+		return fmt.Errorf("failed to add security group rule %s: %w", rule, err)
+	}
+	return nil
+}
+
+// AddSecurityGroupRule adds an ingress rule to the tins security group with the given name
+func (c *OpenStackClient) AddSecurityGroupRule(ctx context.Context, name string, rule PortRule) error {
+	groupID, err := c.findSecurityGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+	return c.createSecurityGroupRule(ctx, groupID, rule)
+}
+
+// RemoveSecurityGroupRule deletes the ingress rules matching the rule's protocol and ports, and its source unless empty
+func (c *OpenStackClient) RemoveSecurityGroupRule(ctx context.Context, name string, rule PortRule) (int, error) {
+	groupID, err := c.findSecurityGroup(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	listOpts := rules.ListOpts{
+		SecGroupID:   groupID,
+		Direction:    string(rules.DirIngress),
+		Protocol:     rule.Protocol,
+		PortRangeMin: rule.PortMin,
+		PortRangeMax: rule.PortMax,
+	}
+	allPages, err := rules.List(c.networkClient, listOpts).AllPages(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list security group rules: %w", err)
+	}
+	allRules, err := rules.ExtractRules(allPages)
+	if err != nil {
+		return 0, fmt.Errorf("failed to extract security group rules: %w", err)
+	}
+
+	removed := 0
+	for _, existing := range allRules {
+		if rule.CIDR != "" && existing.RemoteIPPrefix != rule.CIDR {
+			continue
+		}
+		if err := rules.Delete(ctx, c.networkClient, existing.ID).ExtractErr(); err != nil {
+			return removed, fmt.Errorf("failed to delete security group rule: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// AttachSecurityGroup adds a security group to a running server
+func (c *OpenStackClient) AttachSecurityGroup(ctx context.Context, serverID string, name string) error {
+	if err := secgroups.AddServer(ctx, c.computeClient, serverID, name).ExtractErr(); err != nil {
+		return fmt.Errorf("failed to add security group to server: %w", err)
+	}
+	return nil
+}
+
+// DeleteSecurityGroup deletes the tins security group with the given name, retrying while a port still uses it
+func (c *OpenStackClient) DeleteSecurityGroup(ctx context.Context, name string) error {
+	groupID, err := c.findSecurityGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+	err = deleteWhenUnused(ctx, func() error {
+		return groups.Delete(ctx, c.networkClient, groupID).ExtractErr()
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete security group: %w", err)
+	}
+	return nil
+}
+
+// ListSecurityGroups lists the names of the tins-tagged security groups
+func (c *OpenStackClient) ListSecurityGroups(ctx context.Context) ([]string, error) {
+	allPages, err := groups.List(c.networkClient, groups.ListOpts{Tags: TempInstanceTag}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list security groups: %w", err)
+	}
+	allGroups, err := groups.ExtractGroups(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract security groups: %w", err)
+	}
+
+	names := make([]string, 0, len(allGroups))
+	for _, group := range allGroups {
+		names = append(names, group.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/servers"
+)
+
+func TestToInstance(t *testing.T) {
+	server := &servers.Server{
+		ID:     "server-id",
+		Name:   "tins-mystical-honda",
+		Status: "active",
+		Flavor: map[string]interface{}{"id": "flavor-id"},
+		Image:  map[string]interface{}{"id": "image-id"},
+		Addresses: map[string]interface{}{
+			"public": []interface{}{
+				map[string]interface{}{"addr": "203.0.113.10", "OS-EXT-IPS:type": "floating"},
+			},
+			"private": []interface{}{
+				map[string]interface{}{"addr": "10.0.0.5", "OS-EXT-IPS:type": "fixed"},
+				map[string]interface{}{"addr": "10.0.0.6"},
+			},
+		},
+		Metadata: map[string]string{TempInstanceTag: "true"},
+	}
+
+	instance := toInstance(server)
+
+	if instance.Status != InstanceStatusActive {
+		t.Errorf("Expected status to be normalized to '%s', got '%s'", InstanceStatusActive, instance.Status)
+	}
+	if instance.FlavorID != "flavor-id" {
+		t.Errorf("Expected FlavorID 'flavor-id', got '%s'", instance.FlavorID)
+	}
+	if instance.ImageID != "image-id" {
+		t.Errorf("Expected ImageID 'image-id', got '%s'", instance.ImageID)
+	}
+	if len(instance.Addresses) != 3 {
+		t.Fatalf("Expected 3 addresses, got %d", len(instance.Addresses))
+	}
+	// Networks are sorted by name
+	if instance.Addresses[0].Network != "private" || instance.Addresses[2].Network != "public" {
+		t.Errorf("Expected addresses ordered by network name, got %+v", instance.Addresses)
+	}
+	if instance.IP() != "203.0.113.10" {
+		t.Errorf("Expected floating IP to be preferred, got '%s'", instance.IP())
+	}
+}
+
+// newFakeOpenStackClient authenticates a real OpenStackClient against the fake
+func newFakeOpenStackClient(t *testing.T) (*fakeOpenStack, *OpenStackClient) {
+	t.Helper()
+	fake := useFakeOpenStack(t)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	client, err := NewOpenStackClient(context.Background(), config)
+	if err != nil {
+		t.Fatalf("NewOpenStackClient failed: %v", err)
+	}
+	return fake, client
+}
+
+func TestNewOpenStackClient_AuthFailure(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	fake.InjectFault(http.MethodPost, "/v3/auth/tokens", http.StatusUnauthorized)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if _, err := NewOpenStackClient(context.Background(), config); err == nil {
+		t.Error("NewOpenStackClient should fail when authentication is rejected")
+	}
+}
+
+func TestListInstances_FiltersNonTinsServers(t *testing.T) {
+	fake, client := newFakeOpenStackClient(t)
+	fake.AddServer("tins-by-prefix", InstanceStatusActive, nil)
+	fake.AddServer("tagged", InstanceStatusActive, map[string]string{TempInstanceTag: "true"})
+	fake.AddServer("unrelated", InstanceStatusActive, nil)
+
+	instances, err := client.ListInstances(context.Background())
+	if err != nil {
+		t.Fatalf("ListInstances failed: %v", err)
+	}
+
+	names := map[string]bool{}
+	for _, instance := range instances {
+		names[instance.Name] = true
+	}
+	if len(instances) != 2 || !names["tins-by-prefix"] || !names["tagged"] {
+		t.Errorf("Expected only tins instances to be listed, got %v", names)
+	}
+}
+
+func TestWaitForInstanceActive_Error(t *testing.T) {
+	fake, client := newFakeOpenStackClient(t)
+	fake.BuildPolls = 2
+	fake.BuildResult = InstanceStatusError
+
+	ctx := context.Background()
+	instance, err := client.CreateInstance(ctx, InstanceSpec{Name: "tins-broken"})
+	if err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+	if instance.Status != "BUILD" {
+		t.Errorf("Expected new instance in BUILD, got '%s'", instance.Status)
+	}
+
+	if err := client.WaitForInstanceActive(ctx, instance.ID, time.Second); err == nil {
+		t.Error("WaitForInstanceActive should fail when the server enters ERROR")
+	}
+}
+
+func TestWaitForInstanceActive_Timeout(t *testing.T) {
+	fake, client := newFakeOpenStackClient(t)
+	fake.BuildPolls = 1000
+
+	ctx := context.Background()
+	instance, err := client.CreateInstance(ctx, InstanceSpec{Name: "tins-slow"})
+	if err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+
+	if err := client.WaitForInstanceActive(ctx, instance.ID, 50*time.Millisecond); err == nil {
+		t.Error("WaitForInstanceActive should time out while the server is still building")
+	}
+}
+
+func TestDeleteInstance_NotFound(t *testing.T) {
+	_, client := newFakeOpenStackClient(t)
+
+	if err := client.DeleteInstance(context.Background(), "missing"); err == nil {
+		t.Error("DeleteInstance should fail for an unknown server")
+	}
+}
+
+func TestAuthOptions(t *testing.T) {
+	base := OpenStackConfig{
+		AuthURL:     "https://keystone.example.com/v3",
+		Username:    "user",
+		Password:    "secret",
+		DomainName:  "Default",
+		ProjectID:   "project-id",
+		ProjectName: "project",
+	}
+
+	password := base
+	password.AuthType = AuthTypePassword
+	opts := authOptions(&password)
+	if opts.Username != "user" || opts.Password != "secret" || opts.TenantID != "project-id" || opts.TokenID != "" {
+		t.Errorf("unexpected password auth options: %+v", opts)
+	}
+
+	appCred := base
+	appCred.AuthType = AuthTypeApplicationCredential
+	appCred.ApplicationCredentialID = "cred-id"
+	appCred.ApplicationCredentialSecret = "cred-secret"
+	opts = authOptions(&appCred)
+	if opts.ApplicationCredentialID != "cred-id" || opts.ApplicationCredentialSecret != "cred-secret" {
+		t.Errorf("unexpected application credential auth options: %+v", opts)
+	}
+	if opts.Password != "" || opts.Username != "" || opts.TenantID != "" || opts.TenantName != "" {
+		t.Errorf("application credential by ID should not send user, password or project: %+v", opts)
+	}
+
+	appCred.ApplicationCredentialID = ""
+	appCred.ApplicationCredentialName = "cred-name"
+	opts = authOptions(&appCred)
+	if opts.ApplicationCredentialName != "cred-name" || opts.Username != "user" || opts.DomainName != "Default" {
+		t.Errorf("application credential by name should identify the user: %+v", opts)
+	}
+
+	token := base
+	token.AuthType = AuthTypeToken
+	token.Token = "token-value"
+	token.ProjectID = ""
+	opts = authOptions(&token)
+	if opts.TokenID != "token-value" || opts.Username != "" || opts.Password != "" || opts.DomainName != "" {
+		t.Errorf("unexpected token auth options: %+v", opts)
+	}
+	if opts.Scope == nil || opts.Scope.ProjectName != "project" || opts.Scope.DomainName != "Default" {
+		t.Errorf("token auth should scope to the project by name: %+v", opts.Scope)
+	}
+}
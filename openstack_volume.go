@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	gophercloudv2 "github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/snapshots"
+	"github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/v2/openstack/compute/v2/volumeattach"
+)
+
+// volumeStatusTimeout bounds how long volume operations wait for a volume to change status
+const volumeStatusTimeout = 5 * time.Minute
+
+// volumeStatusPollInterval is how often the status of a volume is checked while waiting
+var volumeStatusPollInterval = 2 * time.Second
+
+// errNoBlockStorage is returned by volume operations on clouds without a block storage service
+var errNoBlockStorage = errors.New("the cloud has no block storage (Cinder) service")
+
+// toVolume converts a Cinder volume into the provider-neutral Volume type
+func toVolume(volume *volumes.Volume) Volume {
+	result := Volume{
+		ID:         volume.ID,
+		Name:       volume.Name,
+		SizeGB:     volume.Size,
+		VolumeType: volume.VolumeType,
+		Status:     volume.Status,
+		Metadata:   volume.Metadata,
+	}
+	for _, attachment := range volume.Attachments {
+		result.ServerIDs = append(result.ServerIDs, attachment.ServerID)
+	}
+	return result
+}
+
+// CreateVolume creates a volume tagged with tins metadata
+func (c *OpenStackClient) CreateVolume(ctx context.Context, spec VolumeSpec) (*Volume, error) {
+	if c.volumeClient == nil {
+		return nil, errNoBlockStorage
+	}
+
+	metadata := map[string]string{
+		TempInstanceTag: "true",
+	}
+	for key, value := range spec.Metadata {
+		metadata[key] = value
+	}
+	createOpts := volumes.CreateOpts{
+		Name:        spec.Name,
+		Size:        spec.SizeGB,
+		VolumeType:  spec.VolumeType,
+		Description: "Created by tins",
+		Metadata:    metadata,
+	}
+	volume, err := volumes.Create(ctx, c.volumeClient, createOpts, nil).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume: %w", err)
+	}
+
+	result := toVolume(volume)
+	return &result, nil
+}
+
+// ListVolumes lists the volumes tagged with tins metadata. Clouds without block storage have none.
+func (c *OpenStackClient) ListVolumes(ctx context.Context) ([]Volume, error) {
+	if c.volumeClient == nil {
+		return nil, nil
+	}
+
+	listOpts := volumes.ListOpts{
+		Metadata: map[string]string{TempInstanceTag: "true"},
+	}
+	allPages, err := volumes.List(c.volumeClient, listOpts).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	allVolumes, err := volumes.ExtractVolumes(allPages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract volumes: %w", err)
+	}
+
+	result := make([]Volume, 0, len(allVolumes))
+	for i := range allVolumes {
+		result = append(result, toVolume(&allVolumes[i]))
+	}
+	return result, nil
+}
+
+// AttachVolume attaches a volume to a server once the volume is available, then waits until it is in use
+func (c *OpenStackClient) AttachVolume(ctx context.Context, serverID string, volumeID string) error {
+	if c.volumeClient == nil {
+		return errNoBlockStorage
+	}
+
+	if err := c.waitForVolumeStatus(ctx, volumeID, "available"); err != nil {
+		return err
+	}
+	createOpts := volumeattach.CreateOpts{
+		VolumeID: volumeID,
+	}
+	if _, err := volumeattach.Create(ctx, c.computeClient, serverID, createOpts).Extract(); err != nil {
+		return fmt.Errorf("failed to attach volume: %w", err)
+	}
+	return c.waitForVolumeStatus(ctx, volumeID, "in-use")
+}
+
+// DetachVolume detaches a volume from a server, then waits until the volume is available.
+// A server or attachment that is already gone is not an error.
+func (c *OpenStackClient) DetachVolume(ctx context.Context, serverID string, volumeID string) error {
+	if c.volumeClient == nil {
+		return errNoBlockStorage
+	}
+
+	err := volumeattach.Delete(ctx, c.computeClient, serverID, volumeID).ExtractErr()
+	if err != nil && !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to detach volume: %w", err)
+	}
+	return c.waitForVolumeStatus(ctx, volumeID, "available")
+}
+
+// DeleteVolume deletes a volume once it has been detached. Detaching, including the implicit detach
+// when its server is deleted, takes a while, so the volume is first waited for to become available.
+func (c *OpenStackClient) DeleteVolume(ctx context.Context, volumeID string) error {
+	if c.volumeClient == nil {
+		return errNoBlockStorage
+	}
+
+	if err := c.waitForVolumeStatus(ctx, volumeID, "available", "error"); err != nil {
+		if gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+			return nil
+		}
+		return err
+	}
+	err := volumes.Delete(ctx, c.volumeClient, volumeID, volumes.DeleteOpts{}).ExtractErr()
+	if err != nil && !gophercloudv2.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("failed to delete volume: %w", err)
+	}
+	return nil
+}
+
+// CreateVolumeSnapshot starts a snapshot of a volume. Force allows snapshots of volumes that are in use.
+func (c *OpenStackClient) CreateVolumeSnapshot(ctx context.Context, volumeID string, name string) (string, error) {
+	if c.volumeClient == nil {
+		return "", errNoBlockStorage
+	}
+
+	createOpts := snapshots.CreateOpts{
+		VolumeID:    volumeID,
+		Name:        name,
+		Description: "Created by tins",
+		Force:       true,
+		Metadata:    map[string]string{TempInstanceTag: "true"},
+	}
+	snapshot, err := snapshots.Create(ctx, c.volumeClient, createOpts).Extract()
+	if err != nil {
+		return "", fmt.Errorf("failed to create volume snapshot: %w", err)
+	}
+	return snapshot.ID, nil
+}
+
+// waitForVolumeStatus polls a volume until it reaches one of the wanted statuses.
+// A volume that ends up in an error status other than a wanted one is reported as a failure.
+func (c *OpenStackClient) waitForVolumeStatus(ctx context.Context, volumeID string, want ...string) error {
+	deadline := time.Now().Add(volumeStatusTimeout)
+	for {
+		volume, err := volumes.Get(ctx, c.volumeClient, volumeID).Extract()
+		if err != nil {
+			return fmt.Errorf("failed to get volume: %w", err)
+		}
+		for _, status := range want {
+			if volume.Status == status {
+				return nil
+			}
+		}
+		if volume.Status == "error" || volume.Status == "error_deleting" {
+			return fmt.Errorf("volume %s is in status %s", volumeID, volume.Status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for volume %s to become %s (status: %s)", volumeID, want[0], volume.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(volumeStatusPollInterval):
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// OutputTable is the default human-readable output
+	OutputTable = "table"
+	// OutputWide is the human-readable output with additional columns
+	OutputWide = "wide"
+	// OutputJSON is machine-readable JSON output
+	OutputJSON = "json"
+	// OutputYAML is machine-readable YAML output
+	OutputYAML = "yaml"
+)
+
+// InstanceOutput is the stable machine-readable schema for an instance
+type InstanceOutput struct {
+	ID             string            `json:"id" yaml:"id"`
+	Name           string            `json:"name" yaml:"name"`
+	Status         string            `json:"status" yaml:"status"`
+	Created        time.Time         `json:"created" yaml:"created"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty" yaml:"expires_at,omitempty"`
+	IP             string            `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Addresses      []AddressOutput   `json:"addresses" yaml:"addresses"`
+	FlavorID       string            `json:"flavor_id" yaml:"flavor_id"`
+	ImageID        string            `json:"image_id" yaml:"image_id"`
+	BootVolume     string            `json:"boot_volume,omitempty" yaml:"boot_volume,omitempty"`
+	Metadata       map[string]string `json:"metadata" yaml:"metadata"`
+	PrivateKeyPath string            `json:"private_key_path,omitempty" yaml:"private_key_path,omitempty"`
+}
+
+// AddressOutput is the machine-readable schema for an instance address
+type AddressOutput struct {
+	Network string `json:"network" yaml:"network"`
+	Addr    string `json:"addr" yaml:"addr"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// TerminateOutput is the machine-readable result of terminating an instance
+type TerminateOutput struct {
+	ID         string `json:"id" yaml:"id"`
+	Name       string `json:"name" yaml:"name"`
+	Terminated bool   `json:"terminated" yaml:"terminated"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// outputFormat returns the validated value of the global --output flag
+func outputFormat(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("output")
+	format = strings.ToLower(format)
+	switch format {
+	case "", OutputTable:
+		return OutputTable, nil
+	case OutputWide, OutputJSON, OutputYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid output format '%s' (must be one of: table, wide, json, yaml)", format)
+	}
+}
+
+// isStructuredOutput reports whether the format is meant for machines rather than people
+func isStructuredOutput(format string) bool {
+	return format == OutputJSON || format == OutputYAML
+}
+
+// progressWriter returns where progress messages go for the given format.
+// Structured output keeps stdout clean for the result, so progress goes to stderr.
+func progressWriter(format string) io.Writer {
+	if isStructuredOutput(format) {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeStructured encodes v as JSON or YAML
+func writeStructured(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case OutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("output format '%s' is not a structured format", format)
+	}
+}
+
+// newInstanceOutput converts an instance into its machine-readable schema
+func newInstanceOutput(instance *Instance) InstanceOutput {
+	output := InstanceOutput{
+		ID:        instance.ID,
+		Name:      instance.Name,
+		Status:    instance.Status,
+		Created:   instance.Created.UTC(),
+		IP:        instance.IP(),
+		Addresses: []AddressOutput{},
+		FlavorID:  instance.FlavorID,
+		ImageID:   instance.ImageID,
+		Metadata:  instance.Metadata,
+	}
+	if output.Metadata == nil {
+		output.Metadata = map[string]string{}
+	}
+	output.BootVolume = instance.Metadata[BootVolumeTag]
+	if expiresAt, ok := instance.ExpiresAt(); ok {
+		output.ExpiresAt = &expiresAt
+	}
+	for _, address := range instance.Addresses {
+		output.Addresses = append(output.Addresses, AddressOutput(address))
+	}
+
+	keyPath := GetSSHKeyPath(shortInstanceName(instance.Name))
+	if _, err := os.Stat(keyPath); err == nil {
+		output.PrivateKeyPath = keyPath
+	}
+
+	return output
+}
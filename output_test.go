@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// useOutputFormat sets the global --output flag and restores the default when the test ends
+func useOutputFormat(t *testing.T, format string) {
+	t.Helper()
+	if err := rootCmd.PersistentFlags().Set("output", format); err != nil {
+		t.Fatalf("failed to set output flag: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = rootCmd.PersistentFlags().Set("output", OutputTable)
+	})
+}
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", OutputTable, false},
+		{"table", OutputTable, false},
+		{"wide", OutputWide, false},
+		{"JSON", OutputJSON, false},
+		{"yaml", OutputYAML, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("output", tt.value, "")
+
+		got, err := outputFormat(cmd)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("outputFormat(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("outputFormat(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNewInstanceOutput(t *testing.T) {
+	setTestConfigEnv(t)
+	keyPair, err := GenerateSSHKey("output-test", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	instance := &Instance{
+		ID:      "server-1",
+		Name:    "tins-output-test",
+		Status:  InstanceStatusActive,
+		Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Addresses: []InstanceAddress{
+			{Network: "private", Addr: "10.0.0.5", Type: "fixed"},
+		},
+		FlavorID: "flavor-1",
+		ImageID:  "image-1",
+		Metadata: map[string]string{ExpiresAtTag: "2024-01-03T03:04:05Z"},
+	}
+
+	output := newInstanceOutput(instance)
+	if output.IP != "10.0.0.5" {
+		t.Errorf("Expected IP 10.0.0.5, got %q", output.IP)
+	}
+	if output.PrivateKeyPath != keyPair.PrivateKeyPath {
+		t.Errorf("Expected private key path %q, got %q", keyPair.PrivateKeyPath, output.PrivateKeyPath)
+	}
+	if output.ExpiresAt == nil || !output.ExpiresAt.Equal(time.Date(2024, 1, 3, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected expires_at to be parsed from metadata, got %v", output.ExpiresAt)
+	}
+
+	// Instances without a local key or addresses still produce a complete schema
+	output = newInstanceOutput(&Instance{ID: "server-2", Name: "tins-no-key"})
+	if output.PrivateKeyPath != "" {
+		t.Errorf("Expected no private key path, got %q", output.PrivateKeyPath)
+	}
+	if output.Addresses == nil || output.Metadata == nil {
+		t.Error("Expected addresses and metadata to be empty rather than nil")
+	}
+}
+
+func TestWriteStructured(t *testing.T) {
+	value := InstanceOutput{ID: "server-1", Name: "tins-test", Addresses: []AddressOutput{}, Metadata: map[string]string{}}
+
+	var buf bytes.Buffer
+	if err := writeStructured(&buf, OutputJSON, value); err != nil {
+		t.Fatalf("writeStructured(json) failed: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if decoded["id"] != "server-1" || decoded["name"] != "tins-test" {
+		t.Errorf("unexpected JSON output: %s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeStructured(&buf, OutputYAML, value); err != nil {
+		t.Fatalf("writeStructured(yaml) failed: %v", err)
+	}
+	decoded = nil
+	if err := yaml.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid YAML output: %v", err)
+	}
+	if decoded["id"] != "server-1" {
+		t.Errorf("unexpected YAML output: %s", buf.String())
+	}
+
+	if err := writeStructured(&buf, OutputTable, value); err == nil {
+		t.Error("Expected an error for a non-structured format")
+	}
+}
+
+func TestListCommand_JSONOutput(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	useOutputFormat(t, OutputJSON)
+
+	ctx := context.Background()
+	for _, name := range []string{"tins-first", "tins-second"} {
+		if _, err := provider.CreateInstance(ctx, InstanceSpec{Name: name}); err != nil {
+			t.Fatalf("CreateInstance failed: %v", err)
+		}
+	}
+
+	output, err := runCommand(t, "list")
+	if err != nil {
+		t.Fatalf("list command failed: %v", err)
+	}
+
+	var instances []InstanceOutput
+	if err := json.Unmarshal([]byte(output), &instances); err != nil {
+		t.Fatalf("list output is not valid JSON: %v\n%s", err, output)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %d", len(instances))
+	}
+	for _, instance := range instances {
+		if !strings.HasPrefix(instance.Name, InstanceNamePrefix) {
+			t.Errorf("unexpected instance name %q", instance.Name)
+		}
+	}
+}
+
+func TestListCommand_EmptyJSONOutput(t *testing.T) {
+	setTestConfigEnv(t)
+	useFakeProvider(t, newFakeProvider())
+	useOutputFormat(t, OutputJSON)
+
+	output, err := runCommand(t, "list")
+	if err != nil {
+		t.Fatalf("list command failed: %v", err)
+	}
+	if strings.TrimSpace(output) != "[]" {
+		t.Errorf("Expected an empty JSON array, got %q", output)
+	}
+}
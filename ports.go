@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// anyIPv4CIDR is the source of rules opened without a CIDR
+	anyIPv4CIDR = "0.0.0.0/0"
+	// callerIPTimeout bounds the lookup of the caller's public IP
+	callerIPTimeout = 10 * time.Second
+	// defaultSecurityGroup is the project group Nova boots instances with when none are given
+	defaultSecurityGroup = "default"
+)
+
+// PortRule is an ingress rule of an instance security group
+type PortRule struct {
+	Protocol string // "tcp" or "udp"
+	PortMin  int
+	PortMax  int
+	CIDR     string // Allowed source addresses
+}
+
+// parsePortRule parses <port>[-<port>][/tcp|udp][,<cidr>], e.g. 8080/tcp or 60000-61000/udp,10.0.0.0/8.
+// The protocol defaults to tcp and the source to anywhere.
+func parsePortRule(value string) (PortRule, error) {
+	rule := PortRule{Protocol: "tcp", CIDR: anyIPv4CIDR}
+
+	spec, cidr, hasCIDR := strings.Cut(value, ",")
+	if hasCIDR {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return PortRule{}, fmt.Errorf("invalid source CIDR in '%s': %w", value, err)
+		}
+		rule.CIDR = network.String()
+	}
+
+	ports, protocol, hasProtocol := strings.Cut(spec, "/")
+	if hasProtocol {
+		rule.Protocol = strings.ToLower(protocol)
+		if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+			return PortRule{}, fmt.Errorf("invalid protocol in '%s' (must be tcp or udp)", value)
+		}
+	}
+
+	low, high, isRange := strings.Cut(ports, "-")
+	var err error
+	if rule.PortMin, err = parsePort(low); err != nil {
+		return PortRule{}, fmt.Errorf("invalid port in '%s': %w", value, err)
+	}
+	rule.PortMax = rule.PortMin
+	if isRange {
+		if rule.PortMax, err = parsePort(high); err != nil {
+			return PortRule{}, fmt.Errorf("invalid port in '%s': %w", value, err)
+		}
+		if rule.PortMax < rule.PortMin {
+			return PortRule{}, fmt.Errorf("invalid port range in '%s'", value)
+		}
+	}
+	return rule, nil
+}
+
+// parsePort parses a port number between 1 and 65535
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("'%s' is not a port between 1 and 65535", value)
+	}
+	return port, nil
+}
+
+// String formats the rule the way parsePortRule reads it
+func (r PortRule) String() string {
+	ports := strconv.Itoa(r.PortMin)
+	if r.PortMax != r.PortMin {
+		ports += "-" + strconv.Itoa(r.PortMax)
+	}
+	return fmt.Sprintf("%s/%s,%s", ports, r.Protocol, r.CIDR)
+}
+
+// IPv6 reports whether the rule's source is an IPv6 range
+func (r PortRule) IPv6() bool {
+	return strings.Contains(r.CIDR, ":")
+}
+
+// sshRule returns the rule that lets the caller reach an instance over SSH.
+// The source is ssh_allowed_cidr, else the address public_ip_url reports; without either, SSH is never opened
+// to everyone implicitly. Through a bastion, connections arrive from an address only the cloud knows,
+// so ssh_allowed_cidr is required.
+func sshRule(config *OpenStackConfig) (PortRule, error) {
+	rule := PortRule{Protocol: "tcp", PortMin: DefaultSSHPort, PortMax: DefaultSSHPort}
+	switch {
+	case config.SSHAllowedCIDR != "":
+		rule.CIDR = config.SSHAllowedCIDR
+	case config.Bastion.Enabled():
+		return PortRule{}, fmt.Errorf("set ssh_allowed_cidr to the bastion's internal address or subnet to open ports on instances reached through bastion %s", config.Bastion.Host)
+	case config.PublicIPURL != "":
+		address, err := callerIP(config.PublicIPURL)
+		if err != nil {
+			return PortRule{}, fmt.Errorf("failed to determine your public IP address from public_ip_url (set ssh_allowed_cidr instead): %w", err)
+		}
+		rule.CIDR = hostCIDR(address)
+	default:
+		return PortRule{}, fmt.Errorf("set ssh_allowed_cidr (e.g. %s to allow everyone) or public_ip_url in the config file to choose who may SSH into instances with a tins security group", anyIPv4CIDR)
+	}
+	return rule, nil
+}
+
+// hostCIDR returns the single-address CIDR for an IP
+func hostCIDR(ip net.IP) string {
+	if ip.To4() != nil {
+		return ip.String() + "/32"
+	}
+	return ip.String() + "/128"
+}
+
+// callerIP asks url for the public IP address this machine connects from
+func callerIP(url string) (net.IP, error) {
+	client := &http.Client{Timeout: callerIPTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return nil, err
+	}
+	ip := net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		return nil, fmt.Errorf("%s returned no IP address", url)
+	}
+	return ip, nil
+}
+
+// securityGroupRules returns the rules of a new instance security group: SSH from the caller plus the opened ports
+func securityGroupRules(config *OpenStackConfig, openPorts []PortRule) ([]PortRule, error) {
+	ssh, err := sshRule(config)
+	if err != nil {
+		return nil, err
+	}
+	rules := []PortRule{ssh}
+	for _, rule := range openPorts {
+		if rule != ssh {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// deleteInstanceSecurityGroup deletes the security group tins created for an instance, if it has one
+func deleteInstanceSecurityGroup(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	groupName, ok := instance.Metadata[SecurityGroupTag]
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(out, "Deleting security group %s...\n", groupName)
+	if err := client.DeleteSecurityGroup(ctx, groupName); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to delete security group: %v\n", err)
+	} else {
+		fmt.Fprintf(out, "Security group deleted.\n")
+	}
+}
+
+// deleteOrphanedSecurityGroups deletes tins security groups whose instance is gone.
+// Groups of the instances in keep are left alone.
+func deleteOrphanedSecurityGroups(ctx context.Context, client Provider, keep map[string]bool, out io.Writer) error {
+	names, err := client.ListSecurityGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if keep[name] {
+			continue
+		}
+		if err := client.DeleteSecurityGroup(ctx, name); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to delete security group %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted orphaned security group %s.\n", name)
+	}
+	return nil
+}
+
+var portsCmd = &cobra.Command{
+	Use:   "ports",
+	Short: "Open or close ports on a temporary instance",
+	Long:  "Manage the ingress rules of the security group tins creates for an instance.",
+}
+
+var portsOpenCmd = &cobra.Command{
+	Use:   "open <instance-name-or-id> <port>[-<port>][/tcp|udp][,<cidr>]",
+	Short: "Open a port on a running instance",
+	Long:  "Allow traffic to a port of a running instance, from anywhere or from the given CIDR. Instances created without --open-port get a tins security group (with SSH from ssh_allowed_cidr or public_ip_url) on first use, added next to their other groups like at create.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rule, err := parsePortRule(args[1])
+		if err != nil {
+			return err
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		if groupName, ok := instance.Metadata[SecurityGroupTag]; ok {
+			if err := client.AddSecurityGroupRule(ctx, groupName, rule); err != nil {
+				return err
+			}
+			fmt.Printf("Opened %s on %s\n", rule, instance.Name)
+			return nil
+		}
+
+		// The instance still only has the project's groups, so give it its own
+		rules, err := securityGroupRules(config, []PortRule{rule})
+		if err != nil {
+			return err
+		}
+		if err := client.CreateSecurityGroup(ctx, instance.Name, rules); err != nil {
+			return err
+		}
+		if err := client.AttachSecurityGroup(ctx, instance.ID, instance.Name); err != nil {
+			if deleteErr := client.DeleteSecurityGroup(ctx, instance.Name); deleteErr != nil {
+				fmt.Printf("Warning: Failed to clean up security group: %v\n", deleteErr)
+			}
+			return err
+		}
+		if err := client.UpdateInstanceMetadata(ctx, instance.ID, map[string]string{SecurityGroupTag: instance.Name}); err != nil {
+			return fmt.Errorf("failed to record security group: %w", err)
+		}
+		fmt.Printf("Created security group %s and opened %s on %s\n", instance.Name, rule, instance.Name)
+		return nil
+	},
+}
+
+var portsCloseCmd = &cobra.Command{
+	Use:   "close <instance-name-or-id> <port>[-<port>][/tcp|udp][,<cidr>]",
+	Short: "Close a port on a running instance",
+	Long:  "Remove the rules for a port from the instance's tins security group. Without a CIDR, the port is closed for every source.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rule, err := parsePortRule(args[1])
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(args[1], ",") {
+			rule.CIDR = ""
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		groupName, ok := instance.Metadata[SecurityGroupTag]
+		if !ok {
+			return fmt.Errorf("instance %s has no tins security group; its ports are controlled by the project's security groups", instance.Name)
+		}
+
+		removed, err := client.RemoveSecurityGroupRule(ctx, groupName, rule)
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return fmt.Errorf("port %s is not open on %s", args[1], instance.Name)
+		}
+		fmt.Printf("Closed %s on %s (%d rule(s) removed)\n", args[1], instance.Name, removed)
+		return nil
+	},
+}
+
+func init() {
+	portsCmd.AddCommand(portsOpenCmd)
+	portsCmd.AddCommand(portsCloseCmd)
+	rootCmd.AddCommand(portsCmd)
+}
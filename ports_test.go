@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePortRule(t *testing.T) {
+	tests := []struct {
+		value string
+		want  PortRule
+	}{
+		{"8080", PortRule{Protocol: "tcp", PortMin: 8080, PortMax: 8080, CIDR: anyIPv4CIDR}},
+		{"53/UDP", PortRule{Protocol: "udp", PortMin: 53, PortMax: 53, CIDR: anyIPv4CIDR}},
+		{"60000-61000/udp,10.1.2.3/8", PortRule{Protocol: "udp", PortMin: 60000, PortMax: 61000, CIDR: "10.0.0.0/8"}},
+		{"443/tcp,2001:db8::/32", PortRule{Protocol: "tcp", PortMin: 443, PortMax: 443, CIDR: "2001:db8::/32"}},
+	}
+	for _, tt := range tests {
+		rule, err := parsePortRule(tt.value)
+		if err != nil {
+			t.Errorf("parsePortRule(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if rule != tt.want {
+			t.Errorf("parsePortRule(%q) = %+v; expected %+v", tt.value, rule, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "http", "0", "65536", "90-80", "80/icmp", "80,10.0.0.0"} {
+		if _, err := parsePortRule(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+
+	rule, _ := parsePortRule("8000-8100/tcp,192.0.2.0/24")
+	if rule.String() != "8000-8100/tcp,192.0.2.0/24" {
+		t.Errorf("Expected String to round-trip, got %q", rule.String())
+	}
+}
+
+func TestSSHRule(t *testing.T) {
+	rule, err := sshRule(&OpenStackConfig{SSHAllowedCIDR: "198.51.100.0/24"})
+	if err != nil || rule.CIDR != "198.51.100.0/24" || rule.PortMin != DefaultSSHPort {
+		t.Errorf("Expected SSH from ssh_allowed_cidr, got %+v, %v", rule, err)
+	}
+
+	// Without configuration SSH is not opened to everyone behind the user's back
+	if _, err := sshRule(&OpenStackConfig{}); err == nil || !strings.Contains(err.Error(), "ssh_allowed_cidr") {
+		t.Errorf("Expected an error asking for ssh_allowed_cidr or public_ip_url, got %v", err)
+	}
+
+	url := useCallerIP(t, "198.51.100.7\n")
+	rule, err = sshRule(&OpenStackConfig{PublicIPURL: url})
+	if err != nil || rule.CIDR != "198.51.100.7/32" {
+		t.Errorf("Expected SSH from the address public_ip_url reports, got %+v, %v", rule, err)
+	}
+
+	// A bastion connects from its internal address, which only ssh_allowed_cidr can name
+	if _, err := sshRule(&OpenStackConfig{PublicIPURL: url, Bastion: BastionConfig{Host: "bastion.example.com"}}); err == nil || !strings.Contains(err.Error(), "ssh_allowed_cidr") {
+		t.Errorf("Expected a bastion without ssh_allowed_cidr to fail, got %v", err)
+	}
+	rule, err = sshRule(&OpenStackConfig{SSHAllowedCIDR: "10.0.0.5/32", Bastion: BastionConfig{Host: "bastion.example.com"}})
+	if err != nil || rule.CIDR != "10.0.0.5/32" {
+		t.Errorf("Expected SSH from ssh_allowed_cidr with a bastion, got %+v, %v", rule, err)
+	}
+
+	url = useCallerIP(t, "not an address")
+	if _, err := sshRule(&OpenStackConfig{PublicIPURL: url}); err == nil || !strings.Contains(err.Error(), "ssh_allowed_cidr") {
+		t.Errorf("Expected an error pointing at ssh_allowed_cidr, got %v", err)
+	}
+}
+
+func TestCreateTerminate_OpenPort(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	writePublicIPURLConfig(t, useCallerIP(t, "198.51.100.7"))
+	resetFlagsAfterTest(t, createCmd)
+	resetFlagsAfterTest(t, terminateCmd)
+
+	output, err := runCommand(t, "create", "web", "--open-port", "8080/tcp", "--open-port", "53/udp,10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	rules := provider.securityGroups["tins-web"]
+	want := []string{"22/tcp,198.51.100.7/32", "8080/tcp,0.0.0.0/0", "53/udp,10.0.0.0/8"}
+	if fmt.Sprint(rules) != fmt.Sprint(want) {
+		t.Errorf("Expected rules %v, got %v", want, rules)
+	}
+	var spec InstanceSpec
+	for _, created := range provider.specs {
+		spec = created
+	}
+	if fmt.Sprint(spec.SecurityGroups) != "[default tins-web]" || spec.Metadata[SecurityGroupTag] != "tins-web" {
+		t.Errorf("Expected the instance to boot with the default group and its own, got %v, %v", spec.SecurityGroups, spec.Metadata)
+	}
+
+	if _, err := runCommand(t, "terminate", "web"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	if len(provider.securityGroups) != 0 {
+		t.Errorf("Expected terminate to delete the security group, got %v", provider.securityGroups)
+	}
+
+	// terminate --all deletes groups whose instance is already gone
+	provider.securityGroups["tins-orphan"] = nil
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	if len(provider.securityGroups) != 0 {
+		t.Errorf("Expected terminate --all to delete orphaned security groups, got %v", provider.securityGroups)
+	}
+
+	if _, err := runCommand(t, "create", "bad", "--open-port", "http"); err == nil {
+		t.Error("Expected create to reject an invalid --open-port")
+	}
+}
+
+func TestPortsOpenClose(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	writePublicIPURLConfig(t, useCallerIP(t, "198.51.100.7"))
+
+	if _, err := runCommand(t, "create", "app"); err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	if _, err := runCommand(t, "ports", "close", "app", "8080"); err == nil || !strings.Contains(err.Error(), "no tins security group") {
+		t.Errorf("Expected close to fail without a tins security group, got %v", err)
+	}
+
+	// The first open creates and attaches a group for the instance
+	output, err := runCommand(t, "ports", "open", "app", "8080")
+	if err != nil {
+		t.Fatalf("ports open failed: %v", err)
+	}
+	if !strings.Contains(output, "Created security group tins-app") {
+		t.Errorf("Expected the group to be created, got:\n%s", output)
+	}
+	instance, err := findInstance(t.Context(), provider, "app")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	if instance.Metadata[SecurityGroupTag] != "tins-app" || len(provider.attachedGroups[instance.ID]) != 1 {
+		t.Errorf("Expected the group to be attached and recorded, got %v, %v", provider.attachedGroups, instance.Metadata)
+	}
+
+	// Later opens add rules to the same group
+	if _, err := runCommand(t, "ports", "open", "app", "8080,10.0.0.0/8"); err != nil {
+		t.Fatalf("ports open failed: %v", err)
+	}
+	if len(provider.securityGroups["tins-app"]) != 3 {
+		t.Fatalf("Expected SSH and two 8080 rules, got %v", provider.securityGroups["tins-app"])
+	}
+
+	output, err = runCommand(t, "ports", "close", "app", "8080")
+	if err != nil {
+		t.Fatalf("ports close failed: %v", err)
+	}
+	if !strings.Contains(output, "2 rule(s) removed") || len(provider.securityGroups["tins-app"]) != 1 {
+		t.Errorf("Expected close without a CIDR to remove both rules, got %v:\n%s", provider.securityGroups["tins-app"], output)
+	}
+	if _, err := runCommand(t, "ports", "close", "app", "8080"); err == nil {
+		t.Error("Expected closing a port that isn't open to fail")
+	}
+}
+
+// useCallerIP starts a public IP lookup server that answers with body and returns its URL
+func useCallerIP(t *testing.T, body string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// writePublicIPURLConfig writes a config file that looks up the caller's public IP at url
+func writePublicIPURLConfig(t *testing.T, url string) {
+	t.Helper()
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte("public_ip_url: "+url+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// InstanceStatusActive is the status of a running instance
+	InstanceStatusActive = "ACTIVE"
+	// InstanceStatusError is the status of an instance that failed to build or run
+	InstanceStatusError = "ERROR"
+)
+
+// Instance is a provider-neutral view of a temporary instance
+type Instance struct {
+	ID        string
+	Name      string
+	Status    string // Provider status, normalized to upper case (e.g. "ACTIVE", "BUILD", "ERROR")
+	Created   time.Time
+	Addresses []InstanceAddress
+	FlavorID  string
+	ImageID   string
+	Metadata  map[string]string
+}
+
+// InstanceAddress is a single IP address attached to an instance
+type InstanceAddress struct {
+	Network string // Name of the network the address belongs to
+	Addr    string // IP address
+	Type    string // Address type ("fixed" or "floating"), empty if not reported
+}
+
+// IP returns the address to use for SSH connections to the instance.
+// Floating IPs are preferred over fixed ones; an empty string means no address was found.
+func (i *Instance) IP() string {
+	for _, address := range i.Addresses {
+		if address.Type == "floating" {
+			return address.Addr
+		}
+	}
+	if len(i.Addresses) > 0 {
+		return i.Addresses[0].Addr
+	}
+	return ""
+}
+
+// FloatingIP is a public address allocated by tins for an instance
+type FloatingIP struct {
+	ID      string
+	Address string // Public IP address
+	PortID  string // Port the address is associated with; empty once the instance is gone
+}
+
+// InstanceSpec describes a temporary instance to create
+type InstanceSpec struct {
+	Name      string            // Full instance name (including the tins- prefix)
+	PublicKey string            // SSH public key to import as the instance keypair (optional)
+	KeyName   string            // Existing keypair to use instead of importing PublicKey (optional)
+	UserData  []byte            // Cloud-init user data (optional)
+	Metadata  map[string]string // Extra metadata stored alongside the tins tag (optional)
+	NetworkID string            // Network to boot on instead of the configured network (optional)
+
+	SecurityGroups []string // Security groups to boot with; the project default is used when empty (optional)
+
+	BootVolumeSize int    // Size in GB of a volume created from the image to boot from; 0 boots from the image (optional)
+	VolumeType     string // Volume type of the boot volume (optional)
+
+	ImageName string // Image to boot from instead of the configured image, e.g. a tins snapshot (optional)
+}
+
+// Snapshot is an image tins created from an instance
+type Snapshot struct {
+	ID             string
+	Name           string
+	Status         string // Provider status, e.g. "active"
+	SourceInstance string // Name of the instance the snapshot was taken of
+	Created        time.Time
+}
+
+// Volume is a block storage volume created by tins
+type Volume struct {
+	ID         string
+	Name       string
+	SizeGB     int
+	VolumeType string
+	Status     string            // Provider status, e.g. "available" or "in-use"
+	ServerIDs  []string          // Instances the volume is attached to
+	Metadata   map[string]string // Volume metadata, including the tins tag
+}
+
+// VolumeSpec describes a volume to create
+type VolumeSpec struct {
+	Name       string
+	SizeGB     int
+	VolumeType string            // Volume type (optional, default: the cloud's default type)
+	Metadata   map[string]string // Extra metadata stored alongside the tins tag (optional)
+}
+
+// NetworkSpec describes a network, subnet and router created for a single instance
+type NetworkSpec struct {
+	Name            string   // Name of the network, subnet and router (the full instance name)
+	CIDR            string   // Subnet address range
+	DNSNameservers  []string // DNS servers handed out on the subnet (optional)
+	ExternalNetwork string   // Name of the external network the router is attached to
+}
+
+// Provider is implemented by each cloud backend that can host temporary instances
+type Provider interface {
+	// CreateInstance creates a new temporary instance and returns it without waiting for it to boot
+	CreateInstance(ctx context.Context, spec InstanceSpec) (*Instance, error)
+	// ListInstances lists all temporary instances
+	ListInstances(ctx context.Context) ([]Instance, error)
+	// GetInstance retrieves an instance by ID
+	GetInstance(ctx context.Context, instanceID string) (*Instance, error)
+	// DeleteInstance deletes an instance by ID
+	DeleteInstance(ctx context.Context, instanceID string) error
+	// UpdateInstanceMetadata sets or replaces the given metadata keys on an instance
+	UpdateInstanceMetadata(ctx context.Context, instanceID string, metadata map[string]string) error
+	// WaitForInstanceActive waits for an instance to become active
+	WaitForInstanceActive(ctx context.Context, instanceID string, timeout time.Duration) error
+	// GetConsoleOutput returns the instance's console log
+	GetConsoleOutput(ctx context.Context, instanceID string) (string, error)
+	// CreateKeypair imports a public key under the given name
+	CreateKeypair(ctx context.Context, keypairName string, publicKey string) error
+	// EnsureKeypair imports a public key under the given name unless a keypair with that name already exists
+	EnsureKeypair(ctx context.Context, keypairName string, publicKey string) error
+	// DeleteKeypair deletes a keypair by name
+	DeleteKeypair(ctx context.Context, keypairName string) error
+	// ListKeypairs lists the names of the keypairs named like tins instances
+	ListKeypairs(ctx context.Context) ([]string, error)
+	// AllocateFloatingIP allocates a floating IP from the named external network and associates it with the instance
+	AllocateFloatingIP(ctx context.Context, instanceID string, pool string) (*FloatingIP, error)
+	// ListFloatingIPs lists the floating IPs allocated by tins
+	ListFloatingIPs(ctx context.Context) ([]FloatingIP, error)
+	// ReleaseFloatingIP releases a floating IP by ID
+	ReleaseFloatingIP(ctx context.Context, floatingIPID string) error
+	// CreateInstanceNetwork creates a tagged network, subnet and router and returns the network ID
+	CreateInstanceNetwork(ctx context.Context, spec NetworkSpec) (string, error)
+	// DeleteInstanceNetwork deletes the router, subnet and network created under the given name
+	DeleteInstanceNetwork(ctx context.Context, name string) error
+	// ListInstanceNetworks lists the names of the instance networks and routers created by tins
+	ListInstanceNetworks(ctx context.Context) ([]string, error)
+	// CreateSecurityGroup creates a tagged security group with the given ingress rules
+	CreateSecurityGroup(ctx context.Context, name string, rules []PortRule) error
+	// AddSecurityGroupRule adds an ingress rule to a tins security group
+	AddSecurityGroupRule(ctx context.Context, name string, rule PortRule) error
+	// RemoveSecurityGroupRule removes the matching ingress rules (any source if rule.CIDR is empty) and returns how many
+	RemoveSecurityGroupRule(ctx context.Context, name string, rule PortRule) (int, error)
+	// AttachSecurityGroup adds a security group to a running instance
+	AttachSecurityGroup(ctx context.Context, instanceID string, name string) error
+	// DeleteSecurityGroup deletes a tins security group by name
+	DeleteSecurityGroup(ctx context.Context, name string) error
+	// ListSecurityGroups lists the names of the security groups created by tins
+	ListSecurityGroups(ctx context.Context) ([]string, error)
+	// CreateVolume creates a tagged volume and returns it without waiting for it to become available
+	CreateVolume(ctx context.Context, spec VolumeSpec) (*Volume, error)
+	// ListVolumes lists the volumes created by tins
+	ListVolumes(ctx context.Context) ([]Volume, error)
+	// AttachVolume attaches a volume to an instance once the volume is available and waits until it is in use
+	AttachVolume(ctx context.Context, instanceID string, volumeID string) error
+	// DetachVolume detaches a volume from an instance and waits until it is available
+	DetachVolume(ctx context.Context, instanceID string, volumeID string) error
+	// DeleteVolume deletes a volume by ID once it is no longer attached
+	DeleteVolume(ctx context.Context, volumeID string) error
+	// CreateVolumeSnapshot starts a tagged snapshot of a volume, even one in use, and returns the snapshot ID
+	CreateVolumeSnapshot(ctx context.Context, volumeID string, name string) (string, error)
+	// CreateSnapshot creates an image of an instance, waits until it is active and tags it as a tins snapshot
+	CreateSnapshot(ctx context.Context, instance *Instance, name string) (*Snapshot, error)
+	// ListSnapshots lists the images tagged as tins snapshots
+	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	// DeleteSnapshot deletes a snapshot image by ID
+	DeleteSnapshot(ctx context.Context, snapshotID string) error
+}
+
+// newProvider creates the provider used by commands. Tests replace it to run commands without a cloud.
+var newProvider = NewProvider
+
+// NewProvider creates the provider for the loaded configuration
+func NewProvider(ctx context.Context, config *OpenStackConfig) (Provider, error) {
+	client, err := NewOpenStackClient(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OpenStack client: %w", err)
+	}
+	return client, nil
+}
+
+// findInstance resolves an instance by full name (tins-<name>), short name (<name>) or ID
+func findInstance(ctx context.Context, provider Provider, identifier string) (*Instance, error) {
+	allInstances, err := provider.ListInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Full instance names must match exactly
+	if strings.HasPrefix(identifier, InstanceNamePrefix) {
+		for i := range allInstances {
+			if allInstances[i].Name == identifier {
+				return &allInstances[i], nil
+			}
+		}
+		return nil, fmt.Errorf("instance '%s' not found", identifier)
+	}
+
+	// Try the name part (without prefix) first
+	fullName := fmt.Sprintf("%s%s", InstanceNamePrefix, identifier)
+	for i := range allInstances {
+		if allInstances[i].Name == fullName {
+			return &allInstances[i], nil
+		}
+	}
+
+	// Assume it's an instance ID
+	return provider.GetInstance(ctx, identifier)
+}
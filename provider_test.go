@@ -0,0 +1,577 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeProvider is an in-memory Provider for exercising commands without a cloud
+type fakeProvider struct {
+	instances map[string]*Instance
+	keypairs  map[string]string
+	specs     map[string]InstanceSpec
+	nextID    int
+
+	// floatingIPs holds the allocated floating IPs by ID
+	floatingIPs map[string]*FloatingIP
+	// networks holds the instance networks by name
+	networks map[string]NetworkSpec
+	// securityGroups holds the rules of the security groups by name
+	securityGroups map[string][]PortRule
+	// attachedGroups holds the security groups added to running instances by instance ID
+	attachedGroups map[string][]string
+	// volumes holds the created volumes by ID
+	volumes map[string]*Volume
+	// volumeSnapshots holds the volume ID of each volume snapshot by name
+	volumeSnapshots map[string]string
+	// snapshots holds the instance snapshots by ID
+	snapshots map[string]*Snapshot
+
+	// consoleOutput holds each instance's console log, with generated host keys printed by "cloud-init"
+	consoleOutput map[string]string
+}
+
+func newFakeProvider() *fakeProvider {
+	return &fakeProvider{
+		instances: make(map[string]*Instance),
+		keypairs:  make(map[string]string),
+		specs:     make(map[string]InstanceSpec),
+
+		floatingIPs:    make(map[string]*FloatingIP),
+		networks:       make(map[string]NetworkSpec),
+		securityGroups: make(map[string][]PortRule),
+		attachedGroups: make(map[string][]string),
+		volumes:        make(map[string]*Volume),
+		consoleOutput:  make(map[string]string),
+
+		volumeSnapshots: make(map[string]string),
+		snapshots:       make(map[string]*Snapshot),
+	}
+}
+
+func (p *fakeProvider) CreateInstance(_ context.Context, spec InstanceSpec) (*Instance, error) {
+	p.nextID++
+	instance := &Instance{
+		ID:      fmt.Sprintf("id-%d", p.nextID),
+		Name:    spec.Name,
+		Status:  InstanceStatusActive,
+		Created: time.Now(),
+		Addresses: []InstanceAddress{
+			{Network: "private", Addr: fmt.Sprintf("10.0.0.%d", p.nextID), Type: "fixed"},
+		},
+		Metadata: map[string]string{TempInstanceTag: "true"},
+	}
+	for key, value := range spec.Metadata {
+		instance.Metadata[key] = value
+	}
+	if spec.PublicKey != "" && spec.KeyName == "" {
+		p.keypairs[spec.Name] = spec.PublicKey
+	}
+	p.instances[instance.ID] = instance
+	p.specs[instance.ID] = spec
+	p.consoleOutput[instance.ID] = fakeConsoleOutput(newFakeHostKey())
+	copied := *instance
+	return &copied, nil
+}
+
+func (p *fakeProvider) ListInstances(_ context.Context) ([]Instance, error) {
+	var result []Instance
+	for _, instance := range p.instances {
+		result = append(result, *instance)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) GetInstance(_ context.Context, instanceID string) (*Instance, error) {
+	instance, ok := p.instances[instanceID]
+	if !ok {
+		return nil, fmt.Errorf("instance %s not found", instanceID)
+	}
+	copied := *instance
+	return &copied, nil
+}
+
+func (p *fakeProvider) DeleteInstance(_ context.Context, instanceID string) error {
+	if _, ok := p.instances[instanceID]; !ok {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	delete(p.instances, instanceID)
+	// Like Nova, deleting a server detaches its volumes
+	for _, volume := range p.volumes {
+		volume.ServerIDs = removeString(volume.ServerIDs, instanceID)
+		if len(volume.ServerIDs) == 0 {
+			volume.Status = "available"
+		}
+	}
+	return nil
+}
+
+func (p *fakeProvider) UpdateInstanceMetadata(_ context.Context, instanceID string, metadata map[string]string) error {
+	instance, ok := p.instances[instanceID]
+	if !ok {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	for key, value := range metadata {
+		instance.Metadata[key] = value
+	}
+	return nil
+}
+
+func (p *fakeProvider) GetConsoleOutput(_ context.Context, instanceID string) (string, error) {
+	if _, ok := p.instances[instanceID]; !ok {
+		return "", fmt.Errorf("instance %s not found", instanceID)
+	}
+	return p.consoleOutput[instanceID], nil
+}
+
+func (p *fakeProvider) WaitForInstanceActive(_ context.Context, instanceID string, _ time.Duration) error {
+	if _, ok := p.instances[instanceID]; !ok {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	return nil
+}
+
+func (p *fakeProvider) CreateKeypair(_ context.Context, keypairName string, publicKey string) error {
+	p.keypairs[keypairName] = publicKey
+	return nil
+}
+
+func (p *fakeProvider) EnsureKeypair(_ context.Context, keypairName string, publicKey string) error {
+	if _, ok := p.keypairs[keypairName]; !ok {
+		p.keypairs[keypairName] = publicKey
+	}
+	return nil
+}
+
+func (p *fakeProvider) DeleteKeypair(_ context.Context, keypairName string) error {
+	if _, ok := p.keypairs[keypairName]; !ok {
+		return fmt.Errorf("keypair %s not found", keypairName)
+	}
+	delete(p.keypairs, keypairName)
+	return nil
+}
+
+func (p *fakeProvider) ListKeypairs(_ context.Context) ([]string, error) {
+	var names []string
+	for name := range p.keypairs {
+		if strings.HasPrefix(name, InstanceNamePrefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (p *fakeProvider) AllocateFloatingIP(_ context.Context, instanceID string, pool string) (*FloatingIP, error) {
+	instance, ok := p.instances[instanceID]
+	if !ok {
+		return nil, fmt.Errorf("instance %s not found", instanceID)
+	}
+	p.nextID++
+	floatingIP := &FloatingIP{
+		ID:      fmt.Sprintf("fip-%d", p.nextID),
+		Address: fmt.Sprintf("203.0.113.%d", p.nextID),
+		PortID:  "port-" + instanceID,
+	}
+	p.floatingIPs[floatingIP.ID] = floatingIP
+	instance.Addresses = append(instance.Addresses, InstanceAddress{Network: "private", Addr: floatingIP.Address, Type: "floating"})
+	copied := *floatingIP
+	return &copied, nil
+}
+
+func (p *fakeProvider) ListFloatingIPs(_ context.Context) ([]FloatingIP, error) {
+	var result []FloatingIP
+	for _, floatingIP := range p.floatingIPs {
+		result = append(result, *floatingIP)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) ReleaseFloatingIP(_ context.Context, floatingIPID string) error {
+	if _, ok := p.floatingIPs[floatingIPID]; !ok {
+		return fmt.Errorf("floating IP %s not found", floatingIPID)
+	}
+	delete(p.floatingIPs, floatingIPID)
+	return nil
+}
+
+func (p *fakeProvider) CreateInstanceNetwork(_ context.Context, spec NetworkSpec) (string, error) {
+	if _, ok := p.networks[spec.Name]; ok {
+		return "", fmt.Errorf("network %s already exists", spec.Name)
+	}
+	p.networks[spec.Name] = spec
+	return "net-" + spec.Name, nil
+}
+
+func (p *fakeProvider) DeleteInstanceNetwork(_ context.Context, name string) error {
+	if _, ok := p.networks[name]; !ok {
+		return fmt.Errorf("network %s not found", name)
+	}
+	delete(p.networks, name)
+	return nil
+}
+
+func (p *fakeProvider) ListInstanceNetworks(_ context.Context) ([]string, error) {
+	var result []string
+	for name := range p.networks {
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) CreateSecurityGroup(_ context.Context, name string, rules []PortRule) error {
+	if _, ok := p.securityGroups[name]; ok {
+		return fmt.Errorf("security group %s already exists", name)
+	}
+	p.securityGroups[name] = append([]PortRule(nil), rules...)
+	return nil
+}
+
+func (p *fakeProvider) AddSecurityGroupRule(_ context.Context, name string, rule PortRule) error {
+	if _, ok := p.securityGroups[name]; !ok {
+		return fmt.Errorf("security group %s not found", name)
+	}
+	p.securityGroups[name] = append(p.securityGroups[name], rule)
+	return nil
+}
+
+func (p *fakeProvider) RemoveSecurityGroupRule(_ context.Context, name string, rule PortRule) (int, error) {
+	rules, ok := p.securityGroups[name]
+	if !ok {
+		return 0, fmt.Errorf("security group %s not found", name)
+	}
+	var kept []PortRule
+	for _, existing := range rules {
+		if existing.Protocol == rule.Protocol && existing.PortMin == rule.PortMin && existing.PortMax == rule.PortMax &&
+			(rule.CIDR == "" || existing.CIDR == rule.CIDR) {
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	p.securityGroups[name] = kept
+	return len(rules) - len(kept), nil
+}
+
+func (p *fakeProvider) AttachSecurityGroup(_ context.Context, instanceID string, name string) error {
+	if _, ok := p.instances[instanceID]; !ok {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	if _, ok := p.securityGroups[name]; !ok {
+		return fmt.Errorf("security group %s not found", name)
+	}
+	p.attachedGroups[instanceID] = append(p.attachedGroups[instanceID], name)
+	return nil
+}
+
+func (p *fakeProvider) DeleteSecurityGroup(_ context.Context, name string) error {
+	if _, ok := p.securityGroups[name]; !ok {
+		return fmt.Errorf("security group %s not found", name)
+	}
+	delete(p.securityGroups, name)
+	return nil
+}
+
+func (p *fakeProvider) ListSecurityGroups(_ context.Context) ([]string, error) {
+	var result []string
+	for name := range p.securityGroups {
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) CreateVolume(_ context.Context, spec VolumeSpec) (*Volume, error) {
+	p.nextID++
+	volume := &Volume{
+		ID:         fmt.Sprintf("vol-%d", p.nextID),
+		Name:       spec.Name,
+		SizeGB:     spec.SizeGB,
+		VolumeType: spec.VolumeType,
+		Status:     "available",
+		Metadata:   map[string]string{TempInstanceTag: "true"},
+	}
+	for key, value := range spec.Metadata {
+		volume.Metadata[key] = value
+	}
+	p.volumes[volume.ID] = volume
+	copied := *volume
+	return &copied, nil
+}
+
+func (p *fakeProvider) ListVolumes(_ context.Context) ([]Volume, error) {
+	var result []Volume
+	for _, volume := range p.volumes {
+		result = append(result, *volume)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) AttachVolume(_ context.Context, instanceID string, volumeID string) error {
+	if _, ok := p.instances[instanceID]; !ok {
+		return fmt.Errorf("instance %s not found", instanceID)
+	}
+	volume, ok := p.volumes[volumeID]
+	if !ok {
+		return fmt.Errorf("volume %s not found", volumeID)
+	}
+	if len(volume.ServerIDs) > 0 {
+		return fmt.Errorf("volume %s is already attached", volumeID)
+	}
+	volume.ServerIDs = []string{instanceID}
+	volume.Status = "in-use"
+	return nil
+}
+
+func (p *fakeProvider) DetachVolume(_ context.Context, instanceID string, volumeID string) error {
+	volume, ok := p.volumes[volumeID]
+	if !ok {
+		return fmt.Errorf("volume %s not found", volumeID)
+	}
+	volume.ServerIDs = removeString(volume.ServerIDs, instanceID)
+	if len(volume.ServerIDs) == 0 {
+		volume.Status = "available"
+	}
+	return nil
+}
+
+func (p *fakeProvider) DeleteVolume(_ context.Context, volumeID string) error {
+	volume, ok := p.volumes[volumeID]
+	if !ok {
+		return fmt.Errorf("volume %s not found", volumeID)
+	}
+	if len(volume.ServerIDs) > 0 {
+		return fmt.Errorf("volume %s is still attached to %v", volumeID, volume.ServerIDs)
+	}
+	delete(p.volumes, volumeID)
+	return nil
+}
+
+func (p *fakeProvider) CreateVolumeSnapshot(_ context.Context, volumeID string, name string) (string, error) {
+	if _, ok := p.volumes[volumeID]; !ok {
+		return "", fmt.Errorf("volume %s not found", volumeID)
+	}
+	p.volumeSnapshots[name] = volumeID
+	return "snap-" + name, nil
+}
+
+func (p *fakeProvider) CreateSnapshot(_ context.Context, instance *Instance, name string) (*Snapshot, error) {
+	if _, ok := p.instances[instance.ID]; !ok {
+		return nil, fmt.Errorf("instance %s not found", instance.ID)
+	}
+	p.nextID++
+	snapshot := &Snapshot{
+		ID:             fmt.Sprintf("image-%d", p.nextID),
+		Name:           name,
+		Status:         "active",
+		SourceInstance: instance.Name,
+		Created:        time.Now(),
+	}
+	p.snapshots[snapshot.ID] = snapshot
+	copied := *snapshot
+	return &copied, nil
+}
+
+func (p *fakeProvider) ListSnapshots(_ context.Context) ([]Snapshot, error) {
+	var result []Snapshot
+	for _, snapshot := range p.snapshots {
+		result = append(result, *snapshot)
+	}
+	return result, nil
+}
+
+func (p *fakeProvider) DeleteSnapshot(_ context.Context, snapshotID string) error {
+	if _, ok := p.snapshots[snapshotID]; !ok {
+		return fmt.Errorf("snapshot %s not found", snapshotID)
+	}
+	delete(p.snapshots, snapshotID)
+	return nil
+}
+
+// removeString returns values without value
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, existing := range values {
+		if existing != value {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
+
+// useFakeProvider makes commands use the given provider for the duration of the test
+func useFakeProvider(t *testing.T, provider Provider) {
+	t.Helper()
+	original := newProvider
+	newProvider = func(context.Context, *OpenStackConfig) (Provider, error) {
+		return provider, nil
+	}
+	t.Cleanup(func() { newProvider = original })
+}
+
+func TestFindInstance(t *testing.T) {
+	ctx := context.Background()
+	provider := newFakeProvider()
+	created, err := provider.CreateInstance(ctx, InstanceSpec{Name: "tins-mystical-honda"})
+	if err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+
+	for _, identifier := range []string{"tins-mystical-honda", "mystical-honda", created.ID} {
+		instance, err := findInstance(ctx, provider, identifier)
+		if err != nil {
+			t.Errorf("findInstance(%q) failed: %v", identifier, err)
+			continue
+		}
+		if instance.ID != created.ID {
+			t.Errorf("findInstance(%q) returned ID '%s', expected '%s'", identifier, instance.ID, created.ID)
+		}
+	}
+
+	if _, err := findInstance(ctx, provider, "tins-missing"); err == nil {
+		t.Error("findInstance should fail for an unknown full instance name")
+	}
+	if _, err := findInstance(ctx, provider, "missing"); err == nil {
+		t.Error("findInstance should fail for an unknown name or ID")
+	}
+}
+
+func TestInstanceIP(t *testing.T) {
+	instance := &Instance{}
+	if instance.IP() != "" {
+		t.Errorf("Expected empty IP for instance without addresses, got '%s'", instance.IP())
+	}
+
+	instance.Addresses = []InstanceAddress{
+		{Network: "private", Addr: "10.0.0.5", Type: "fixed"},
+		{Network: "private", Addr: "203.0.113.10", Type: "floating"},
+	}
+	if instance.IP() != "203.0.113.10" {
+		t.Errorf("Expected floating IP to be preferred, got '%s'", instance.IP())
+	}
+
+	instance.Addresses = instance.Addresses[:1]
+	if instance.IP() != "10.0.0.5" {
+		t.Errorf("Expected fixed IP, got '%s'", instance.IP())
+	}
+}
+
+// setTestConfigEnv provides a complete configuration through environment variables
+// and moves to an empty directory so no local config file is picked up
+func setTestConfigEnv(t *testing.T) {
+	t.Helper()
+	envVars := map[string]string{
+		"OS_AUTH_URL":          "https://test.openstack.com/keystone/v3",
+		"OS_USERNAME":          "testuser@example.com",
+		"OS_PROJECT_ID":        "test-project-id",
+		"OS_PROJECT_NAME":      "test-project",
+		"OS_REGION_NAME":       "test-region",
+		"OS_AVAILABILITY_ZONE": "test-az",
+		"OS_IMAGE_NAME":        "test-image",
+		"OS_NETWORK_NAME":      "test-network",
+		"OS_PASSWORD":          "test-password",
+	}
+	for key, value := range envVars {
+		t.Setenv(key, value)
+	}
+	for _, key := range []string{"OS_CLOUD", "TINS_PROFILE", "OS_AUTH_TYPE", "OS_TOKEN",
+		"OS_APPLICATION_CREDENTIAL_ID", "OS_APPLICATION_CREDENTIAL_NAME", "OS_APPLICATION_CREDENTIAL_SECRET", "SSH_AUTH_SOCK"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+}
+
+func TestTerminateCommand_FakeProvider(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	ctx := context.Background()
+	keyPair, err := GenerateSSHKey("mystical-honda", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	if _, err := provider.CreateInstance(ctx, InstanceSpec{Name: "tins-mystical-honda", PublicKey: keyPair.PublicKey}); err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+
+	rootCmd.SetArgs([]string{"terminate", "mystical-honda"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+
+	if len(provider.instances) != 0 {
+		t.Errorf("Expected instance to be deleted, %d remaining", len(provider.instances))
+	}
+	if _, ok := provider.keypairs["tins-mystical-honda"]; ok {
+		t.Error("Expected keypair to be deleted")
+	}
+	if _, err := os.Stat(keyPair.PrivateKeyPath); !os.IsNotExist(err) {
+		t.Error("Expected local private key to be deleted")
+	}
+}
+
+// flakyKeypairProvider is a fakeProvider whose first keypair deletions fail
+type flakyKeypairProvider struct {
+	*fakeProvider
+	failures int
+}
+
+func (p *flakyKeypairProvider) DeleteKeypair(ctx context.Context, keypairName string) error {
+	if p.failures > 0 {
+		p.failures--
+		return fmt.Errorf("service unavailable")
+	}
+	return p.fakeProvider.DeleteKeypair(ctx, keypairName)
+}
+
+func TestTerminateAll_LeftoverKeypairs(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, &flakyKeypairProvider{fakeProvider: provider, failures: 1})
+	resetFlagsAfterTest(t, terminateCmd)
+
+	if _, err := provider.CreateInstance(t.Context(), InstanceSpec{Name: "tins-doomed", PublicKey: "ssh-ed25519 AAAA doomed"}); err != nil {
+		t.Fatalf("CreateInstance failed: %v", err)
+	}
+	// Keypairs are per user, so this may be a live instance in another project
+	provider.keypairs["tins-elsewhere"] = "ssh-ed25519 AAAA elsewhere"
+
+	output, err := runCommand(t, "terminate", "--all")
+	if err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	if _, ok := provider.keypairs["tins-doomed"]; ok || !strings.Contains(output, "Deleted leftover keypair tins-doomed") {
+		t.Errorf("Expected the keypair of the terminated instance to be deleted on retry, got %v:\n%s", provider.keypairs, output)
+	}
+	if _, ok := provider.keypairs["tins-elsewhere"]; !ok {
+		t.Error("Expected a keypair of an instance this run didn't terminate to be kept")
+	}
+}
+
+// newFakeHostKey generates an Ed25519 host key for a fake instance
+func newFakeHostKey() ssh.PublicKey {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := ssh.NewPublicKey(publicKey)
+	return key
+}
+
+// fakeConsoleOutput returns a console log in which cloud-init prints the given host keys
+func fakeConsoleOutput(keys ...ssh.PublicKey) string {
+	var b strings.Builder
+	b.WriteString("[    1.234567] Booting instance\n")
+	b.WriteString("ec2: \nec2: #############################################################\n")
+	b.WriteString(hostKeysBeginMarker + "\n")
+	for _, key := range keys {
+		b.WriteString(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))) + " root@instance\n")
+	}
+	b.WriteString(hostKeysEndMarker + "\n")
+	b.WriteString("ec2: #############################################################\n")
+	return b.String()
+}
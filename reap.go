@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var reapCmd = &cobra.Command{
+	Use:   "reap",
+	Short: "Terminate expired temporary instances",
+	Long:  "Terminate all ephemeral OpenStack instances whose time-to-live has passed, cleaning up their keypairs and local SSH keys. Instances created without --ttl are never reaped. Suitable for running from cron.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instances, err := client.ListInstances(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %w", err)
+		}
+
+		now := time.Now()
+		var expired []Instance
+		for _, instance := range instances {
+			if instance.IsExpired(now) {
+				expired = append(expired, instance)
+			}
+		}
+
+		if len(expired) == 0 {
+			fmt.Printf("No expired tins instances found.\n")
+			return nil
+		}
+
+		fmt.Printf("Found %d expired tins instance(s):\n", len(expired))
+		for _, instance := range expired {
+			expiresAt, _ := instance.ExpiresAt()
+			fmt.Printf("  - %s (ID: %s, expired: %s)\n", instance.Name, instance.ID, formatExpiresAt(expiresAt))
+		}
+
+		if dryRun {
+			fmt.Printf("\nDry run: no instances were terminated.\n")
+			return nil
+		}
+
+		failed := 0
+		for _, instance := range expired {
+			fmt.Printf("\nTerminating instance %s (ID: %s)...\n", instance.Name, instance.ID)
+			if err := terminateInstance(ctx, client, &instance, os.Stdout); err != nil {
+				fmt.Printf("Error: Failed to delete instance %s: %v\n", instance.Name, err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to terminate %d of %d expired instance(s)", failed, len(expired))
+		}
+		return nil
+	},
+}
+
+func init() {
+	reapCmd.Flags().Bool("dry-run", false, "Only list expired instances without terminating them")
+	rootCmd.AddCommand(reapCmd)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// appendAuthorizedKeysScript reads keys from stdin and appends those missing from ~/.ssh/authorized_keys
+const appendAuthorizedKeysScript = `umask 077 && mkdir -p ~/.ssh && touch ~/.ssh/authorized_keys && ` +
+	`while IFS= read -r key; do grep -qxF "$key" ~/.ssh/authorized_keys || printf '%s\n' "$key" >> ~/.ssh/authorized_keys; done`
+
+var shareCmd = &cobra.Command{
+	Use:   "share <instance-name-or-id> <public-key>",
+	Short: "Allow another SSH key to log in to a running instance",
+	Long:  "Append a public key to ~/.ssh/authorized_keys on a running instance over SSH, so a teammate can log in. The key can be a public key file or a key string; keys that are already authorized are not added again.",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sshUser, _ := cmd.Flags().GetString("user")
+		instanceIdentifier := args[0]
+
+		keys, err := resolveAuthorizedKeys([]string{args[1]})
+		if err != nil {
+			return err
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, instanceIdentifier)
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		target, err := sshTargetForInstance(instance, sshUser, config)
+		if err != nil {
+			return err
+		}
+
+		keyList := strings.Join(keys, "\n") + "\n"
+		exitCode, err := runRemoteCommand(target, appendAuthorizedKeysScript, strings.NewReader(keyList), os.Stdout, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("failed to update authorized_keys on %s: remote command exited with status %d", instance.Name, exitCode)
+		}
+
+		fmt.Printf("Authorized %d key(s) for %s@%s (%s)\n", len(keys), target.User, instance.Name, target.Host)
+		return nil
+	},
+}
+
+func init() {
+	shareCmd.Flags().String("user", "", "SSH user whose authorized_keys is updated (default: login_user from the config file)")
+	rootCmd.AddCommand(shareCmd)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// findSnapshot looks up a tins snapshot by name
+func findSnapshot(ctx context.Context, client Provider, name string) (*Snapshot, error) {
+	snapshots, err := client.ListSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			return &snapshots[i], nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot '%s' not found", name)
+}
+
+// snapshotsToPrune returns the snapshots beyond the newest keep of each source instance.
+// A non-empty source limits pruning to the snapshots of that instance.
+func snapshotsToPrune(snapshots []Snapshot, keep int, source string) []Snapshot {
+	sorted := append([]Snapshot{}, snapshots...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	var prune []Snapshot
+	kept := make(map[string]int)
+	for _, snapshot := range sorted {
+		if source != "" && snapshot.SourceInstance != source {
+			continue
+		}
+		if kept[snapshot.SourceInstance] < keep {
+			kept[snapshot.SourceInstance]++
+			continue
+		}
+		prune = append(prune, snapshot)
+	}
+	return prune
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot <instance-name-or-id> [image-name]",
+	Short: "Snapshot a temporary instance",
+	Long:  "Create an image of a temporary instance and wait until it is active. The image is tagged as a tins snapshot with the source instance name; boot it with 'tins create --from-snapshot <image-name>'. The image name defaults to <instance>-<timestamp>.",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instance, err := findInstance(ctx, client, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
+
+		name := fmt.Sprintf("%s-%s", instance.Name, time.Now().UTC().Format("20060102-150405"))
+		if len(args) > 1 {
+			name = args[1]
+		}
+		// create --from-snapshot looks images up by name, so names must be unique
+		if _, err := findSnapshot(ctx, client, name); err == nil {
+			return fmt.Errorf("snapshot '%s' already exists", name)
+		}
+
+		fmt.Printf("Creating snapshot %s of %s (this can take several minutes)...\n", name, instance.Name)
+		snapshot, err := client.CreateSnapshot(ctx, instance, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Snapshot %s is active (ID: %s)\n", snapshot.Name, snapshot.ID)
+		return nil
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Long:  "List the images created by 'tins snapshot', newest first.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		snapshots, err := client.ListSnapshots(ctx)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(snapshots, func(i, j int) bool {
+			return snapshots[i].Created.After(snapshots[j].Created)
+		})
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tSOURCE\tCREATED\t")
+		fmt.Fprintln(w, "---\t----\t------\t------\t-------\t")
+		for _, snapshot := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n",
+				snapshot.ID,
+				snapshot.Name,
+				snapshot.Status,
+				valueOrDash(snapshot.SourceInstance),
+				snapshot.Created.Format("2006-01-02 15:04:05"),
+			)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete [image-name...]",
+	Short: "Delete snapshots",
+	Long:  "Delete the named snapshots, or with --keep-last N every snapshot but the newest N of each instance (of --instance only, if given).",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		keepLast, _ := cmd.Flags().GetInt("keep-last")
+		source, _ := cmd.Flags().GetString("instance")
+		retention := cmd.Flags().Changed("keep-last")
+		if retention && len(args) > 0 {
+			return fmt.Errorf("cannot specify snapshot names with --keep-last")
+		}
+		if !retention && len(args) == 0 {
+			return fmt.Errorf("snapshot name required (or use --keep-last to delete old snapshots)")
+		}
+		if keepLast < 0 {
+			return fmt.Errorf("invalid --keep-last %d", keepLast)
+		}
+		if source != "" && !strings.HasPrefix(source, InstanceNamePrefix) {
+			source = InstanceNamePrefix + source
+		}
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		var doomed []Snapshot
+		if retention {
+			snapshots, err := client.ListSnapshots(ctx)
+			if err != nil {
+				return err
+			}
+			doomed = snapshotsToPrune(snapshots, keepLast, source)
+		} else {
+			for _, name := range args {
+				snapshot, err := findSnapshot(ctx, client, name)
+				if err != nil {
+					return err
+				}
+				doomed = append(doomed, *snapshot)
+			}
+		}
+
+		var failed int
+		for _, snapshot := range doomed {
+			if err := client.DeleteSnapshot(ctx, snapshot.ID); err != nil {
+				fmt.Printf("Error: Failed to delete snapshot %s: %v\n", snapshot.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("Deleted snapshot %s\n", snapshot.Name)
+		}
+		if retention && len(doomed) == 0 {
+			fmt.Printf("No snapshots to delete\n")
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to delete %d snapshot(s)", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	snapshotDeleteCmd.Flags().Int("keep-last", 0, "Delete all but the newest N snapshots of each instance")
+	snapshotDeleteCmd.Flags().String("instance", "", "With --keep-last, only prune the snapshots of this instance")
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotsToPrune(t *testing.T) {
+	now := time.Now()
+	snapshots := []Snapshot{
+		{Name: "a1", SourceInstance: "tins-a", Created: now.Add(-3 * time.Hour)},
+		{Name: "a3", SourceInstance: "tins-a", Created: now.Add(-1 * time.Hour)},
+		{Name: "b1", SourceInstance: "tins-b", Created: now.Add(-2 * time.Hour)},
+		{Name: "a2", SourceInstance: "tins-a", Created: now.Add(-2 * time.Hour)},
+	}
+
+	names := func(snapshots []Snapshot) string {
+		var result []string
+		for _, snapshot := range snapshots {
+			result = append(result, snapshot.Name)
+		}
+		return strings.Join(result, ",")
+	}
+	if got := names(snapshotsToPrune(snapshots, 1, "")); got != "a2,a1" {
+		t.Errorf("Expected to keep the newest snapshot of each instance, pruning a2,a1; got %s", got)
+	}
+	if got := names(snapshotsToPrune(snapshots, 0, "tins-b")); got != "b1" {
+		t.Errorf("Expected to prune only the snapshots of tins-b, got %s", got)
+	}
+	if got := names(snapshotsToPrune(snapshots, 5, "")); got != "" {
+		t.Errorf("Expected nothing to prune, got %s", got)
+	}
+}
+
+func TestSnapshotCreateBootDelete(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+	resetFlagsAfterTest(t, snapshotDeleteCmd)
+
+	if _, err := runCommand(t, "create", "golden"); err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	output, err := runCommand(t, "snapshot", "golden", "golden-v1")
+	if err != nil {
+		t.Fatalf("snapshot command failed: %v", err)
+	}
+	if !strings.Contains(output, "Snapshot golden-v1 is active") {
+		t.Errorf("Expected the snapshot to be reported active, got:\n%s", output)
+	}
+	if _, err := runCommand(t, "snapshot", "golden", "golden-v1"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Expected a duplicate snapshot name to fail, got %v", err)
+	}
+	if _, err := runCommand(t, "snapshot", "golden"); err != nil {
+		t.Fatalf("snapshot command failed: %v", err)
+	}
+
+	output, err = runCommand(t, "snapshot", "list")
+	if err != nil {
+		t.Fatalf("snapshot list failed: %v", err)
+	}
+	if !strings.Contains(output, "golden-v1") || !strings.Contains(output, "tins-golden-20") {
+		t.Errorf("Expected both snapshots in the list, got:\n%s", output)
+	}
+
+	if _, err := runCommand(t, "create", "clone", "--from-snapshot", "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected an unknown snapshot to fail, got %v", err)
+	}
+	if _, err := runCommand(t, "create", "clone", "--from-snapshot", "golden-v1"); err != nil {
+		t.Fatalf("create --from-snapshot failed: %v", err)
+	}
+	if spec := createdSpec(t, provider, "tins-clone"); spec.ImageName != "golden-v1" {
+		t.Errorf("Expected the clone to boot from golden-v1, got %q", spec.ImageName)
+	}
+
+	if _, err := runCommand(t, "snapshot", "delete"); err == nil {
+		t.Error("Expected snapshot delete without names or --keep-last to fail")
+	}
+	if _, err := runCommand(t, "snapshot", "delete", "golden-v1"); err != nil {
+		t.Fatalf("snapshot delete failed: %v", err)
+	}
+	if len(provider.snapshots) != 1 {
+		t.Fatalf("Expected one snapshot to remain, got %v", provider.snapshots)
+	}
+
+	// Backdate the remaining snapshot so a new one is the newest
+	for _, snapshot := range provider.snapshots {
+		snapshot.Created = snapshot.Created.Add(-time.Hour)
+	}
+	if _, err := runCommand(t, "snapshot", "golden", "golden-v2"); err != nil {
+		t.Fatalf("snapshot command failed: %v", err)
+	}
+	if _, err := runCommand(t, "snapshot", "delete", "--keep-last", "1", "--instance", "golden"); err != nil {
+		t.Fatalf("snapshot delete --keep-last failed: %v", err)
+	}
+	if _, err := findSnapshot(t.Context(), provider, "golden-v2"); err != nil || len(provider.snapshots) != 1 {
+		t.Errorf("Expected only golden-v2 to be kept, got %v", provider.snapshots)
+	}
+}
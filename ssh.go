@@ -1,13 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -19,8 +28,99 @@ type SSHKeyPair struct {
 	PublicKey      string
 }
 
-// GenerateSSHKey generates a new SSH key pair
-func GenerateSSHKey(instanceName string) (*SSHKeyPair, error) {
+const (
+	// KeyTypeEd25519 is an Ed25519 key (default)
+	KeyTypeEd25519 = "ed25519"
+	// KeyTypeECDSAP256 is an ECDSA key on the NIST P-256 curve
+	KeyTypeECDSAP256 = "ecdsa-p256"
+	// KeyTypeECDSAP384 is an ECDSA key on the NIST P-384 curve
+	KeyTypeECDSAP384 = "ecdsa-p384"
+	// KeyTypeRSA is an RSA key; the size can be given as rsa-<bits>
+	KeyTypeRSA = "rsa"
+
+	// DefaultRSAKeyBits is the RSA key size used when key_type is plain "rsa"
+	DefaultRSAKeyBits = 4096
+	// MinRSAKeyBits is the smallest RSA key size accepted
+	MinRSAKeyBits = 2048
+)
+
+// KeySpec describes the SSH key algorithm to generate. The zero value means Ed25519.
+type KeySpec struct {
+	Type string // KeyTypeEd25519, KeyTypeECDSAP256, KeyTypeECDSAP384 or KeyTypeRSA
+	Bits int    // RSA key size in bits (RSA only)
+}
+
+// String returns the key spec in the form accepted by parseKeyType
+func (k KeySpec) String() string {
+	if k.Type == KeyTypeRSA {
+		return fmt.Sprintf("%s-%d", KeyTypeRSA, k.Bits)
+	}
+	if k.Type == "" {
+		return KeyTypeEd25519
+	}
+	return k.Type
+}
+
+// parseKeyType parses a key_type value: ed25519, ecdsa-p256, ecdsa-p384, rsa or rsa-<bits>
+func parseKeyType(value string) (KeySpec, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "", KeyTypeEd25519:
+		return KeySpec{Type: KeyTypeEd25519}, nil
+	case KeyTypeECDSAP256, KeyTypeECDSAP384:
+		return KeySpec{Type: value}, nil
+	case KeyTypeRSA:
+		return KeySpec{Type: KeyTypeRSA, Bits: DefaultRSAKeyBits}, nil
+	}
+
+	if bitsValue, ok := strings.CutPrefix(value, KeyTypeRSA+"-"); ok {
+		bits, err := strconv.Atoi(bitsValue)
+		if err != nil {
+			return KeySpec{}, fmt.Errorf("invalid RSA key size '%s'", bitsValue)
+		}
+		if bits < MinRSAKeyBits {
+			return KeySpec{}, fmt.Errorf("RSA key size %d is too small (minimum %d)", bits, MinRSAKeyBits)
+		}
+		return KeySpec{Type: KeyTypeRSA, Bits: bits}, nil
+	}
+
+	return KeySpec{}, fmt.Errorf("unsupported key type '%s' (must be one of: ed25519, ecdsa-p256, ecdsa-p384, rsa, rsa-<bits>)", value)
+}
+
+// generatePrivateKey creates a private key for the given spec
+func generatePrivateKey(spec KeySpec) (crypto.PrivateKey, error) {
+	switch spec.Type {
+	case "", KeyTypeEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return privateKey, err
+	case KeyTypeECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyTypeECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyTypeRSA:
+		bits := spec.Bits
+		if bits == 0 {
+			bits = DefaultRSAKeyBits
+		}
+		return rsa.GenerateKey(rand.Reader, bits)
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", spec.Type)
+	}
+}
+
+// KeyStorage describes how a generated private key is kept. The zero value writes an unencrypted key file.
+type KeyStorage struct {
+	Passphrase    []byte        // Encrypts the private key file when set
+	Agent         string        // SSHAgentOff, SSHAgentAdd or SSHAgentOnly
+	AgentLifetime time.Duration // How long ssh-agent keeps the key, 0 for no limit
+
+	// CA signs the public key when set; the certificate is written next to the key and added to ssh-agent with it
+	CA *CertificateAuthority
+}
+
+// GenerateSSHKey generates a new SSH key pair of the given type, with the private key in OpenSSH format.
+// Depending on storage, the private key is encrypted, added to ssh-agent, or both.
+func GenerateSSHKey(instanceName string, spec KeySpec, storage KeyStorage) (*SSHKeyPair, error) {
 	// Create ~/.ssh directory if it doesn't exist
 	sshDir := filepath.Join(os.Getenv("HOME"), ".ssh")
 	if err := os.MkdirAll(sshDir, 0700); err != nil {
@@ -28,34 +128,63 @@ func GenerateSSHKey(instanceName string) (*SSHKeyPair, error) {
 	}
 
 	// Generate private key
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey, err := generatePrivateKey(spec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	// Encode private key to PEM
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	keyName := fmt.Sprintf("%s%s", InstanceNamePrefix, instanceName)
+	privateKeyPath := filepath.Join(sshDir, keyName)
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate public key: %w", err)
 	}
 
-	privateKeyPath := filepath.Join(sshDir, fmt.Sprintf("%s%s", InstanceNamePrefix, instanceName))
-	if err := os.WriteFile(privateKeyPath, pem.EncodeToMemory(privateKeyPEM), 0600); err != nil {
-		return nil, fmt.Errorf("failed to write private key: %w", err)
+	var cert *ssh.Certificate
+	if storage.CA != nil {
+		cert, err = storage.CA.SignUserKey(signer.PublicKey(), keyName)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Generate public key
-	publicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate public key: %w", err)
+	if storage.Agent == SSHAgentAdd || storage.Agent == SSHAgentOnly {
+		if err := addKeyToAgent(privateKey, cert, keyName, storage.AgentLifetime); err != nil {
+			return nil, err
+		}
+	}
+
+	if storage.Agent != SSHAgentOnly {
+		// Encode private key in OpenSSH format
+		var privateKeyPEM *pem.Block
+		if len(storage.Passphrase) > 0 {
+			privateKeyPEM, err = ssh.MarshalPrivateKeyWithPassphrase(privateKey, keyName, storage.Passphrase)
+		} else {
+			privateKeyPEM, err = ssh.MarshalPrivateKey(privateKey, keyName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode private key: %w", err)
+		}
+
+		if err := os.WriteFile(privateKeyPath, pem.EncodeToMemory(privateKeyPEM), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write private key: %w", err)
+		}
 	}
 
-	publicKeyString := string(ssh.MarshalAuthorizedKey(publicKey))
+	// Write public key
+	publicKeyString := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
 	publicKeyPath := fmt.Sprintf("%s.pub", privateKeyPath)
 	if err := os.WriteFile(publicKeyPath, []byte(publicKeyString), 0644); err != nil {
 		return nil, fmt.Errorf("failed to write public key: %w", err)
 	}
 
+	if cert != nil {
+		if err := writeCertificate(privateKeyPath, cert); err != nil {
+			return nil, err
+		}
+	}
+
 	return &SSHKeyPair{
 		PrivateKeyPath: privateKeyPath,
 		PublicKeyPath:  publicKeyPath,
@@ -79,6 +208,11 @@ func DeleteSSHKey(instanceName string) error {
 		return fmt.Errorf("failed to delete public key: %w", err)
 	}
 
+	// Delete the certificate issued in SSH CA mode
+	if err := os.Remove(certificatePath(privateKeyPath)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete certificate: %w", err)
+	}
+
 	return nil
 }
 
@@ -87,3 +221,76 @@ func GetSSHKeyPath(instanceName string) string {
 	sshDir := filepath.Join(os.Getenv("HOME"), ".ssh")
 	return filepath.Join(sshDir, fmt.Sprintf("%s%s", InstanceNamePrefix, instanceName))
 }
+
+// SharedKeypairPrefix starts the name of keypairs imported from a user's own public key.
+// The underscore keeps it apart from the per-instance keypairs, which are named InstanceNamePrefix + name.
+const SharedKeypairPrefix = "tins_key-"
+
+// loadPublicKey reads and validates an OpenSSH public key file, returning the key in authorized_keys format
+func loadPublicKey(path string) (ssh.PublicKey, string, error) {
+	path = expandHome(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+
+	return publicKey, string(ssh.MarshalAuthorizedKey(publicKey)), nil
+}
+
+// sharedKeypairName derives a stable keypair name from a public key, so every instance
+// created with the same key reuses one keypair
+func sharedKeypairName(publicKey ssh.PublicKey) string {
+	sum := sha256.Sum256(publicKey.Marshal())
+	return SharedKeypairPrefix + hex.EncodeToString(sum[:])[:16]
+}
+
+// resolveAuthorizedKeys turns authorized_keys / --authorize entries into authorized_keys lines.
+// Each entry is either a public key string or a path to a file holding one or more keys.
+// Duplicate keys are dropped.
+func resolveAuthorizedKeys(entries []string) ([]string, error) {
+	var keys []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		data := []byte(entry)
+		if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err != nil {
+			data, err = os.ReadFile(expandHome(entry))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read authorized key %s: %w", entry, err)
+			}
+		}
+
+		for found := 0; len(bytes.TrimSpace(data)) > 0; found++ {
+			publicKey, comment, _, rest, err := ssh.ParseAuthorizedKey(data)
+			if err != nil && found > 0 {
+				// Only comments or blank lines are left
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse authorized key %s: %w", entry, err)
+			}
+			data = rest
+
+			if seen[string(publicKey.Marshal())] {
+				continue
+			}
+			seen[string(publicKey.Marshal())] = true
+
+			line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey)))
+			if comment != "" {
+				line += " " + comment
+			}
+			keys = append(keys, line)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	// SSHAgentOff keeps instance keys in files only (default)
+	SSHAgentOff = "off"
+	// SSHAgentAdd writes the key file and also adds the key to ssh-agent
+	SSHAgentAdd = "add"
+	// SSHAgentOnly adds the key to ssh-agent without writing the private key file
+	SSHAgentOnly = "only"
+)
+
+// errNoAgent is returned when SSH_AUTH_SOCK is not set
+var errNoAgent = errors.New("no ssh-agent available (SSH_AUTH_SOCK is not set)")
+
+// parseSSHAgentMode validates an ssh_agent / --ssh-agent value
+func parseSSHAgentMode(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", SSHAgentOff:
+		return SSHAgentOff, nil
+	case SSHAgentAdd, SSHAgentOnly:
+		return strings.ToLower(value), nil
+	default:
+		return "", fmt.Errorf("invalid ssh-agent mode '%s' (must be one of: off, add, only)", value)
+	}
+}
+
+// dialAgent connects to the ssh-agent at SSH_AUTH_SOCK. The caller must close the returned connection.
+func dialAgent() (agent.ExtendedAgent, net.Conn, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errNoAgent
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent at %s: %w", socket, err)
+	}
+
+	return agent.NewClient(conn), conn, nil
+}
+
+// addKeyToAgent adds a private key, and its certificate if there is one, to ssh-agent under the given comment.
+// A zero lifetime keeps the key until it is removed.
+func addKeyToAgent(privateKey crypto.PrivateKey, cert *ssh.Certificate, comment string, lifetime time.Duration) error {
+	client, conn, err := dialAgent()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key := agent.AddedKey{
+		PrivateKey:  privateKey,
+		Certificate: cert,
+		Comment:     comment,
+	}
+	if lifetime > 0 {
+		seconds := math.Ceil(lifetime.Seconds())
+		if seconds > math.MaxUint32 {
+			seconds = math.MaxUint32
+		}
+		key.LifetimeSecs = uint32(seconds)
+	}
+
+	if err := client.Add(key); err != nil {
+		return fmt.Errorf("failed to add key to ssh-agent: %w", err)
+	}
+	if cert != nil {
+		// Also add the plain key, which is what connect looks up and what hosts without the CA accept
+		key.Certificate = nil
+		if err := client.Add(key); err != nil {
+			return fmt.Errorf("failed to add key to ssh-agent: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeKeyFromAgent removes every agent key with the given comment and reports whether any were removed.
+// A missing agent is not an error.
+func removeKeyFromAgent(comment string) (bool, error) {
+	client, conn, err := dialAgent()
+	if errors.Is(err, errNoAgent) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	keys, err := client.List()
+	if err != nil {
+		return false, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+
+	removed := false
+	for _, key := range keys {
+		if key.Comment != comment {
+			continue
+		}
+		if err := client.Remove(key); err != nil {
+			return removed, fmt.Errorf("failed to remove key from ssh-agent: %w", err)
+		}
+		removed = true
+	}
+	return removed, nil
+}
+
+// agentSigner returns the ssh-agent signer for the public key stored at publicKeyPath.
+// It returns a nil signer when there is no agent, no public key file or the agent doesn't hold the key.
+// The returned function closes the agent connection and must be called once the signer is no longer needed.
+func agentSigner(publicKeyPath string) (ssh.Signer, func(), error) {
+	noop := func() {}
+
+	publicKeyData, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, noop, nil
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyData)
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to parse public key %s: %w", publicKeyPath, err)
+	}
+
+	client, conn, err := dialAgent()
+	if errors.Is(err, errNoAgent) {
+		return nil, noop, nil
+	}
+	if err != nil {
+		return nil, noop, err
+	}
+
+	signers, err := client.Signers()
+	if err != nil {
+		conn.Close()
+		return nil, noop, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) {
+			return signer, func() { conn.Close() }, nil
+		}
+	}
+
+	conn.Close()
+	return nil, noop, nil
+}
+
+// allAgentSigners returns every key held by ssh-agent.
+// The returned function closes the agent connection and must be called once the signers are no longer needed.
+func allAgentSigners() ([]ssh.Signer, func(), error) {
+	client, conn, err := dialAgent()
+	if err != nil {
+		return nil, func() {}, err
+	}
+
+	signers, err := client.Signers()
+	if err != nil {
+		conn.Close()
+		return nil, func() {}, fmt.Errorf("failed to list ssh-agent keys: %w", err)
+	}
+	if len(signers) == 0 {
+		conn.Close()
+		return nil, func() {}, fmt.Errorf("ssh-agent has no keys")
+	}
+	return signers, func() { conn.Close() }, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startTestAgent serves an in-memory ssh-agent on a unix socket and points SSH_AUTH_SOCK at it
+func startTestAgent(t *testing.T) agent.Agent {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "tins-agent")
+	if err != nil {
+		t.Fatalf("Failed to create socket dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	keyring := agent.NewKeyring()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	t.Setenv("SSH_AUTH_SOCK", socket)
+	return keyring
+}
+
+func TestGenerateSSHKey_AgentOnly(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	keyring := startTestAgent(t)
+
+	keyPair, err := GenerateSSHKey("agent-only", KeySpec{}, KeyStorage{Agent: SSHAgentOnly, AgentLifetime: time.Hour})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	if _, err := os.Stat(keyPair.PrivateKeyPath); !os.IsNotExist(err) {
+		t.Error("Expected no private key file in agent-only mode")
+	}
+
+	keys, err := keyring.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Comment != "tins-agent-only" {
+		t.Fatalf("Expected one agent key named tins-agent-only, got %v", keys)
+	}
+
+	// The SSH client picks the key up from the agent
+	signers, release, err := targetSigners(SSHTarget{KeyPath: keyPair.PrivateKeyPath})
+	if err != nil {
+		t.Fatalf("targetSigners failed: %v", err)
+	}
+	release()
+	if len(signers) != 1 || string(ssh.MarshalAuthorizedKey(signers[0].PublicKey())) != keyPair.PublicKey {
+		t.Error("Expected the agent signer to match the generated public key")
+	}
+
+	removed, err := removeKeyFromAgent("tins-agent-only")
+	if err != nil || !removed {
+		t.Fatalf("removeKeyFromAgent = %v, %v; want true, nil", removed, err)
+	}
+	if keys, _ := keyring.List(); len(keys) != 0 {
+		t.Errorf("Expected agent to be empty, got %d key(s)", len(keys))
+	}
+}
+
+func TestRemoveKeyFromAgent_NoAgent(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	removed, err := removeKeyFromAgent("tins-anything")
+	if err != nil || removed {
+		t.Errorf("removeKeyFromAgent without agent = %v, %v; want false, nil", removed, err)
+	}
+	if _, _, err := dialAgent(); !errors.Is(err, errNoAgent) {
+		t.Errorf("Expected errNoAgent, got %v", err)
+	}
+}
+
+func TestGenerateSSHKey_Encrypted(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	keyPair, err := GenerateSSHKey("encrypted", KeySpec{}, KeyStorage{Passphrase: []byte("correct horse")})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	var passphraseErr *ssh.PassphraseMissingError
+	if _, err := loadSigner(keyPair.PrivateKeyPath); !errors.As(err, &passphraseErr) {
+		t.Fatalf("Expected PassphraseMissingError, got %v", err)
+	}
+
+	target := SSHTarget{
+		KeyPath:    keyPair.PrivateKeyPath,
+		Passphrase: func() ([]byte, error) { return []byte("correct horse"), nil },
+	}
+	if _, _, err := targetSigners(target); err != nil {
+		t.Errorf("targetSigners with passphrase failed: %v", err)
+	}
+
+	target.Passphrase = func() ([]byte, error) { return []byte("wrong"), nil }
+	if _, _, err := targetSigners(target); err == nil {
+		t.Error("Expected targetSigners to fail with the wrong passphrase")
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// DefaultCertValidity is how long user certificates stay valid unless ssh_cert_validity is set
+	DefaultCertValidity = "1h"
+	// DefaultHostCertValidity is how long host certificates stay valid unless ssh_host_cert_validity is set
+	DefaultHostCertValidity = "30d"
+	// certClockSkew backdates certificates so small clock differences don't reject them
+	certClockSkew = 5 * time.Minute
+	// certRenewBefore is how close to expiry a user certificate is renewed before connecting
+	certRenewBefore = 5 * time.Minute
+	// userCAKeyPath is where instances store the CA public key trusted for user certificates
+	userCAKeyPath = "/etc/ssh/tins_user_ca.pub"
+)
+
+// DefaultCertPrincipals are the users a certificate may log in as unless ssh_cert_principals is set
+var DefaultCertPrincipals = []string{"root", "ubuntu"}
+
+// CertificateAuthority signs user and host keys with the CA key from ssh_ca_key
+type CertificateAuthority struct {
+	Signer       ssh.Signer
+	Principals   []string      // Users that signed user certificates may log in as
+	Validity     time.Duration // Lifetime of user certificates
+	HostValidity time.Duration // Lifetime of host certificates
+}
+
+// loadCertificateAuthority loads the CA configured with ssh_ca_key. A copy of the CA key held by
+// ssh-agent is preferred; otherwise the key file is read and decrypted if needed.
+// It returns a nil CA when CA mode is not configured. The returned function releases the agent connection.
+func loadCertificateAuthority(config *OpenStackConfig) (*CertificateAuthority, func(), error) {
+	noop := func() {}
+	if config.SSHCAKey == "" {
+		return nil, noop, nil
+	}
+
+	validity, err := parseTTL(config.SSHCertValidity)
+	if err != nil {
+		return nil, noop, fmt.Errorf("invalid ssh_cert_validity: %w", err)
+	}
+	hostValidity, err := parseTTL(config.SSHHostCertValidity)
+	if err != nil {
+		return nil, noop, fmt.Errorf("invalid ssh_host_cert_validity: %w", err)
+	}
+
+	keyPath := expandHome(config.SSHCAKey)
+	signers, release, err := targetSigners(SSHTarget{
+		KeyPath: keyPath,
+		Passphrase: func() ([]byte, error) {
+			return keyPassphrase(config.KeyPassphraseCommand, false)
+		},
+	})
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to load SSH CA key: %w", err)
+	}
+
+	return &CertificateAuthority{
+		Signer:       signers[0],
+		Principals:   config.SSHCertPrincipals,
+		Validity:     validity,
+		HostValidity: hostValidity,
+	}, release, nil
+}
+
+// caPublicKey returns the public half of ssh_ca_key, read from the .pub file next to it when possible
+func caPublicKey(config *OpenStackConfig) (ssh.PublicKey, error) {
+	if publicKey, _, err := loadPublicKey(config.SSHCAKey + ".pub"); err == nil {
+		return publicKey, nil
+	}
+
+	ca, release, err := loadCertificateAuthority(config)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return ca.Signer.PublicKey(), nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of the CA public key
+func (ca *CertificateAuthority) Fingerprint() string {
+	return ssh.FingerprintSHA256(ca.Signer.PublicKey())
+}
+
+// SignUserKey issues a short-lived user certificate for publicKey
+func (ca *CertificateAuthority) SignUserKey(publicKey ssh.PublicKey, keyID string) (*ssh.Certificate, error) {
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		CertType:        ssh.UserCert,
+		KeyId:           keyID,
+		ValidPrincipals: ca.Principals,
+		ValidAfter:      uint64(now.Add(-certClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(ca.Validity).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-X11-forwarding":   "",
+				"permit-agent-forwarding": "",
+				"permit-port-forwarding":  "",
+				"permit-pty":              "",
+				"permit-user-rc":          "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca.Signer); err != nil {
+		return nil, fmt.Errorf("failed to sign user certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// SignHostKey issues a host certificate for publicKey that is valid for the given host names.
+// The host private key travels in user-data, so the certificate expires after HostValidity rather than never.
+func (ca *CertificateAuthority) SignHostKey(publicKey ssh.PublicKey, principals []string) (*ssh.Certificate, error) {
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             publicKey,
+		CertType:        ssh.HostCert,
+		KeyId:           principals[0],
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-certClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(ca.HostValidity).Unix()),
+	}
+	if err := cert.SignCert(rand.Reader, ca.Signer); err != nil {
+		return nil, fmt.Errorf("failed to sign host certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// certificatePath returns where the certificate for a private key is stored, following the OpenSSH convention
+func certificatePath(keyPath string) string {
+	return keyPath + "-cert.pub"
+}
+
+// writeCertificate stores a certificate next to its private key so both tins and ssh pick it up
+func writeCertificate(keyPath string, cert *ssh.Certificate) error {
+	if err := os.WriteFile(certificatePath(keyPath), ssh.MarshalAuthorizedKey(cert), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	return nil
+}
+
+// loadCertificate reads the certificate stored next to a private key
+func loadCertificate(keyPath string) (*ssh.Certificate, error) {
+	data, err := os.ReadFile(certificatePath(keyPath))
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", certificatePath(keyPath), err)
+	}
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", certificatePath(keyPath))
+	}
+	return cert, nil
+}
+
+// certificateSigners adds a certificate signer for every signer whose key the certificate stored
+// next to keyPath belongs to. The certificate signers come first so they are offered before the plain keys.
+func certificateSigners(keyPath string, signers []ssh.Signer) []ssh.Signer {
+	cert, err := loadCertificate(keyPath)
+	if err != nil {
+		return signers
+	}
+
+	var result []ssh.Signer
+	for _, signer := range signers {
+		if string(signer.PublicKey().Marshal()) != string(cert.Key.Marshal()) {
+			continue
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err == nil {
+			result = append(result, certSigner)
+		}
+	}
+	return append(result, signers...)
+}
+
+// renewUserCertificate signs the public key stored next to keyPath again if its certificate is
+// missing or about to expire
+func renewUserCertificate(config *OpenStackConfig, keyPath, keyID string) error {
+	if cert, err := loadCertificate(keyPath); err == nil {
+		if time.Now().Add(certRenewBefore).Before(time.Unix(int64(cert.ValidBefore), 0)) {
+			return nil
+		}
+	}
+
+	publicKey, _, err := loadPublicKey(keyPath + ".pub")
+	if err != nil {
+		return err
+	}
+
+	ca, release, err := loadCertificateAuthority(config)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if ca == nil {
+		return fmt.Errorf("the user certificate for %s has expired and no ssh_ca_key is configured to renew it", keyID)
+	}
+
+	cert, err := ca.SignUserKey(publicKey, keyID)
+	if err != nil {
+		return err
+	}
+	return writeCertificate(keyPath, cert)
+}
+
+// userCACloudConfig makes an instance trust user certificates signed by the CA. The sshd setting is
+// added from bootcmd so it is in place before sshd starts.
+func userCACloudConfig(caKey ssh.PublicKey) map[string]interface{} {
+	trustCA := fmt.Sprintf("grep -q '^TrustedUserCAKeys %[1]s' /etc/ssh/sshd_config || sed -i '1i TrustedUserCAKeys %[1]s' /etc/ssh/sshd_config", userCAKeyPath)
+	return map[string]interface{}{
+		"write_files": []map[string]interface{}{
+			{
+				"path":        userCAKeyPath,
+				"content":     string(ssh.MarshalAuthorizedKey(caKey)),
+				"permissions": "0644",
+			},
+		},
+		"bootcmd": [][]string{{"sh", "-c", trustCA}},
+	}
+}
+
+// hostCertificateCloudConfig generates an Ed25519 host key signed by the CA for the given host names
+// and returns the cloud-init ssh_keys that install it
+func hostCertificateCloudConfig(ca *CertificateAuthority, principals []string) (map[string]interface{}, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	privateKeyPEM, err := ssh.MarshalPrivateKey(privateKey, principals[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+
+	cert, err := ca.SignHostKey(sshPublicKey, principals)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"ssh_keys": map[string]string{
+			"ed25519_private":     string(pem.EncodeToMemory(privateKeyPEM)),
+			"ed25519_public":      strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))),
+			"ed25519_certificate": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))),
+		},
+	}, nil
+}
+
+// hostCertificateCallback accepts only host certificates signed by caKey for the given host name
+func hostCertificateCallback(caKey ssh.PublicKey, principal string) ssh.HostKeyCallback {
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			return string(auth.Marshal()) == string(caKey.Marshal())
+		},
+	}
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		cert, ok := key.(*ssh.Certificate)
+		if !ok {
+			return errors.New("host presented a plain key instead of a certificate signed by the SSH CA")
+		}
+		if cert.CertType != ssh.HostCert {
+			return errors.New("host presented a user certificate")
+		}
+		if !checker.IsHostAuthority(cert.SignatureKey, "") {
+			return fmt.Errorf("host certificate is signed by %s, not the configured SSH CA", ssh.FingerprintSHA256(cert.SignatureKey))
+		}
+		return checker.CheckCert(principal, cert)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// useTestCA generates a CA key in the test home directory and returns a config that uses it
+func useTestCA(t *testing.T) *OpenStackConfig {
+	t.Helper()
+	caKey, err := GenerateSSHKey("test-ca", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	return &OpenStackConfig{
+		SSHCAKey:            caKey.PrivateKeyPath,
+		SSHCertPrincipals:   DefaultCertPrincipals,
+		SSHCertValidity:     DefaultCertValidity,
+		SSHHostCertValidity: DefaultHostCertValidity,
+	}
+}
+
+func TestGenerateSSHKey_Certificate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	config := useTestCA(t)
+
+	ca, release, err := loadCertificateAuthority(config)
+	if err != nil {
+		t.Fatalf("loadCertificateAuthority failed: %v", err)
+	}
+	defer release()
+
+	keyPair, err := GenerateSSHKey("signed", KeySpec{}, KeyStorage{CA: ca})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	cert, err := loadCertificate(keyPair.PrivateKeyPath)
+	if err != nil {
+		t.Fatalf("Expected a certificate next to the key: %v", err)
+	}
+	if cert.CertType != ssh.UserCert || cert.KeyId != "tins-signed" {
+		t.Errorf("Unexpected certificate type %d / key ID %q", cert.CertType, cert.KeyId)
+	}
+	if strings.Join(cert.ValidPrincipals, ",") != "root,ubuntu" {
+		t.Errorf("Expected default principals, got %v", cert.ValidPrincipals)
+	}
+	validFor := time.Until(time.Unix(int64(cert.ValidBefore), 0))
+	if validFor > time.Hour || validFor < 55*time.Minute {
+		t.Errorf("Expected a certificate valid for about an hour, got %s", validFor)
+	}
+
+	// The certificate is offered ahead of the plain key
+	signers, release, err := targetSigners(SSHTarget{KeyPath: keyPair.PrivateKeyPath})
+	if err != nil {
+		t.Fatalf("targetSigners failed: %v", err)
+	}
+	defer release()
+	if len(signers) != 2 {
+		t.Fatalf("Expected certificate and key signers, got %d", len(signers))
+	}
+	if _, ok := signers[0].PublicKey().(*ssh.Certificate); !ok {
+		t.Error("Expected the first signer to use the certificate")
+	}
+
+	if err := DeleteSSHKey("signed"); err != nil {
+		t.Fatalf("DeleteSSHKey failed: %v", err)
+	}
+	if _, err := os.Stat(certificatePath(keyPair.PrivateKeyPath)); !os.IsNotExist(err) {
+		t.Error("Expected the certificate to be deleted with the key")
+	}
+}
+
+func TestRenewUserCertificate(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	config := useTestCA(t)
+
+	keyPair, err := GenerateSSHKey("renew", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	// A missing certificate is issued
+	if err := renewUserCertificate(config, keyPair.PrivateKeyPath, "tins-renew"); err != nil {
+		t.Fatalf("renewUserCertificate failed: %v", err)
+	}
+	cert, err := loadCertificate(keyPair.PrivateKeyPath)
+	if err != nil {
+		t.Fatalf("Expected a certificate: %v", err)
+	}
+
+	// A valid certificate is kept as is
+	if err := renewUserCertificate(config, keyPair.PrivateKeyPath, "tins-renew"); err != nil {
+		t.Fatalf("renewUserCertificate failed: %v", err)
+	}
+	kept, _ := loadCertificate(keyPair.PrivateKeyPath)
+	if kept.Nonce == nil || string(kept.Nonce) != string(cert.Nonce) {
+		t.Error("Expected a valid certificate not to be renewed")
+	}
+
+	// Without a CA an expired certificate cannot be renewed
+	expired := *cert
+	expired.ValidBefore = uint64(time.Now().Add(-time.Minute).Unix())
+	if err := writeCertificate(keyPair.PrivateKeyPath, &expired); err != nil {
+		t.Fatalf("writeCertificate failed: %v", err)
+	}
+	if err := renewUserCertificate(&OpenStackConfig{}, keyPair.PrivateKeyPath, "tins-renew"); err == nil {
+		t.Error("Expected an error renewing without ssh_ca_key")
+	}
+}
+
+func TestHostCertificateCallback(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+	config := useTestCA(t)
+
+	ca, release, err := loadCertificateAuthority(config)
+	if err != nil {
+		t.Fatalf("loadCertificateAuthority failed: %v", err)
+	}
+	defer release()
+
+	hostConfig, err := hostCertificateCloudConfig(ca, []string{"tins-host"})
+	if err != nil {
+		t.Fatalf("hostCertificateCloudConfig failed: %v", err)
+	}
+	sshKeys := hostConfig["ssh_keys"].(map[string]string)
+	certKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshKeys["ed25519_certificate"]))
+	if err != nil {
+		t.Fatalf("invalid host certificate: %v", err)
+	}
+	expiry := time.Unix(int64(certKey.(*ssh.Certificate).ValidBefore), 0)
+	if expiry.After(time.Now().Add(ca.HostValidity)) || expiry.Before(time.Now().Add(ca.HostValidity-time.Minute)) {
+		t.Errorf("Expected the host certificate to expire after %s, got %s", ca.HostValidity, expiry)
+	}
+	plainKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(sshKeys["ed25519_public"]))
+	if err != nil {
+		t.Fatalf("invalid host public key: %v", err)
+	}
+
+	callback := hostCertificateCallback(ca.Signer.PublicKey(), "tins-host")
+	if err := callback("10.0.0.5:22", nil, certKey); err != nil {
+		t.Errorf("Expected the host certificate to be accepted: %v", err)
+	}
+	if err := callback("10.0.0.5:22", nil, plainKey); err == nil {
+		t.Error("Expected a plain host key to be rejected")
+	}
+	if err := hostCertificateCallback(ca.Signer.PublicKey(), "tins-other")("10.0.0.5:22", nil, certKey); err == nil {
+		t.Error("Expected a certificate for another host to be rejected")
+	}
+
+	_, otherCAKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherCA, _ := ssh.NewSignerFromKey(otherCAKey)
+	if err := hostCertificateCallback(otherCA.PublicKey(), "tins-host")("10.0.0.5:22", nil, certKey); err == nil {
+		t.Error("Expected a certificate from another CA to be rejected")
+	}
+}
+
+func TestCreateTerminate_SSHCA(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	caKey, err := GenerateSSHKey("team-ca", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+	content := "ssh_ca_key: " + caKey.PrivateKeyPath + "\nssh_cert_validity: 30m\nssh_host_certificates: true\n"
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	output, err := runCommand(t, "create", "certified")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+
+	if len(provider.keypairs) != 0 {
+		t.Errorf("Expected no keypair in SSH CA mode, got %v", provider.keypairs)
+	}
+	var spec InstanceSpec
+	for _, created := range provider.specs {
+		spec = created
+	}
+	if spec.Metadata[SSHCATag] == "" || spec.Metadata[HostCertTag] != spec.Metadata[SSHCATag] {
+		t.Errorf("Expected CA fingerprints in metadata, got %v", spec.Metadata)
+	}
+	userData := string(spec.UserData)
+	for _, want := range []string{"TrustedUserCAKeys", strings.Fields(caKey.PublicKey)[1], "ed25519_certificate"} {
+		if !strings.Contains(userData, want) {
+			t.Errorf("Expected user-data to contain %q, got:\n%s", want, userData)
+		}
+	}
+	if _, err := loadCertificate(GetSSHKeyPath("certified")); err != nil {
+		t.Errorf("Expected a user certificate for the instance key: %v", err)
+	}
+
+	output, err = runCommand(t, "terminate", "certified")
+	if err != nil {
+		t.Fatalf("terminate command failed: %v\n%s", err, output)
+	}
+	if strings.Contains(output, "Failed to delete OpenStack keypair") {
+		t.Errorf("Expected no keypair deletion attempt, got:\n%s", output)
+	}
+	if _, err := os.Stat(certificatePath(GetSSHKeyPath("certified"))); !os.IsNotExist(err) {
+		t.Error("Expected the certificate to be removed on terminate")
+	}
+}
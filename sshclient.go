@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+const (
+	// DefaultSSHPort is the port used for SSH connections to instances
+	DefaultSSHPort = 22
+	// sshDialTimeout bounds the TCP connect and SSH handshake
+	sshDialTimeout = 30 * time.Second
+	// sshKeepAliveInterval is how often a keepalive request is sent on an open connection
+	sshKeepAliveInterval = 30 * time.Second
+	// sshKeepAliveMaxMissed is the number of failed keepalives before the connection is closed
+	sshKeepAliveMaxMissed = 3
+)
+
+// SSHTarget describes how to reach an instance over SSH
+type SSHTarget struct {
+	User    string // Remote user to log in as
+	Host    string // Instance IP address or hostname
+	Port    int    // SSH port (default: 22)
+	KeyPath string // Path to the private key; empty to use any key held by ssh-agent
+
+	// Passphrase returns the passphrase for an encrypted private key. It is only called when needed.
+	Passphrase func() ([]byte, error)
+
+	// HostKeyCallback verifies the instance's host key; nil trusts the key on first use, see trustOnFirstUseCallback
+	HostKeyCallback ssh.HostKeyCallback
+	// HostKeyAlgorithms restricts the negotiated host key types to those HostKeyCallback knows (optional)
+	HostKeyAlgorithms []string
+
+	// Bastion is the jump host the connection is tunnelled through (optional)
+	Bastion *SSHTarget
+}
+
+// address returns the host:port string for the target
+func (t SSHTarget) address() string {
+	port := t.Port
+	if port == 0 {
+		port = DefaultSSHPort
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(port))
+}
+
+// loadSigner reads and parses a private key file
+func loadSigner(keyPath string) (ssh.Signer, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %s: %w", keyPath, err)
+	}
+
+	return signer, nil
+}
+
+// targetSigners returns the signers for the target's key. A copy held by ssh-agent is preferred,
+// otherwise the private key file is loaded and decrypted if needed. Without a key path, all agent keys are offered.
+// The returned function releases the agent connection once the handshake is done.
+func targetSigners(target SSHTarget) ([]ssh.Signer, func(), error) {
+	if target.KeyPath == "" {
+		return allAgentSigners()
+	}
+
+	signer, release, err := agentSigner(target.KeyPath + ".pub")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: Failed to use ssh-agent: %v\n", err)
+	}
+	if signer != nil {
+		return certificateSigners(target.KeyPath, []ssh.Signer{signer}), release, nil
+	}
+
+	signer, err = loadSigner(target.KeyPath)
+	var passphraseErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseErr) && target.Passphrase != nil {
+		passphrase, passErr := target.Passphrase()
+		if passErr != nil {
+			return nil, release, passErr
+		}
+		signer, err = loadSignerWithPassphrase(target.KeyPath, passphrase)
+	}
+	if err != nil {
+		return nil, release, err
+	}
+	return certificateSigners(target.KeyPath, []ssh.Signer{signer}), release, nil
+}
+
+// loadSignerWithPassphrase reads and decrypts a passphrase-protected private key file
+func loadSignerWithPassphrase(keyPath string, passphrase []byte) (ssh.Signer, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKeyWithPassphrase(keyData, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key %s: %w", keyPath, err)
+	}
+
+	return signer, nil
+}
+
+// dialSSH opens an SSH connection to the target using its key. With a bastion, the connection is
+// tunnelled through an SSH connection to the bastion, which is closed together with the returned client.
+func dialSSH(target SSHTarget) (*ssh.Client, error) {
+	signers, release, err := targetSigners(target)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Host keys of freshly booted instances are not known in advance unless they were recorded or are CA-signed
+	hostKeyCallback := target.HostKeyCallback
+	if hostKeyCallback == nil {
+		hostKeyCallback = trustOnFirstUseCallback(target.Host)
+	}
+
+	clientConfig := &ssh.ClientConfig{
+		User:              target.User,
+		Auth:              []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: target.HostKeyAlgorithms,
+		Timeout:           sshDialTimeout,
+	}
+
+	if target.Bastion == nil {
+		client, err := ssh.Dial("tcp", target.address(), clientConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", target.address(), err)
+		}
+		return client, nil
+	}
+
+	bastion, err := dialSSH(*target.Bastion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to bastion: %w", err)
+	}
+
+	conn, err := bastion.Dial("tcp", target.address())
+	if err != nil {
+		bastion.Close()
+		return nil, fmt.Errorf("failed to connect to %s through bastion %s: %w", target.address(), target.Bastion.address(), err)
+	}
+
+	// ClientConfig.Timeout only covers ssh.Dial, and tunnelled connections don't support deadlines
+	timer := time.AfterFunc(sshDialTimeout, func() { conn.Close() })
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, target.address(), clientConfig)
+	timer.Stop()
+	if err != nil {
+		conn.Close()
+		bastion.Close()
+		return nil, fmt.Errorf("failed to connect to %s through bastion %s: %w", target.address(), target.Bastion.address(), err)
+	}
+
+	client := ssh.NewClient(clientConn, channels, requests)
+	go func() {
+		client.Wait()
+		bastion.Close()
+	}()
+	return client, nil
+}
+
+// startKeepAlive periodically pings the server and closes the connection if it stops answering.
+// The returned function stops the keepalive loop.
+func startKeepAlive(client *ssh.Client) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(sshKeepAliveInterval)
+		defer ticker.Stop()
+
+		missed := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+					missed++
+					if missed >= sshKeepAliveMaxMissed {
+						client.Close()
+						return
+					}
+					continue
+				}
+				missed = 0
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// sessionExitCode converts the result of session.Wait/Run into a remote exit code.
+// A non-nil error is only returned when the session failed for a reason other than
+// the remote command exiting with a non-zero status.
+func sessionExitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+
+	var missingErr *ssh.ExitMissingError
+	if errors.As(err, &missingErr) {
+		return 255, fmt.Errorf("remote side closed the session without an exit status")
+	}
+
+	return 255, err
+}
+
+// runInteractiveShell opens a PTY-backed login shell on the target, attached to the local terminal.
+// Returns the exit code of the remote shell.
+func runInteractiveShell(target SSHTarget) (int, error) {
+	client, err := dialSSH(target)
+	if err != nil {
+		return 255, err
+	}
+	defer client.Close()
+
+	stopKeepAlive := startKeepAlive(client)
+	defer stopKeepAlive()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 255, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return 255, fmt.Errorf("failed to request pty: %w", err)
+		}
+
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return 255, fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer term.Restore(fd, oldState)
+
+		stopResize := watchWindowSize(fd, session)
+		defer stopResize()
+	}
+
+	if err := session.Shell(); err != nil {
+		return 255, fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	return sessionExitCode(session.Wait())
+}
+
+// runRemoteCommand runs a single command on the target without a PTY, streaming its I/O.
+// Returns the exit code of the remote command.
+func runRemoteCommand(target SSHTarget, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	client, err := dialSSH(target)
+	if err != nil {
+		return 255, err
+	}
+	defer client.Close()
+
+	stopKeepAlive := startKeepAlive(client)
+	defer stopKeepAlive()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return 255, fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	return sessionExitCode(session.Run(command))
+}
+
+// resizeSession propagates the current local terminal size to the remote PTY
+func resizeSession(fd int, session *ssh.Session) {
+	width, height, err := term.GetSize(fd)
+	if err != nil {
+		return
+	}
+	_ = session.WindowChange(height, width)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSSHTargetAddress(t *testing.T) {
+	target := SSHTarget{Host: "10.0.0.5"}
+	if target.address() != "10.0.0.5:22" {
+		t.Errorf("Expected default port 22, got '%s'", target.address())
+	}
+
+	target = SSHTarget{Host: "fd00::5", Port: 2222}
+	if target.address() != "[fd00::5]:2222" {
+		t.Errorf("Expected '[fd00::5]:2222', got '%s'", target.address())
+	}
+}
+
+func TestSessionExitCode(t *testing.T) {
+	code, err := sessionExitCode(nil)
+	if err != nil || code != 0 {
+		t.Errorf("Expected exit code 0 and no error, got %d, %v", code, err)
+	}
+
+	code, err = sessionExitCode(errors.New("connection reset"))
+	if err == nil {
+		t.Error("sessionExitCode should return an error for non-exit failures")
+	}
+	if code != 255 {
+		t.Errorf("Expected exit code 255 for connection failures, got %d", code)
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	tmpDir := t.TempDir()
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+
+	os.Setenv("HOME", tmpDir)
+
+	keyPair, err := GenerateSSHKey("test-instance", KeySpec{}, KeyStorage{})
+	if err != nil {
+		t.Fatalf("GenerateSSHKey failed: %v", err)
+	}
+
+	signer, err := loadSigner(keyPair.PrivateKeyPath)
+	if err != nil {
+		t.Fatalf("loadSigner failed: %v", err)
+	}
+	if signer.PublicKey().Type() != "ssh-ed25519" {
+		t.Errorf("Expected ssh-ed25519 signer, got '%s'", signer.PublicKey().Type())
+	}
+
+	if _, err := loadSigner(keyPair.PublicKeyPath); err == nil {
+		t.Error("loadSigner should fail for a public key file")
+	}
+}
@@ -0,0 +1,40 @@
+//go:build windows
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// windowSizePollInterval is how often the console size is checked, since Windows has no SIGWINCH
+const windowSizePollInterval = 500 * time.Millisecond
+
+// watchWindowSize polls the console size and forwards changes to the remote PTY.
+// The returned function stops watching.
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(windowSizePollInterval)
+		defer ticker.Stop()
+
+		lastWidth, lastHeight, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				width, height, err := term.GetSize(fd)
+				if err != nil || (width == lastWidth && height == lastHeight) {
+					continue
+				}
+				lastWidth, lastHeight = width, height
+				resizeSession(fd, session)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
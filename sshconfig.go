@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// sshConfigHeader starts the tins-managed SSH config include file
+	sshConfigHeader = "# Managed by tins: Host blocks are added by 'tins create', removed by 'tins terminate'\n" +
+		"# and regenerated by 'tins ssh-config --sync'. Manual changes are overwritten.\n"
+	// DefaultSSHConfigUser is the login user of the image unless login_user is set, as for Ubuntu cloud images
+	DefaultSSHConfigUser = "ubuntu"
+	// sshConfigProfileMarker starts the comment that records which config profile a Host block belongs to
+	sshConfigProfileMarker = "# tins profile: "
+)
+
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Print or sync the SSH config for temporary instances",
+	Long:  "Print an ssh_config Host block for every tins instance so plain ssh, scp and editors with Remote-SSH can reach them by name. With --sync, regenerate the tins-managed include file ~/.ssh/config.d/tins instead.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sync, _ := cmd.Flags().GetBool("sync")
+
+		// Load configuration
+		config, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		// Create provider client
+		ctx := context.Background()
+		client, err := newProvider(ctx, config)
+		if err != nil {
+			return err
+		}
+
+		instances, err := client.ListInstances(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list instances: %w", err)
+		}
+
+		if !sync {
+			if config.Bastion.Enabled() {
+				fmt.Print(bastionSSHConfigBlock(config.Bastion, sshConfigProfile(config)))
+			}
+			for i := range instances {
+				entry := sshHostEntryForInstance(&instances[i], config)
+				if entry.HostName != "" {
+					fmt.Print(entry.String())
+				}
+			}
+			return nil
+		}
+
+		count, err := syncSSHConfig(instances, config)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d host(s) to %s\n", count, sshConfigPath())
+		if !sshConfigIncluded() {
+			fmt.Printf("Add 'Include config.d/tins' to the top of ~/.ssh/config to use these hosts.\n")
+		}
+		return nil
+	},
+}
+
+// sshHostEntry is a Host block in the tins SSH config include file
+type sshHostEntry struct {
+	Name         string // Host alias, the full instance name
+	HostName     string // Instance IP address
+	User         string
+	IdentityFile string // Private key, or the public key of a key held only by ssh-agent (optional)
+	ProxyJump    string // Jump host to reach the instance through (optional)
+	Profile      string // Config profile the instance was listed with (optional)
+}
+
+// sshConfigProfile returns the profile whose Host blocks a configuration writes
+func sshConfigProfile(config *OpenStackConfig) string {
+	if config.ProfileName == "" {
+		return DefaultProfileName
+	}
+	return config.ProfileName
+}
+
+// sshConfigBlockProfile returns the profile recorded in a Host block.
+// Blocks written before profiles were recorded belong to the default profile.
+func sshConfigBlockProfile(block string) string {
+	for _, line := range strings.Split(block, "\n") {
+		if profile, ok := strings.CutPrefix(strings.TrimSpace(line), sshConfigProfileMarker); ok {
+			return profile
+		}
+	}
+	return DefaultProfileName
+}
+
+// sshConfigPath returns the path of the tins-managed SSH config include file
+func sshConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh", "config.d", "tins")
+}
+
+// sshConfigIncluded reports whether ~/.ssh/config includes the tins include file
+func sshConfigIncluded() bool {
+	data, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".ssh", "config"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "Include") {
+			continue
+		}
+		for _, pattern := range fields[1:] {
+			if strings.HasPrefix(pattern, "~/") {
+				pattern = filepath.Join(os.Getenv("HOME"), pattern[2:])
+			} else if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(os.Getenv("HOME"), ".ssh", pattern)
+			}
+			if matched, _ := filepath.Match(pattern, sshConfigPath()); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sshHostEntryForInstance builds the Host block for an instance from its address and SSH key
+func sshHostEntryForInstance(instance *Instance, config *OpenStackConfig) sshHostEntry {
+	entry := sshHostEntry{
+		Name:     instance.Name,
+		HostName: instance.IP(),
+		User:     config.LoginUser,
+		Profile:  sshConfigProfile(config),
+	}
+	if config.Bastion.Enabled() {
+		entry.ProxyJump = profileBastionHostAlias(entry.Profile)
+	}
+
+	if _, ok := instance.Metadata[KeypairTag]; ok {
+		if config.SSHPublicKey != "" {
+			entry.IdentityFile = strings.TrimSuffix(expandHome(config.SSHPublicKey), ".pub")
+		}
+	} else {
+		// ssh accepts the public key of a key that only ssh-agent holds
+		keyPath := GetSSHKeyPath(shortInstanceName(instance.Name))
+		if _, err := os.Stat(keyPath); err == nil {
+			entry.IdentityFile = keyPath
+		} else if _, err := os.Stat(keyPath + ".pub"); err == nil {
+			entry.IdentityFile = keyPath + ".pub"
+		}
+	}
+	return entry
+}
+
+// String renders the entry as an ssh_config Host block
+func (e sshHostEntry) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Host %s\n", e.Name)
+	if e.Profile != "" {
+		fmt.Fprintf(&b, "    %s%s\n", sshConfigProfileMarker, e.Profile)
+	}
+	fmt.Fprintf(&b, "    HostName %s\n", e.HostName)
+	fmt.Fprintf(&b, "    User %s\n", e.User)
+	if e.IdentityFile != "" {
+		fmt.Fprintf(&b, "    IdentityFile %s\n", quoteSSHConfigValue(e.IdentityFile))
+		fmt.Fprintf(&b, "    IdentitiesOnly yes\n")
+	}
+	// Host keys are recorded under the instance name, which also survives a change of IP
+	fmt.Fprintf(&b, "    UserKnownHostsFile %s\n", quoteSSHConfigValue(knownHostsPath()))
+	fmt.Fprintf(&b, "    HostKeyAlias %s\n", e.Name)
+	if e.ProxyJump != "" {
+		fmt.Fprintf(&b, "    ProxyJump %s\n", e.ProxyJump)
+	}
+	return b.String()
+}
+
+// quoteSSHConfigValue quotes paths containing spaces
+func quoteSSHConfigValue(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+// readSSHConfigBlocks splits the include file into its Host blocks, keyed by host alias, in file order
+func readSSHConfigBlocks() ([]string, map[string]string, error) {
+	data, err := os.ReadFile(sshConfigPath())
+	if os.IsNotExist(err) {
+		return nil, map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read SSH config: %w", err)
+	}
+
+	var names []string
+	blocks := map[string]string{}
+	current := ""
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "Host") {
+			current = fields[1]
+			names = append(names, current)
+		}
+		if current != "" && strings.TrimSpace(line) != "" {
+			blocks[current] += line
+		}
+	}
+	return names, blocks, nil
+}
+
+// writeSSHConfigBlocks replaces the include file with the given Host blocks
+func writeSSHConfigBlocks(names []string, blocks map[string]string) error {
+	path := sshConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create SSH config directory: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(sshConfigHeader)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(blocks[name])
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write SSH config: %w", err)
+	}
+	return nil
+}
+
+// setSSHConfigBlock adds or replaces the Host block with the given alias
+func setSSHConfigBlock(name, block string) error {
+	names, blocks, err := readSSHConfigBlocks()
+	if err != nil {
+		return err
+	}
+	if _, ok := blocks[name]; !ok {
+		names = append(names, name)
+	}
+	blocks[name] = block
+	return writeSSHConfigBlocks(names, blocks)
+}
+
+// addSSHConfigEntry adds or replaces the Host block for an instance
+func addSSHConfigEntry(entry sshHostEntry) error {
+	return setSSHConfigBlock(entry.Name, entry.String())
+}
+
+// addSSHConfigEntryForInstance writes the Host block for an instance, together with the bastion it jumps through
+func addSSHConfigEntryForInstance(instance *Instance, config *OpenStackConfig) error {
+	if config.Bastion.Enabled() {
+		profile := sshConfigProfile(config)
+		if err := setSSHConfigBlock(profileBastionHostAlias(profile), bastionSSHConfigBlock(config.Bastion, profile)); err != nil {
+			return err
+		}
+	}
+	return addSSHConfigEntry(sshHostEntryForInstance(instance, config))
+}
+
+// removeSSHConfigEntries removes the Host blocks of all instances for which remove returns true
+// and returns how many were removed. Bastion blocks are always kept.
+func removeSSHConfigEntries(remove func(name string) bool) (int, error) {
+	names, blocks, err := readSSHConfigBlocks()
+	if err != nil || len(names) == 0 {
+		return 0, err
+	}
+
+	var kept []string
+	for _, name := range names {
+		if isBastionHostAlias(name) || !remove(name) {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == len(names) {
+		return 0, nil
+	}
+	return len(names) - len(kept), writeSSHConfigBlocks(kept, blocks)
+}
+
+// removeSSHConfigEntry removes the Host block of an instance and reports whether it was present
+func removeSSHConfigEntry(instanceName string) (bool, error) {
+	removed, err := removeSSHConfigEntries(func(name string) bool { return name == instanceName })
+	return removed > 0, err
+}
+
+// syncSSHConfig regenerates the Host blocks of the configuration's profile, with one for every instance that has
+// an address, and returns the number of instances written. The blocks of other profiles are kept as they are.
+func syncSSHConfig(instances []Instance, config *OpenStackConfig) (int, error) {
+	profile := sshConfigProfile(config)
+	existing, existingBlocks, err := readSSHConfigBlocks()
+	if err != nil {
+		return 0, err
+	}
+
+	var names []string
+	blocks := map[string]string{}
+	set := func(name, block string) {
+		if _, ok := blocks[name]; !ok {
+			names = append(names, name)
+		}
+		blocks[name] = block
+	}
+	for _, name := range existing {
+		if sshConfigBlockProfile(existingBlocks[name]) != profile {
+			set(name, existingBlocks[name])
+		}
+	}
+	if config.Bastion.Enabled() {
+		set(profileBastionHostAlias(profile), bastionSSHConfigBlock(config.Bastion, profile))
+	}
+	count := 0
+	for i := range instances {
+		entry := sshHostEntryForInstance(&instances[i], config)
+		if entry.HostName == "" {
+			continue
+		}
+		set(entry.Name, entry.String())
+		count++
+	}
+	return count, writeSSHConfigBlocks(names, blocks)
+}
+
+func init() {
+	sshConfigCmd.Flags().Bool("sync", false, "Regenerate the current profile's hosts in ~/.ssh/config.d/tins from its instances instead of printing")
+	rootCmd.AddCommand(sshConfigCmd)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSSHHostEntryString(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	entry := sshHostEntry{
+		Name:         "tins-mystical-honda",
+		HostName:     "10.0.0.5",
+		User:         "ubuntu",
+		IdentityFile: "/home/test/.ssh/tins-mystical-honda",
+		ProxyJump:    "jump@bastion.example.com",
+	}
+
+	block := entry.String()
+	for _, want := range []string{
+		"Host tins-mystical-honda\n",
+		"    HostName 10.0.0.5\n",
+		"    User ubuntu\n",
+		"    IdentityFile /home/test/.ssh/tins-mystical-honda\n",
+		"    UserKnownHostsFile /home/test/.ssh/tins_known_hosts\n",
+		"    HostKeyAlias tins-mystical-honda\n",
+		"    ProxyJump jump@bastion.example.com\n",
+	} {
+		if !strings.Contains(block, want) {
+			t.Errorf("Expected Host block to contain %q, got:\n%s", want, block)
+		}
+	}
+
+	entry.IdentityFile, entry.ProxyJump = "", ""
+	block = entry.String()
+	if strings.Contains(block, "IdentityFile") || strings.Contains(block, "ProxyJump") {
+		t.Errorf("Expected optional settings to be left out, got:\n%s", block)
+	}
+}
+
+func TestSSHConfigEntries(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, name := range []string{"tins-first", "tins-second"} {
+		if err := addSSHConfigEntry(sshHostEntry{Name: name, HostName: "10.0.0.5", User: "ubuntu"}); err != nil {
+			t.Fatalf("addSSHConfigEntry failed: %v", err)
+		}
+	}
+	// Adding an instance again replaces its block
+	if err := addSSHConfigEntry(sshHostEntry{Name: "tins-first", HostName: "10.0.0.9", User: "ubuntu"}); err != nil {
+		t.Fatalf("addSSHConfigEntry failed: %v", err)
+	}
+
+	names, blocks, err := readSSHConfigBlocks()
+	if err != nil {
+		t.Fatalf("readSSHConfigBlocks failed: %v", err)
+	}
+	if strings.Join(names, ",") != "tins-first,tins-second" {
+		t.Errorf("Expected both hosts in order, got %v", names)
+	}
+	if !strings.Contains(blocks["tins-first"], "HostName 10.0.0.9") {
+		t.Errorf("Expected the replaced block, got:\n%s", blocks["tins-first"])
+	}
+
+	removed, err := removeSSHConfigEntry("tins-first")
+	if err != nil || !removed {
+		t.Fatalf("Expected the block to be removed, got %v, %v", removed, err)
+	}
+	data, _ := os.ReadFile(sshConfigPath())
+	if strings.Contains(string(data), "tins-first") || !strings.Contains(string(data), "Host tins-second") {
+		t.Errorf("Expected only tins-second to remain, got:\n%s", data)
+	}
+	if !strings.HasPrefix(string(data), sshConfigHeader) {
+		t.Errorf("Expected the managed-file header, got:\n%s", data)
+	}
+}
+
+func TestSSHConfigIncluded(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if sshConfigIncluded() {
+		t.Error("Expected no include without ~/.ssh/config")
+	}
+
+	for _, include := range []string{"Include config.d/tins", "include ~/.ssh/config.d/*", "Include " + filepath.Join(home, ".ssh", "config.d", "tins")} {
+		writeTestFile(t, filepath.Join(home, ".ssh", "config"), "Host *\n    ServerAliveInterval 30\n"+include+"\n")
+		if !sshConfigIncluded() {
+			t.Errorf("Expected %q to include the tins config", include)
+		}
+	}
+
+	writeTestFile(t, filepath.Join(home, ".ssh", "config"), "Include config.d/work\n")
+	if sshConfigIncluded() {
+		t.Error("Expected another include file not to count")
+	}
+}
+
+func TestCreateTerminate_SSHConfig(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	for _, name := range []string{"alpha", "beta"} {
+		if output, err := runCommand(t, "create", name); err != nil {
+			t.Fatalf("create command failed: %v\n%s", err, output)
+		}
+	}
+
+	_, blocks, err := readSSHConfigBlocks()
+	if err != nil {
+		t.Fatalf("readSSHConfigBlocks failed: %v", err)
+	}
+	block := blocks["tins-alpha"]
+	if !strings.Contains(block, "HostName 10.0.0.") || !strings.Contains(block, "IdentityFile "+GetSSHKeyPath("alpha")) {
+		t.Errorf("Expected a Host block for tins-alpha, got:\n%s", block)
+	}
+
+	if _, err := runCommand(t, "terminate", "alpha"); err != nil {
+		t.Fatalf("terminate command failed: %v", err)
+	}
+	_, blocks, _ = readSSHConfigBlocks()
+	if _, ok := blocks["tins-alpha"]; ok {
+		t.Error("Expected terminate to remove the Host block")
+	}
+
+	// --sync rebuilds the current profile's hosts from the instances that exist and keeps other profiles' hosts
+	if err := os.Remove(sshConfigPath()); err != nil {
+		t.Fatalf("failed to remove SSH config: %v", err)
+	}
+	if err := addSSHConfigEntry(sshHostEntry{Name: "tins-east", HostName: "10.1.0.5", User: "ubuntu", Profile: "east"}); err != nil {
+		t.Fatalf("addSSHConfigEntry failed: %v", err)
+	}
+	if err := addSSHConfigEntry(sshHostEntry{Name: "tins-gone", HostName: "10.0.0.99", User: "ubuntu", Profile: DefaultProfileName}); err != nil {
+		t.Fatalf("addSSHConfigEntry failed: %v", err)
+	}
+	output, err := runCommand(t, "ssh-config", "--sync")
+	if err != nil {
+		t.Fatalf("ssh-config command failed: %v\n%s", err, output)
+	}
+	names, _, _ := readSSHConfigBlocks()
+	if strings.Join(names, ",") != "tins-east,tins-beta" {
+		t.Errorf("Expected tins-east and tins-beta after sync, got %v", names)
+	}
+	if !strings.Contains(output, "Include config.d/tins") {
+		t.Errorf("Expected a hint to include the file, got:\n%s", output)
+	}
+
+	// terminate --all only removes the hosts it terminated
+	resetFlagsAfterTest(t, terminateCmd)
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	names, _, _ = readSSHConfigBlocks()
+	if strings.Join(names, ",") != "tins-east" {
+		t.Errorf("Expected the other profile's host to survive terminate --all, got %v", names)
+	}
+}
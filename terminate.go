@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
-	"strings"
+	"io"
+	"os"
 
 	"github.com/spf13/cobra"
 )
@@ -14,6 +15,12 @@ var terminateCmd = &cobra.Command{
 	Long:  "Terminate an ephemeral OpenStack instance and delete its associated SSH keys. Use --all to terminate all tins instances.",
 	Args:  cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := outputFormat(cmd)
+		if err != nil {
+			return err
+		}
+		out := progressWriter(format)
+
 		// Check for --all flag
 		terminateAll, _ := cmd.Flags().GetBool("all")
 
@@ -22,7 +29,7 @@ var terminateCmd = &cobra.Command{
 			if len(args) > 0 {
 				return fmt.Errorf("cannot specify instance identifier with --all flag")
 			}
-			return terminateAllInstances(cmd)
+			return terminateAllInstances(format)
 		}
 
 		// Regular single instance termination
@@ -38,207 +45,236 @@ var terminateCmd = &cobra.Command{
 			return err
 		}
 
-		// Create OpenStack client
+		// Create provider client
 		ctx := context.Background()
-		client, err := NewOpenStackClient(ctx, config)
+		client, err := newProvider(ctx, config)
 		if err != nil {
-			return fmt.Errorf("failed to create OpenStack client: %w", err)
-		}
-
-		var serverID string
-		var instanceName string
-		var fullInstanceName string
-
-		// Check if it's an instance name or ID
-		if strings.HasPrefix(instanceIdentifier, InstanceNamePrefix) {
-			// It's a full instance name
-			fullInstanceName = instanceIdentifier
-			instanceName = strings.TrimPrefix(instanceIdentifier, InstanceNamePrefix)
-			// Find the server by name
-			servers, err := client.ListInstances(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to list instances: %w", err)
-			}
-
-			found := false
-			for _, s := range servers {
-				if s.Name == instanceIdentifier {
-					serverID = s.ID
-					found = true
-					break
-				}
-			}
-
-			if !found {
-				return fmt.Errorf("instance '%s' not found", instanceIdentifier)
-			}
-		} else {
-			// It's just the name part (without prefix) or an instance ID
-			// Try to find by name first
-			fullName := fmt.Sprintf("%s%s", InstanceNamePrefix, instanceIdentifier)
-			servers, err := client.ListInstances(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to list instances: %w", err)
-			}
-
-			found := false
-			for _, s := range servers {
-				if s.Name == fullName {
-					serverID = s.ID
-					fullInstanceName = s.Name
-					instanceName = instanceIdentifier
-					found = true
-					break
-				}
-			}
+			return err
+		}
 
-			if !found {
-				// Assume it's an instance ID
-				serverID = instanceIdentifier
-				server, err := client.GetInstance(ctx, serverID)
-				if err != nil {
-					return fmt.Errorf("failed to get instance: %w", err)
-				}
-				fullInstanceName = server.Name
-				// Extract instance name from full name
-				if strings.HasPrefix(server.Name, InstanceNamePrefix) {
-					instanceName = strings.TrimPrefix(server.Name, InstanceNamePrefix)
-				} else {
-					instanceName = server.Name
-				}
-			}
+		instance, err := findInstance(ctx, client, instanceIdentifier)
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
 		}
 
-		// Delete the instance
-		fmt.Printf("Terminating instance %s (ID: %s)...\n", instanceIdentifier, serverID)
-		if err := client.DeleteInstance(ctx, serverID); err != nil {
+		fmt.Fprintf(out, "Terminating instance %s (ID: %s)...\n", instanceIdentifier, instance.ID)
+		if err := terminateInstance(ctx, client, instance, out); err != nil {
 			return fmt.Errorf("failed to delete instance: %w", err)
 		}
-		fmt.Printf("Instance terminated successfully.\n")
 
-		// Delete OpenStack keypair - keypair name matches full instance name
-		if fullInstanceName != "" {
-			fmt.Printf("Deleting OpenStack keypair %s...\n", fullInstanceName)
-			if err := client.DeleteKeypair(ctx, fullInstanceName); err != nil {
-				// Don't fail if keypair doesn't exist, just warn
-				fmt.Printf("Warning: Failed to delete OpenStack keypair (it may not exist): %v\n", err)
-			} else {
-				fmt.Printf("OpenStack keypair deleted successfully.\n")
-			}
-		} else {
-			fmt.Printf("Warning: Could not determine instance name, skipping OpenStack keypair cleanup\n")
+		if isStructuredOutput(format) {
+			return writeStructured(os.Stdout, format, TerminateOutput{ID: instance.ID, Name: instance.Name, Terminated: true})
 		}
+		return nil
+	},
+}
 
-		// Delete local SSH keys - always try to clean up if we have an instance name
-		if instanceName != "" {
-			fmt.Printf("Cleaning up local SSH keys for %s...\n", instanceName)
-			if err := DeleteSSHKey(instanceName); err != nil {
-				// Don't fail if keys don't exist, just warn
-				fmt.Printf("Warning: Failed to delete local SSH keys (they may not exist): %v\n", err)
-			} else {
-				fmt.Printf("Local SSH keys deleted successfully.\n")
-			}
+// terminateInstance deletes an instance and then cleans up the resources tins created for it.
+// Only a failure to delete the instance itself is returned; cleanup problems are reported as warnings on out.
+func terminateInstance(ctx context.Context, client Provider, instance *Instance, out io.Writer) error {
+	if err := client.DeleteInstance(ctx, instance.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Instance %s terminated successfully.\n", instance.Name)
+
+	cleanupInstanceResources(ctx, client, instance, out)
+	return nil
+}
+
+// cleanupInstanceResources removes the known_hosts entries, SSH config, floating IP, network, keypair and local SSH keys belonging to a terminated instance.
+// Instances created with a personal public key share a keypair and have no tins-generated keys, so those are kept.
+func cleanupInstanceResources(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	// Forget the instance's host keys so a later instance with the same IP isn't rejected
+	if removed, err := removeHostKeys(instance.Name); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to remove host keys from %s: %v\n", knownHostsPath(), err)
+	} else if removed {
+		fmt.Fprintf(out, "Host keys removed from %s.\n", knownHostsPath())
+	}
+
+	if removed, err := removeSSHConfigEntry(instance.Name); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to remove SSH config for %s: %v\n", instance.Name, err)
+	} else if removed {
+		fmt.Fprintf(out, "SSH config for %s removed from %s.\n", instance.Name, sshConfigPath())
+	}
+
+	// The floating IP must be gone before the router of an instance network can be deleted
+	releaseInstanceFloatingIP(ctx, client, instance, out)
+	deleteInstanceNetwork(ctx, client, instance, out)
+	deleteInstanceSecurityGroup(ctx, client, instance, out)
+	deleteInstanceVolumes(ctx, client, instance, out)
+	// A home volume outlives the instance; Nova detaches it on delete, this makes sure
+	detachHomeVolume(ctx, client, instance, out)
+
+	if keypairName, ok := instance.Metadata[KeypairTag]; ok {
+		fmt.Fprintf(out, "Instance uses shared keypair %s; keeping it and all local SSH keys.\n", keypairName)
+		return
+	}
+
+	// Delete OpenStack keypair - keypair name matches full instance name; SSH CA instances have none
+	if _, ok := instance.Metadata[SSHCATag]; ok {
+		fmt.Fprintf(out, "Instance uses SSH certificates; no OpenStack keypair to delete.\n")
+	} else if instance.Name != "" {
+		fmt.Fprintf(out, "Deleting OpenStack keypair %s...\n", instance.Name)
+		if err := client.DeleteKeypair(ctx, instance.Name); err != nil {
+			// Don't fail if keypair doesn't exist, just warn
+			fmt.Fprintf(out, "Warning: Failed to delete OpenStack keypair (it may not exist): %v\n", err)
 		} else {
-			fmt.Printf("Warning: Could not determine instance name, skipping local SSH key cleanup\n")
+			fmt.Fprintf(out, "OpenStack keypair deleted successfully.\n")
 		}
+	} else {
+		fmt.Fprintf(out, "Warning: Could not determine instance name, skipping OpenStack keypair cleanup\n")
+	}
 
-		return nil
-	},
+	// Remove the key from ssh-agent if it was added there
+	if instance.Name != "" {
+		if removed, err := removeKeyFromAgent(instance.Name); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to remove SSH key from ssh-agent: %v\n", err)
+		} else if removed {
+			fmt.Fprintf(out, "SSH key removed from ssh-agent.\n")
+		}
+	}
+
+	// Delete local SSH keys - extract instance name from full name
+	instanceName := shortInstanceName(instance.Name)
+	if instanceName != "" {
+		fmt.Fprintf(out, "Cleaning up local SSH keys for %s...\n", instanceName)
+		if err := DeleteSSHKey(instanceName); err != nil {
+			// Don't fail if keys don't exist, just warn
+			fmt.Fprintf(out, "Warning: Failed to delete local SSH keys (they may not exist): %v\n", err)
+		} else {
+			fmt.Fprintf(out, "Local SSH keys deleted successfully.\n")
+		}
+	} else {
+		fmt.Fprintf(out, "Warning: Could not determine instance name, skipping local SSH key cleanup\n")
+	}
 }
 
-// terminateAllInstances terminates all tins instances and cleans up all tins keypairs
-func terminateAllInstances(_ *cobra.Command) error {
+// terminateAllInstances terminates all tins instances and cleans up their keypairs
+func terminateAllInstances(format string) error {
+	out := progressWriter(format)
+
 	// Load configuration
 	config, err := LoadConfig()
 	if err != nil {
 		return err
 	}
 
-	// Create OpenStack client
+	// Create provider client
 	ctx := context.Background()
-	client, err := NewOpenStackClient(ctx, config)
+	client, err := newProvider(ctx, config)
 	if err != nil {
-		return fmt.Errorf("failed to create OpenStack client: %w", err)
+		return err
 	}
 
 	// Get all tins instances
-	servers, err := client.ListInstances(ctx)
+	instances, err := client.ListInstances(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list instances: %w", err)
 	}
 
-	if len(servers) == 0 {
-		fmt.Printf("No tins instances found to terminate.\n")
+	results := []TerminateOutput{}
+	if len(instances) == 0 {
+		fmt.Fprintf(out, "No tins instances found to terminate.\n")
 	} else {
-		fmt.Printf("Found %d tins instance(s) to terminate:\n", len(servers))
-		for _, server := range servers {
-			fmt.Printf("  - %s (ID: %s, Status: %s)\n", server.Name, server.ID, server.Status)
+		fmt.Fprintf(out, "Found %d tins instance(s) to terminate:\n", len(instances))
+		for _, instance := range instances {
+			fmt.Fprintf(out, "  - %s (ID: %s, Status: %s)\n", instance.Name, instance.ID, instance.Status)
 		}
-		fmt.Printf("\nTerminating instances...\n")
+		fmt.Fprintf(out, "\nTerminating instances...\n")
 
 		// Terminate each instance
-		for _, server := range servers {
-			fmt.Printf("\nTerminating instance %s (ID: %s)...\n", server.Name, server.ID)
+		for _, instance := range instances {
+			fmt.Fprintf(out, "\nTerminating instance %s (ID: %s)...\n", instance.Name, instance.ID)
 
-			// Delete the instance
-			if err := client.DeleteInstance(ctx, server.ID); err != nil {
-				fmt.Printf("Error: Failed to delete instance %s: %v\n", server.Name, err)
-				continue
-			}
-			fmt.Printf("Instance %s terminated successfully.\n", server.Name)
-
-			// Delete OpenStack keypair - keypair name matches full instance name
-			if server.Name != "" {
-				fmt.Printf("Deleting OpenStack keypair %s...\n", server.Name)
-				if err := client.DeleteKeypair(ctx, server.Name); err != nil {
-					// Don't fail if keypair doesn't exist, just warn
-					fmt.Printf("Warning: Failed to delete OpenStack keypair (it may not exist): %v\n", err)
-				} else {
-					fmt.Printf("OpenStack keypair deleted successfully.\n")
-				}
+			result := TerminateOutput{ID: instance.ID, Name: instance.Name, Terminated: true}
+			if err := terminateInstance(ctx, client, &instance, out); err != nil {
+				fmt.Fprintf(out, "Error: Failed to delete instance %s: %v\n", instance.Name, err)
+				result.Terminated = false
+				result.Error = err.Error()
 			}
+			results = append(results, result)
+		}
+	}
 
-			// Delete local SSH keys - extract instance name from full name
-			var instanceName string
-			if strings.HasPrefix(server.Name, InstanceNamePrefix) {
-				instanceName = strings.TrimPrefix(server.Name, InstanceNamePrefix)
-			} else {
-				instanceName = server.Name
-			}
+	// Drop the Host blocks of the terminated instances; other profiles' instances were never listed here
+	survivors := map[string]bool{}
+	terminated := map[string]bool{}
+	for _, result := range results {
+		if !result.Terminated {
+			survivors[result.Name] = true
+		} else {
+			terminated[result.Name] = true
+		}
+	}
+	if removed, err := removeSSHConfigEntries(func(name string) bool { return terminated[name] }); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up %s: %v\n", sshConfigPath(), err)
+	} else if removed > 0 {
+		fmt.Fprintf(out, "Removed %d stale host(s) from %s.\n", removed, sshConfigPath())
+	}
 
-			if instanceName != "" {
-				fmt.Printf("Cleaning up local SSH keys for %s...\n", instanceName)
-				if err := DeleteSSHKey(instanceName); err != nil {
-					// Don't fail if keys don't exist, just warn
-					fmt.Printf("Warning: Failed to delete local SSH keys (they may not exist): %v\n", err)
-				} else {
-					fmt.Printf("Local SSH keys deleted successfully.\n")
-				}
-			}
+	// Release floating IPs left behind by failed creates, keeping those of instances that still exist
+	keepFloatingIPs := map[string]bool{}
+	for _, instance := range instances {
+		if survivors[instance.Name] && instance.Metadata[FloatingIPTag] != "" {
+			keepFloatingIPs[instance.Metadata[FloatingIPTag]] = true
 		}
 	}
+	if err := releaseOrphanedFloatingIPs(ctx, client, keepFloatingIPs, out); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up orphaned floating IPs: %v\n", err)
+	}
+
+	// Delete instance networks left behind by failed creates or terminates
+	if err := deleteOrphanedNetworks(ctx, client, survivors, out); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up orphaned networks: %v\n", err)
+	}
+	if err := deleteOrphanedSecurityGroups(ctx, client, survivors, out); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up orphaned security groups: %v\n", err)
+	}
+	if err := deleteOrphanedVolumes(ctx, client, survivors, out); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up orphaned volumes: %v\n", err)
+	}
+
+	// Retry the keypairs that terminating their instance failed to delete.
+	// Keypairs belong to the user rather than the project, so nothing else is touched.
+	if err := deleteLeftoverKeypairs(ctx, client, terminated, out); err != nil {
+		fmt.Fprintf(out, "Warning: Failed to clean up leftover keypairs: %v\n", err)
+	}
 
-	// Additional cleanup: delete any remaining tins keypairs that don't have associated instances
-	fmt.Printf("\nChecking for orphaned tins keypairs...\n")
-	if err := cleanupOrphanedKeypairs(ctx, client); err != nil {
-		fmt.Printf("Warning: Failed to clean up orphaned keypairs: %v\n", err)
+	if len(survivors) > 0 {
+		fmt.Fprintf(out, "\n%d tins instance(s) could not be terminated.\n", len(survivors))
 	} else {
-		fmt.Printf("Orphaned keypair cleanup completed.\n")
+		fmt.Fprintf(out, "\nAll tins instances and their keypairs have been cleaned up.\n")
 	}
 
-	fmt.Printf("\nAll tins instances and keypairs have been cleaned up.\n")
+	if isStructuredOutput(format) {
+		return writeStructured(os.Stdout, format, results)
+	}
 	return nil
 }
 
-// cleanupOrphanedKeypairs removes any tins keypairs that don't have associated instances
-func cleanupOrphanedKeypairs(_ context.Context, _ *OpenStackClient) error {
-	// This would require implementing a ListKeypairs method in OpenStackClient
-	// For now, we'll just note that this is where additional cleanup could happen
-	// The main cleanup happens through the instance termination loop above
+// deleteLeftoverKeypairs deletes the keypairs that are still named after an instance in terminated.
+// Keypairs are never deleted by prefix: they are shared by all projects of a user, so a tins-* keypair
+// may belong to a live instance elsewhere.
+func deleteLeftoverKeypairs(ctx context.Context, client Provider, terminated map[string]bool, out io.Writer) error {
+	names, err := client.ListKeypairs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if !terminated[name] {
+			continue
+		}
+		if err := client.DeleteKeypair(ctx, name); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to delete keypair %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted leftover keypair %s.\n", name)
+	}
 	return nil
 }
 
 func init() {
-	terminateCmd.Flags().Bool("all", false, "Terminate all tins instances and clean up all tins keypairs")
+	terminateCmd.Flags().Bool("all", false, "Terminate all tins instances of the current profile and clean up their keypairs")
 	rootCmd.AddCommand(terminateCmd)
 }
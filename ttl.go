@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTTL parses a time-to-live such as "90m", "4h" or "2d".
+// In addition to the units understood by time.ParseDuration, a "d" suffix means days.
+func parseTTL(value string) (time.Duration, error) {
+	var ttl time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s'", value)
+		}
+		ttl = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s': %w", value, err)
+		}
+		ttl = parsed
+	}
+
+	if ttl <= 0 {
+		return 0, fmt.Errorf("duration must be positive, got '%s'", value)
+	}
+	return ttl, nil
+}
+
+// ExpiresAt returns the expiry time stored in the instance metadata.
+// The second return value is false if the instance has no TTL or the value cannot be parsed.
+func (i *Instance) ExpiresAt() (time.Time, bool) {
+	value, ok := i.Metadata[ExpiresAtTag]
+	if !ok {
+		return time.Time{}, false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiresAt, true
+}
+
+// IsExpired reports whether the instance has a TTL that has passed
+func (i *Instance) IsExpired(now time.Time) bool {
+	expiresAt, ok := i.ExpiresAt()
+	return ok && !now.Before(expiresAt)
+}
+
+// formatRemaining formats the time left until the instance expires for display
+func formatRemaining(instance *Instance, now time.Time) string {
+	expiresAt, ok := instance.ExpiresAt()
+	if !ok {
+		return "-"
+	}
+	if !now.Before(expiresAt) {
+		return "expired"
+	}
+	return expiresAt.Sub(now).Truncate(time.Minute).String()
+}
+
+// formatExpiresAt formats an expiry time for storage in instance metadata
+func formatExpiresAt(expiresAt time.Time) string {
+	return expiresAt.UTC().Format(time.RFC3339)
+}
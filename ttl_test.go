@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90m": 90 * time.Minute,
+		"4h":  4 * time.Hour,
+		"2d":  48 * time.Hour,
+	}
+	for value, expected := range tests {
+		ttl, err := parseTTL(value)
+		if err != nil {
+			t.Errorf("parseTTL(%q) failed: %v", value, err)
+			continue
+		}
+		if ttl != expected {
+			t.Errorf("parseTTL(%q) = %s, expected %s", value, ttl, expected)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "xd", "-1h", "0s"} {
+		if _, err := parseTTL(value); err == nil {
+			t.Errorf("parseTTL(%q) should fail", value)
+		}
+	}
+}
+
+func TestInstanceExpiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	instance := &Instance{Metadata: map[string]string{}}
+	if instance.IsExpired(now) {
+		t.Error("Instance without TTL should never be expired")
+	}
+	if formatRemaining(instance, now) != "-" {
+		t.Errorf("Expected '-' for instance without TTL, got '%s'", formatRemaining(instance, now))
+	}
+
+	instance.Metadata[ExpiresAtTag] = formatExpiresAt(now.Add(90 * time.Minute))
+	if instance.IsExpired(now) {
+		t.Error("Instance should not be expired before its expiry time")
+	}
+	if formatRemaining(instance, now) != "1h30m0s" {
+		t.Errorf("Expected '1h30m0s' remaining, got '%s'", formatRemaining(instance, now))
+	}
+
+	if !instance.IsExpired(now.Add(2 * time.Hour)) {
+		t.Error("Instance should be expired after its expiry time")
+	}
+	if formatRemaining(instance, now.Add(2*time.Hour)) != "expired" {
+		t.Errorf("Expected 'expired', got '%s'", formatRemaining(instance, now.Add(2*time.Hour)))
+	}
+
+	instance.Metadata[ExpiresAtTag] = "not-a-time"
+	if _, ok := instance.ExpiresAt(); ok {
+		t.Error("ExpiresAt should ignore unparseable values")
+	}
+}
+
+func TestReapCommand_FakeProvider(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	ctx := context.Background()
+	expired, _ := provider.CreateInstance(ctx, InstanceSpec{
+		Name:     "tins-old",
+		Metadata: map[string]string{ExpiresAtTag: formatExpiresAt(time.Now().Add(-time.Minute))},
+	})
+	current, _ := provider.CreateInstance(ctx, InstanceSpec{
+		Name:     "tins-current",
+		Metadata: map[string]string{ExpiresAtTag: formatExpiresAt(time.Now().Add(time.Hour))},
+	})
+	forever, _ := provider.CreateInstance(ctx, InstanceSpec{Name: "tins-forever"})
+
+	output, err := runCommand(t, "reap")
+	if err != nil {
+		t.Fatalf("reap command failed: %v\n%s", err, output)
+	}
+
+	if _, ok := provider.instances[expired.ID]; ok {
+		t.Error("Expected expired instance to be reaped")
+	}
+	if _, ok := provider.instances[current.ID]; !ok {
+		t.Error("Expected unexpired instance to be kept")
+	}
+	if _, ok := provider.instances[forever.ID]; !ok {
+		t.Error("Expected instance without TTL to be kept")
+	}
+}
+
+func TestExtendCommand_FakeOpenStack(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	fake.AddServer("tins-extend-me", InstanceStatusActive, map[string]string{
+		TempInstanceTag: "true",
+		ExpiresAtTag:    formatExpiresAt(expiresAt),
+	})
+
+	output, err := runCommand(t, "extend", "extend-me", "2h")
+	if err != nil {
+		t.Fatalf("extend command failed: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "now expires at") {
+		t.Errorf("Unexpected extend output:\n%s", output)
+	}
+
+	server := fake.Server("tins-extend-me")
+	expected := formatExpiresAt(expiresAt.Add(2 * time.Hour))
+	if server.Metadata[ExpiresAtTag] != expected {
+		t.Errorf("Expected expiry '%s', got '%s'", expected, server.Metadata[ExpiresAtTag])
+	}
+}
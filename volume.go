@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// mountPointPattern limits mount points to characters that are safe in the cloud-init mount script
+var mountPointPattern = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+
+// DataVolume is a volume requested with --volume
+type DataVolume struct {
+	SizeGB     int
+	VolumeType string // Volume type; empty uses volume_type from the config file or the cloud's default
+	MountPoint string // Where cloud-init formats and mounts the volume; empty leaves it unformatted
+}
+
+// parseDataVolume parses <size>[:<type>][:<mount-point>], e.g. 100, 100:ssd, 100:/data or 100:ssd:/data
+func parseDataVolume(value string) (DataVolume, error) {
+	fields := strings.Split(value, ":")
+	if len(fields) > 3 {
+		return DataVolume{}, fmt.Errorf("invalid volume '%s' (expected <size>[:<type>][:<mount-point>])", value)
+	}
+
+	var volume DataVolume
+	size, err := strconv.Atoi(fields[0])
+	if err != nil || size < 1 {
+		return DataVolume{}, fmt.Errorf("invalid volume size in '%s' (must be a number of GB)", value)
+	}
+	volume.SizeGB = size
+
+	rest := fields[1:]
+	if len(rest) > 0 && strings.HasPrefix(rest[len(rest)-1], "/") {
+		volume.MountPoint = rest[len(rest)-1]
+		rest = rest[:len(rest)-1]
+	}
+	if len(rest) > 1 || (len(rest) == 1 && strings.HasPrefix(rest[0], "/")) {
+		return DataVolume{}, fmt.Errorf("invalid volume '%s' (expected <size>[:<type>][:<mount-point>])", value)
+	}
+	if len(rest) == 1 {
+		volume.VolumeType = rest[0]
+	}
+
+	if volume.MountPoint != "" {
+		if !mountPointPattern.MatchString(volume.MountPoint) || volume.MountPoint == "/" || strings.Contains(volume.MountPoint, "..") {
+			return DataVolume{}, fmt.Errorf("invalid mount point in '%s'", value)
+		}
+	}
+	return volume, nil
+}
+
+// volumeDescription describes a volume for metadata and list output, e.g. "100GB" or "100GB (ssd)"
+func volumeDescription(sizeGB int, volumeType string) string {
+	if volumeType == "" {
+		return fmt.Sprintf("%dGB", sizeGB)
+	}
+	return fmt.Sprintf("%dGB (%s)", sizeGB, volumeType)
+}
+
+// volumeMount is a volume that cloud-init mounts once it is attached
+type volumeMount struct {
+	VolumeID   string
+	MountPoint string
+	Owner      string // For home volumes, the user whose home directory the volume is mounted on
+}
+
+// volumeMountScript waits for a volume to be attached, formats it unless it already has a filesystem and
+// mounts it. Nova sets the disk serial to the volume ID (truncated to 20 characters for virtio-blk), which
+// shows up in /dev/disk/by-id. The volume is attached only after the instance is active, so the script waits.
+const volumeMountScript = `mount_volume() {
+	serial=$(echo "$1" | cut -c1-20)
+	device=""
+	tries=0
+	while [ -z "$device" ] && [ $tries -lt 120 ]; do
+		device=$(ls -d /dev/disk/by-id/*"$serial"* 2>/dev/null | grep -v -- -part | head -n 1)
+		[ -n "$device" ] || sleep 5
+		tries=$((tries + 1))
+	done
+	if [ -z "$device" ]; then
+		echo "tins: volume $1 was not attached" >&2
+		return 1
+	fi
+	blkid "$device" >/dev/null 2>&1 || mkfs.ext4 -q "$device"
+	mkdir -p "$2"
+	echo "UUID=$(blkid -s UUID -o value "$device") $2 auto defaults,nofail 0 2" >> /etc/fstab
+	mount "$2"
+}
+
+mount_home() {
+	keys=$(mktemp)
+	cp "$2/.ssh/authorized_keys" "$keys" 2>/dev/null
+	mount_volume "$1" "$2" || { rm -f "$keys"; return 1; }
+	if [ ! -e "$2/.tins-home" ]; then
+		cp -a /etc/skel/. "$2/"
+		touch "$2/.tins-home"
+		chown -R "$3": "$2"
+	fi
+	if [ -s "$keys" ]; then
+		mkdir -p "$2/.ssh"
+		cp "$keys" "$2/.ssh/authorized_keys"
+		chmod 700 "$2/.ssh"
+		chmod 600 "$2/.ssh/authorized_keys"
+		chown -R "$3": "$2/.ssh"
+	fi
+	rm -f "$keys"
+}
+`
+
+// volumeMountCloudConfig returns the cloud-init runcmd that formats and mounts the given volumes
+func volumeMountCloudConfig(mounts []volumeMount) map[string]interface{} {
+	var script strings.Builder
+	script.WriteString(volumeMountScript)
+	for _, mount := range mounts {
+		if mount.Owner != "" {
+			fmt.Fprintf(&script, "mount_home '%s' '%s' '%s'\n", mount.VolumeID, mount.MountPoint, mount.Owner)
+		} else {
+			fmt.Fprintf(&script, "mount_volume '%s' '%s'\n", mount.VolumeID, mount.MountPoint)
+		}
+	}
+	return map[string]interface{}{
+		"runcmd": [][]string{{"sh", "-c", script.String()}},
+	}
+}
+
+// createDataVolumes creates the --volume volumes of an instance, named <instance>-vol<N> and tagged with the
+// instance name so terminate can find them. Volumes created before a failure are deleted again.
+func createDataVolumes(ctx context.Context, client Provider, instanceName string, requests []DataVolume, out io.Writer) ([]Volume, error) {
+	var created []Volume
+	for i, request := range requests {
+		spec := VolumeSpec{
+			Name:       fmt.Sprintf("%s-vol%d", instanceName, i+1),
+			SizeGB:     request.SizeGB,
+			VolumeType: request.VolumeType,
+			Metadata:   map[string]string{VolumeInstanceTag: instanceName},
+		}
+		fmt.Fprintf(out, "Creating volume %s (%s)...\n", spec.Name, volumeDescription(spec.SizeGB, spec.VolumeType))
+		volume, err := client.CreateVolume(ctx, spec)
+		if err != nil {
+			deleteVolumes(ctx, client, created, out)
+			return nil, err
+		}
+		created = append(created, *volume)
+	}
+	return created, nil
+}
+
+// deleteVolumes deletes volumes that were created for an instance that could not be created
+func deleteVolumes(ctx context.Context, client Provider, volumes []Volume, out io.Writer) {
+	for _, volume := range volumes {
+		if err := client.DeleteVolume(ctx, volume.ID); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to clean up volume %s: %v\n", volume.Name, err)
+		}
+	}
+}
+
+// attachDataVolumes attaches the created volumes to an active instance
+func attachDataVolumes(ctx context.Context, client Provider, instance *Instance, volumes []Volume, out io.Writer) {
+	for _, volume := range volumes {
+		fmt.Fprintf(out, "Attaching volume %s...\n", volume.Name)
+		if err := client.AttachVolume(ctx, instance.ID, volume.ID); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to attach volume %s: %v\n", volume.Name, err)
+			continue
+		}
+		fmt.Fprintf(out, "Volume %s attached\n", volume.Name)
+	}
+}
+
+// deleteInstanceVolumes detaches and deletes the data volumes tins created for an instance
+func deleteInstanceVolumes(ctx context.Context, client Provider, instance *Instance, out io.Writer) {
+	volumes, err := client.ListVolumes(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "Warning: Failed to list volumes: %v\n", err)
+		return
+	}
+
+	for _, volume := range volumes {
+		if volume.Metadata[VolumeInstanceTag] != instance.Name {
+			continue
+		}
+		fmt.Fprintf(out, "Deleting volume %s...\n", volume.Name)
+		if err := detachAndDeleteVolume(ctx, client, volume); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to delete volume %s: %v\n", volume.Name, err)
+		} else {
+			fmt.Fprintf(out, "Volume %s deleted.\n", volume.Name)
+		}
+	}
+}
+
+// deleteOrphanedVolumes deletes tins data volumes whose instance is gone.
+// Volumes of the instances in keep are left alone.
+func deleteOrphanedVolumes(ctx context.Context, client Provider, keep map[string]bool, out io.Writer) error {
+	volumes, err := client.ListVolumes(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, volume := range volumes {
+		instanceName, ok := volume.Metadata[VolumeInstanceTag]
+		if !ok || keep[instanceName] {
+			continue
+		}
+		if err := detachAndDeleteVolume(ctx, client, volume); err != nil {
+			fmt.Fprintf(out, "Warning: Failed to delete volume %s: %v\n", volume.Name, err)
+			continue
+		}
+		fmt.Fprintf(out, "Deleted orphaned volume %s.\n", volume.Name)
+	}
+	return nil
+}
+
+// detachAndDeleteVolume detaches a volume from every instance it is still attached to, then deletes it
+func detachAndDeleteVolume(ctx context.Context, client Provider, volume Volume) error {
+	for _, serverID := range volume.ServerIDs {
+		if err := client.DetachVolume(ctx, serverID, volume.ID); err != nil {
+			return err
+		}
+	}
+	return client.DeleteVolume(ctx, volume.ID)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreate_BootVolume(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+	resetFlagsAfterTest(t, rootCmd)
+
+	if _, err := runCommand(t, "create", "typed", "--volume-type", "ssd"); err == nil || !strings.Contains(err.Error(), "--boot-volume-size") {
+		t.Errorf("Expected --volume-type without a boot volume to fail, got %v", err)
+	}
+
+	if _, err := runCommand(t, "create", "builder", "--boot-volume-size", "100", "--volume-type", "ssd"); err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	spec := createdSpec(t, provider, "tins-builder")
+	if spec.BootVolumeSize != 100 || spec.VolumeType != "ssd" {
+		t.Errorf("Expected a 100GB ssd boot volume, got %d, %q", spec.BootVolumeSize, spec.VolumeType)
+	}
+
+	output, err := runCommand(t, "list", "--output", "wide")
+	if err != nil {
+		t.Fatalf("list command failed: %v", err)
+	}
+	if !strings.Contains(output, "BOOT VOLUME") || !strings.Contains(output, "100GB (ssd)") {
+		t.Errorf("Expected list --output wide to show the boot volume, got:\n%s", output)
+	}
+}
+
+func TestCreate_BootVolumeFromConfig(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+
+	content := "boot_volume_size: 50\nvolume_type: standard\n"
+	if err := os.MkdirAll(".config", 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if _, err := runCommand(t, "create", "configured"); err != nil {
+		t.Fatalf("create command failed: %v", err)
+	}
+	spec := createdSpec(t, provider, "tins-configured")
+	if spec.BootVolumeSize != 50 || spec.VolumeType != "standard" || spec.Metadata[BootVolumeTag] != "50GB (standard)" {
+		t.Errorf("Expected the configured boot volume, got %d, %q, %v", spec.BootVolumeSize, spec.VolumeType, spec.Metadata)
+	}
+
+	if err := os.WriteFile(filepath.Join(".config", "tint.yaml"), []byte("boot_volume_size: -1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for a negative boot_volume_size")
+	}
+}
+
+func TestCreate_BootVolume_FakeOpenStack(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	resetFlagsAfterTest(t, createCmd)
+
+	if output, err := runCommand(t, "create", "bfv", "--boot-volume-size", "100"); err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	server := fake.Server("tins-bfv")
+	if server == nil {
+		t.Fatal("Expected server tins-bfv to be created")
+	}
+	if server.ImageRef != "" || len(server.BlockDevices) != 1 {
+		t.Fatalf("Expected the server to boot from a block device, got imageRef %q and %+v", server.ImageRef, server.BlockDevices)
+	}
+	device := server.BlockDevices[0]
+	if device.SourceType != "image" || device.UUID != "image-1" || device.DestinationType != "volume" ||
+		device.VolumeSize != 100 || !device.DeleteOnTermination || device.BootIndex != 0 {
+		t.Errorf("Expected a 100GB volume from image-1 deleted on termination, got %+v", device)
+	}
+}
+
+func TestCreateTerminate_DataVolumes_FakeOpenStack(t *testing.T) {
+	fake := useFakeOpenStack(t)
+	resetFlagsAfterTest(t, createCmd)
+
+	if output, err := runCommand(t, "create", "scratch", "--volume", "20:ssd:/data"); err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	server := fake.Server("tins-scratch")
+	volume := fake.Volume("tins-scratch-vol1")
+	if server == nil || volume == nil {
+		t.Fatalf("Expected server tins-scratch and volume tins-scratch-vol1, got %v and %v", server, volume)
+	}
+	if volume.Size != 20 || volume.VolumeType != "ssd" || volume.Metadata[TempInstanceTag] != "true" || volume.Metadata[VolumeInstanceTag] != "tins-scratch" {
+		t.Errorf("Expected a tagged 20GB ssd volume, got %+v", volume)
+	}
+	if volume.Status != "in-use" || volume.ServerID != server.ID {
+		t.Errorf("Expected the volume to be attached to %s, got %+v", server.ID, volume)
+	}
+
+	if output, err := runCommand(t, "terminate", "scratch"); err != nil {
+		t.Fatalf("terminate command failed: %v\n%s", err, output)
+	}
+	if fake.Volume("tins-scratch-vol1") != nil {
+		t.Error("Expected terminate to delete the volume")
+	}
+}
+
+// createdSpec returns the spec the named instance was created from
+func createdSpec(t *testing.T, provider *fakeProvider, name string) InstanceSpec {
+	t.Helper()
+	for _, spec := range provider.specs {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	t.Fatalf("Instance %s was not created", name)
+	return InstanceSpec{}
+}
+
+func TestParseDataVolume(t *testing.T) {
+	tests := []struct {
+		value string
+		want  DataVolume
+	}{
+		{"100", DataVolume{SizeGB: 100}},
+		{"50:ssd", DataVolume{SizeGB: 50, VolumeType: "ssd"}},
+		{"20:/data", DataVolume{SizeGB: 20, MountPoint: "/data"}},
+		{"20:fast-ssd:/srv/cache", DataVolume{SizeGB: 20, VolumeType: "fast-ssd", MountPoint: "/srv/cache"}},
+	}
+	for _, tt := range tests {
+		volume, err := parseDataVolume(tt.value)
+		if err != nil {
+			t.Errorf("parseDataVolume(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if volume != tt.want {
+			t.Errorf("parseDataVolume(%q) = %+v; expected %+v", tt.value, volume, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "big", "0", "-5", "10:ssd:/data:x", "10:/data:ssd", "10:ssd:/", "10:/da ta", "10:/data/../etc", "10:/data'x"} {
+		if _, err := parseDataVolume(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestCreateTerminate_DataVolumes(t *testing.T) {
+	setTestConfigEnv(t)
+	provider := newFakeProvider()
+	useFakeProvider(t, provider)
+	resetFlagsAfterTest(t, createCmd)
+	resetFlagsAfterTest(t, terminateCmd)
+
+	output, err := runCommand(t, "create", "scratch", "--volume", "10", "--volume", "20:ssd:/data", "--volume-type", "standard")
+	if err != nil {
+		t.Fatalf("create command failed: %v\n%s", err, output)
+	}
+	if len(provider.volumes) != 2 {
+		t.Fatalf("Expected two volumes, got %v", provider.volumes)
+	}
+	instance, err := findInstance(t.Context(), provider, "scratch")
+	if err != nil {
+		t.Fatalf("findInstance failed: %v", err)
+	}
+	var mounted *Volume
+	for _, volume := range provider.volumes {
+		if volume.Metadata[VolumeInstanceTag] != "tins-scratch" || len(volume.ServerIDs) != 1 || volume.ServerIDs[0] != instance.ID {
+			t.Errorf("Expected volume %s to be tagged with and attached to the instance, got %+v", volume.Name, volume)
+		}
+		if volume.Name == "tins-scratch-vol1" && volume.VolumeType != "standard" {
+			t.Errorf("Expected --volume-type to apply to volumes without a type, got %q", volume.VolumeType)
+		}
+		if volume.Name == "tins-scratch-vol2" {
+			mounted = volume
+		}
+	}
+	if mounted == nil || mounted.VolumeType != "ssd" || mounted.SizeGB != 20 {
+		t.Fatalf("Expected a 20GB ssd volume named tins-scratch-vol2, got %+v", mounted)
+	}
+	userData := string(createdSpec(t, provider, "tins-scratch").UserData)
+	if !strings.Contains(userData, "runcmd:") || !strings.Contains(userData, "mount_volume '"+mounted.ID+"' '/data'") {
+		t.Errorf("Expected user-data to mount the second volume at /data, got:\n%s", userData)
+	}
+	if strings.Count(userData, "mount_volume '") != 1 {
+		t.Errorf("Expected only the volume with a mount point to be mounted, got:\n%s", userData)
+	}
+
+	output, err = runCommand(t, "terminate", "scratch")
+	if err != nil {
+		t.Fatalf("terminate command failed: %v\n%s", err, output)
+	}
+	if len(provider.volumes) != 0 {
+		t.Errorf("Expected terminate to delete the volumes, got %v", provider.volumes)
+	}
+
+	// terminate --all deletes volumes whose instance is already gone, but not other tins volumes
+	provider.volumes["vol-orphan"] = &Volume{ID: "vol-orphan", Name: "tins-gone-vol1", Metadata: map[string]string{TempInstanceTag: "true", VolumeInstanceTag: "tins-gone"}}
+	provider.volumes["vol-other"] = &Volume{ID: "vol-other", Name: "other", Metadata: map[string]string{TempInstanceTag: "true"}}
+	if _, err := runCommand(t, "terminate", "--all"); err != nil {
+		t.Fatalf("terminate --all failed: %v", err)
+	}
+	if _, ok := provider.volumes["vol-orphan"]; ok {
+		t.Error("Expected terminate --all to delete the orphaned volume")
+	}
+	if _, ok := provider.volumes["vol-other"]; !ok {
+		t.Error("Expected terminate --all to keep volumes that don't belong to an instance")
+	}
+}